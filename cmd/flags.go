@@ -31,6 +31,59 @@ var (
 		Usage: "Password for relay chain wallet",
 		Value: "",
 	}
+
+	PolyStartHeightFlag = cli.UintFlag{
+		Name:  "polystartheight",
+		Usage: "Force scanning poly from `<height>`, ignoring the checkpoint in db",
+		Value: 0,
+	}
+
+	NeoStartHeightFlag = cli.UintFlag{
+		Name:  "neostartheight",
+		Usage: "Force scanning neo from `<height>`, ignoring the checkpoint in db",
+		Value: 0,
+	}
+
+	SkipPreflightFlag = cli.BoolFlag{
+		Name:  "skippreflight",
+		Usage: "Start without checking the start heights against the key headers synced on chain",
+	}
+
+	NeoTxFlag = cli.StringFlag{
+		Name:  "neo-tx",
+		Usage: "Hash of the NEO `<tx>` which contains the cross chain txs",
+	}
+
+	PolyHeightFlag = cli.UintFlag{
+		Name:  "poly-height",
+		Usage: "Poly `<height>` of the makeProof event",
+	}
+
+	KeyFlag = cli.StringFlag{
+		Name:  "key",
+		Usage: "Cross chain tx `<key>` in the makeProof event",
+	}
+
+	UtxoDustFlag = cli.Float64Flag{
+		Name:  "dust",
+		Usage: "Consolidate the gas utxos smaller than `<amount>`",
+	}
+
+	UtxoMaxInputsFlag = cli.UintFlag{
+		Name:  "max-inputs",
+		Usage: "Consolidate at most `<count>` utxos in one tx",
+		Value: config.DEFAULT_UTXO_MAX_INPUTS,
+	}
+
+	UtxoCountFlag = cli.UintFlag{
+		Name:  "count",
+		Usage: "Split `<count>` utxos out of the gas balance",
+	}
+
+	UtxoSizeFlag = cli.Float64Flag{
+		Name:  "size",
+		Usage: "Gas `<amount>` of each utxo split",
+	}
 )
 
 //GetFlagName deal with short flag, and return the flag name whether flag name have short name
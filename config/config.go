@@ -8,32 +8,110 @@ import (
 )
 
 const (
-	DEFAULT_CONFIG_FILE_NAME = "./config.json"
-	DEFAULT_LOG_LEVEL        = 2
+	DEFAULT_CONFIG_FILE_NAME  = "./config.json"
+	DEFAULT_LOG_LEVEL         = 2
+	DEFAULT_SHUTDOWN_TIMEOUT  = 60
+	DEFAULT_MONITOR_INTERVAL  = 30
+	DEFAULT_RETRY_ATTEMPTS    = 20
+	DEFAULT_RETRY_MAX_DELAY   = 3600
+	DEFAULT_NTOR_WORKERS      = 4
+	DEFAULT_NODE_CHECK        = 15
+	DEFAULT_NEO_MAX_LAG       = 1
+	DEFAULT_RELAY_MAX_LAG     = 1
+	DEFAULT_NEO_CHECK_TIMEOUT = 300
+	DEFAULT_UTXO_EXPIRY       = 1800
+	DEFAULT_UTXO_MAX_INPUTS   = 100
+	DEFAULT_BALANCE_CHECK     = 60
+	DEFAULT_ALERT_DEDUPE      = 600
+	DEFAULT_ALERT_RATE        = 20
+	DEFAULT_NEO_CONGESTION    = 500
+	DEFAULT_NEO_HASH_WINDOW   = 1000
+	DEFAULT_PREFLIGHT_REWIND  = 100000
+	DEFAULT_PREFLIGHT_REPLAY  = 1000000
 )
 
 //Config object used by neo-instance
 type Config struct {
 	RelayJsonRpcUrl   string
+	RelayJsonRpcUrls  []string // poly nodes to fail over between, RelayJsonRpcUrl is the only one if empty
+	RelayMaxLag       uint32   // blocks a poly node may fall behind the best one and still be used, DEFAULT_RELAY_MAX_LAG if 0
 	WalletFile        string
 	RelayAccountsPath string
 
-	NeoWalletFile    string
-	NeoJsonRpcUrl    string
-	NeoChainID       uint64
-	NeoCCMC          string // little endian string
-	NtorContract	 string // neo to relay contract which is monitored
-	RtonContract	 string // relay to neo contract which is monitored
-	NeoSysFee        float64
-	NeoNetFee        float64
+	NeoWalletFile  string
+	NeoJsonRpcUrl  string
+	NeoJsonRpcUrls []string // neo nodes to fail over between, NeoJsonRpcUrl is the only one if empty
+	NeoMaxLag      uint32   // blocks a neo node may fall behind the best one and still be used, DEFAULT_NEO_MAX_LAG if 0
+	NeoChainID     uint64
+	NeoCCMC        string    // little endian string
+	NtorContract   Contracts // neo to relay contracts which are monitored, everything if empty
+	RtonContract   Contracts // relay to neo contracts which are monitored, everything if empty
+	NeoSysFee      float64
+	NeoNetFee      float64
 
-	ScanInterval     uint64
-	RetryInterval    uint64
-	DBPath           string
-	ChangeBookkeeper bool
+	ScanInterval      uint64
+	NodeCheckInterval uint64 // seconds between two rounds of checking the health of the rpc nodes, DEFAULT_NODE_CHECK if 0
+	NtorWorkers       uint32 // concurrent proof submissions from neo to relay, DEFAULT_NTOR_WORKERS if 0
+	RetryInterval     uint64
+	NeoCheckTimeout   uint64 // seconds a tx sent to neo may stay out of blocks before it is taken as dropped, DEFAULT_NEO_CHECK_TIMEOUT if 0
+	UtxoExpiry        uint64 // seconds before the inputs of a tx which is not in a block can be spent again, DEFAULT_UTXO_EXPIRY if 0
+	RetryMaxAttempts  uint32 // attempts before a retry is moved to the dead letter bucket, DEFAULT_RETRY_ATTEMPTS if 0
+	RetryMaxDelay     uint64 // seconds, cap of the exponential backoff starting from RetryInterval, DEFAULT_RETRY_MAX_DELAY if 0
+	DBPath            string
+	ChangeBookkeeper  bool
+	ShutdownTimeout   uint64 // seconds to wait for in-flight relays on exit, DEFAULT_SHUTDOWN_TIMEOUT if 0
+
+	MetricsAddress   string // listen address of the prometheus metrics, like "127.0.0.1:9100", disabled if empty
+	MonitorInterval  uint64 // seconds between two rounds of collecting metrics, DEFAULT_MONITOR_INTERVAL if 0
+	AdminAddress     string // listen address of the admin api, like "127.0.0.1:9101", disabled if empty
+	AdminAllowRemote bool   // serve the admin api on an AdminAddress which is not loopback, it has no authentication
+
+	UtxoInterval uint64  // seconds between two rounds of consolidating and splitting the gas utxos, disabled if 0
+	UtxoDust     float64 // gas utxos smaller than it are consolidated in the background, disabled if 0
+	UtxoCount    uint32  // gas utxos of at least UtxoSize kept in the background for concurrent txs, disabled if 0
+	UtxoSize     float64
+
+	BalanceCheckInterval uint64  // seconds between two checks of the account balances, DEFAULT_BALANCE_CHECK if 0
+	NeoBalanceWarn       float64 // gas of the neo account below which a warning is alerted, disabled if 0
+	NeoBalanceCritical   float64 // gas of the neo account below which a critical alert is raised, disabled if 0
+	RelayBalanceWarn     float64 // balance of the relay account on poly below which a warning is alerted, disabled if 0
+	RelayBalanceCritical float64 // balance of the relay account on poly below which a critical alert is raised, disabled if 0
+	NeoFeeBudget         float64 // gas the txs to neo may spend per utc day before they are paused, disabled if 0
+
+	NeoFeePerByte    float64 // network fee per byte added when the mempool of neo is congested, disabled if 0
+	NeoFeeMin        float64 // least network fee of a tx, besides the size fee required by neo
+	NeoFeeMax        float64 // most network fee of a tx, besides the size fee required by neo, no cap if 0
+	NeoCongestion    uint32  // mempool size from which neo is taken as congested, DEFAULT_NEO_CONGESTION if 0
+	NeoFeeEscalation float64 // ratio the network fee of a retry grows by per failed attempt, disabled if 0
+	NeoReplaceBlocks uint32  // neo blocks a tx may stay out of blocks before it is replaced by one paying more fee, disabled if 0
+
+	NeoConfirmations uint32 // more neo blocks on top of a block before it is scanned, besides the latest one
+	NeoHashWindow    uint32 // hashes of the neo blocks scanned kept to find a different chain, DEFAULT_NEO_HASH_WINDOW if 0
+
+	PreflightMaxRewind uint32 // most blocks a start height is moved back at startup not to skip key headers, DEFAULT_PREFLIGHT_REWIND if 0
+	PreflightMaxReplay uint32 // most blocks a start height may be below the key header synced on chain, DEFAULT_PREFLIGHT_REPLAY if 0
+
+	Notifiers        []*NotifierConfig // where the alerts are sent besides the log
+	AlertDedupWindow uint64            // seconds in which the same alert is sent once, DEFAULT_ALERT_DEDUPE if 0
+	AlertRateLimit   uint32            // alerts sent per minute at most, DEFAULT_ALERT_RATE if 0
+	StallIntervals   uint32            // scan intervals a scanner may stay at one height while behind the chain, disabled if 0
+
+	PolicyRules   []*PolicyRule // decide in order which cross chain txs are relayed, DefaultPolicyRules if empty
+	PolicyDefault string        // POLICY_ALLOW or POLICY_DENY for the txs no rule matches, POLICY_ALLOW if empty
 
 	PolyStartHeight uint32
 	NeoStartHeight  uint32
+
+	ForcePolyStartHeight bool // ignore the poly checkpoint in db and start from PolyStartHeight
+	ForceNeoStartHeight  bool // ignore the neo checkpoint in db and start from NeoStartHeight
+}
+
+// NotifierConfig is a sink of the alerts
+type NotifierConfig struct {
+	Type    string // "webhook", "slack" or "exec"
+	Url     string // url of webhook and slack
+	Command string // command of exec, run with Args for every alert
+	Args    []string
 }
 
 //Default config instance
@@ -44,12 +122,47 @@ func NewConfig() *Config {
 	return &Config{}
 }
 
+// NeoRpcUrls lists the neo nodes to connect, without duplicates
+func (this *Config) NeoRpcUrls() []string {
+	urls := this.NeoJsonRpcUrls
+	if len(urls) == 0 {
+		urls = []string{this.NeoJsonRpcUrl}
+	}
+	return uniqueUrls(urls)
+}
+
+// RelayRpcUrls lists the poly nodes to connect, without duplicates
+func (this *Config) RelayRpcUrls() []string {
+	urls := this.RelayJsonRpcUrls
+	if len(urls) == 0 {
+		urls = []string{this.RelayJsonRpcUrl}
+	}
+	return uniqueUrls(urls)
+}
+
+func uniqueUrls(urls []string) []string {
+	result := make([]string, 0, len(urls))
+	seen := make(map[string]bool)
+	for _, url := range urls {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		result = append(result, url)
+	}
+	return result
+}
+
 //Init TestConfig with a config file
 func (this *Config) Init(fileName string) error {
 	err := this.loadConfig(fileName)
 	if err != nil {
 		return fmt.Errorf("loadConfig error:%s", err)
 	}
+	err = this.CheckPolicy()
+	if err != nil {
+		return fmt.Errorf("CheckPolicy error:%s", err)
+	}
 	return nil
 }
 
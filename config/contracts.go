@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Contracts are the hex strings of the contracts monitored, unmarshaled from a json array or a single string
+type Contracts []string
+
+func (this *Contracts) UnmarshalJSON(data []byte) error {
+	var contract string
+	if err := json.Unmarshal(data, &contract); err == nil {
+		*this = nil
+		if contract != "" {
+			*this = Contracts{contract}
+		}
+		return nil
+	}
+	var contracts []string
+	if err := json.Unmarshal(data, &contracts); err != nil {
+		return err
+	}
+	*this = Contracts{}
+	for _, contract := range contracts {
+		if contract != "" {
+			*this = append(*this, contract)
+		}
+	}
+	return nil
+}
+
+// Has checks contract is one of the contracts, ignoring case and the 0x prefix
+func (this Contracts) Has(contract string) bool {
+	for _, v := range this {
+		if strings.EqualFold(strings.TrimPrefix(v, "0x"), strings.TrimPrefix(contract, "0x")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+)
+
+const (
+	POLICY_ALLOW = "allow"
+	POLICY_DENY  = "deny"
+
+	POLICY_NTOR = "ntor"
+	POLICY_RTON = "rton"
+)
+
+// PolicyRule matches the cross chain txs having a value in every list set in it and an amount of at least
+// MinAmount if set, the first rule matching a tx decides whether it is relayed
+type PolicyRule struct {
+	Name          string // logged with the txs skipped by the rule
+	Action        string // POLICY_ALLOW or POLICY_DENY
+	Direction     string // POLICY_NTOR or POLICY_RTON, both if empty
+	FromChainIDs  []uint64
+	ToChainIDs    []uint64
+	FromContracts []string // hex of the contract bytes in the cross chain tx, like NtorContract
+	ToContracts   []string
+	Methods       []string // like "unlock"
+	AssetHashes   []string // hex of the asset hash bytes in the args of the method
+	MinAmount     string   // decimal, in the smallest unit of the asset
+}
+
+// DefaultPolicyRules are used when no PolicyRules are configured, they relay only unlock to neo
+var DefaultPolicyRules = []*PolicyRule{
+	{Name: "unlock", Action: POLICY_ALLOW, Direction: POLICY_RTON, Methods: []string{"unlock"}},
+	{Name: "not unlock", Action: POLICY_DENY, Direction: POLICY_RTON},
+}
+
+// CheckPolicy checks the policy rules and default can be evaluated
+func (this *Config) CheckPolicy() error {
+	if this.PolicyDefault != "" && this.PolicyDefault != POLICY_ALLOW && this.PolicyDefault != POLICY_DENY {
+		return fmt.Errorf("policy default %s is neither %s nor %s", this.PolicyDefault, POLICY_ALLOW, POLICY_DENY)
+	}
+	for i, rule := range this.PolicyRules {
+		if rule.Action != POLICY_ALLOW && rule.Action != POLICY_DENY {
+			return fmt.Errorf("action %s of policy rule %d is neither %s nor %s", rule.Action, i, POLICY_ALLOW, POLICY_DENY)
+		}
+		if rule.Direction != "" && rule.Direction != POLICY_NTOR && rule.Direction != POLICY_RTON {
+			return fmt.Errorf("direction %s of policy rule %d is neither %s nor %s", rule.Direction, i, POLICY_NTOR, POLICY_RTON)
+		}
+		if rule.MinAmount != "" {
+			if _, ok := new(big.Int).SetString(rule.MinAmount, 10); !ok {
+				return fmt.Errorf("min amount %s of policy rule %d is not a decimal", rule.MinAmount, i)
+			}
+		}
+	}
+	return nil
+}
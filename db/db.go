@@ -1,24 +1,39 @@
 package db
 // db not used
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"github.com/boltdb/bolt"
 	"github.com/joeqian10/neo-gogogo/helper"
 	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/poly/common"
 	"path"
 	"strings"
 	"sync"
+	"time"
 )
 
 const MAX_NUM = 1000
 
+const (
+	DEAD_NTOR byte = 0x01 // neo to relay
+	DEAD_RTON byte = 0x02 // relay to neo
+)
+
 var (
 	BKTCheck = []byte("Check")
 	BKTRetry = []byte("Retry")
 	BKTUtxo = []byte("Utxo")
+	BKTNeoChange = []byte("NeoChange") // change outputs of the txs sent to neo which are not in a block yet
 
 	BKTNeoRetry = []byte("NeoRetry")
+	BKTNeoCheck = []byte("NeoCheck") // txs sent to neo waiting for confirmation, keyed by tx hash
+	BKTNeoFee = []byte("NeoFee") // gas spent by the txs sent to neo, keyed by utc day
+	BKTNeoHash = []byte("NeoHash") // hashes of the neo blocks scanned recently, keyed by height in big endian
+
+	BKTDeadLetter = []byte("DeadLetter") // retries which failed too many times, keyed by DEAD_NTOR or DEAD_RTON + Retry.Id
+	BKTTransfer = []byte("Transfer") // poly to neo transfers decoded from their proofs, keyed by Retry.Id
 
 	BKTHeight = []byte("Height")
 	BKTHeader = []byte("Header") // bucket header
@@ -36,7 +51,8 @@ func NewBoltDB(filePath string) (*BoltDB, error) {
 		filePath = path.Join(filePath, "bolt.bin")
 	}
 	w := new(BoltDB)
-	db, err := bolt.Open(filePath, 0644, &bolt.Options{InitialMmapSize: 500000})
+	// do not wait forever when another relayer process holds the db
+	db, err := bolt.Open(filePath, 0644, &bolt.Options{InitialMmapSize: 500000, Timeout: 10 * time.Second})
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +89,16 @@ func NewBoltDB(filePath string) (*BoltDB, error) {
 	}); err != nil {
 		return nil, err
 	}
+	// neo change
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTNeoChange)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
 	// neo retry
 	if err = db.Update(func(btx *bolt.Tx) error {
 		_, err := btx.CreateBucketIfNotExists(BKTNeoRetry)
@@ -83,6 +109,69 @@ func NewBoltDB(filePath string) (*BoltDB, error) {
 	}); err != nil {
 		return nil, err
 	}
+	// neo check
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTNeoCheck)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	// neo fee
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTNeoFee)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	// neo hash
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTNeoHash)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// dead letter
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTDeadLetter)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// transfer
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTTransfer)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// scan progress
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTHeight)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
 
 	if err = db.Update(func(btx *bolt.Tx) error {
 		_, err := btx.CreateBucketIfNotExists(BKTHeader)
@@ -108,51 +197,35 @@ func NewBoltDB(filePath string) (*BoltDB, error) {
 }
 
 
-//func (w *BoltDB) PutPolyHeight(height uint32) error {
-//	w.rwLock.Lock()
-//	defer w.rwLock.Unlock()
-//
-//	raw := make([]byte, 4)
-//	binary.LittleEndian.PutUint32(raw, height)
-//	return w.db.Update(func(tx *bolt.Tx) error {
-//		bucket := tx.Bucket(BKTHeight)
-//		err := bucket.Put([]byte("poly"), raw)
-//		if err != nil {
-//			return err
-//		}
-//
-//		return nil
-//	})
-//}
-//
-//func (w *BoltDB) GetPolyHeight() uint32 {
-//	w.rwLock.RLock()
-//	defer w.rwLock.RUnlock()
-//
-//	var height uint32
-//	_ = w.db.View(func(tx *bolt.Tx) error {
-//		bucket := tx.Bucket(BKTHeight)
-//		raw := bucket.Get([]byte("poly"))
-//		if len(raw) == 0 {
-//			height = 0
-//			return nil
-//		}
-//		height = binary.LittleEndian.Uint32(raw)
-//		return nil
-//	})
-//
-//	return height
-//}
-
-
-
-func (w *BoltDB) PutNeoRetry(k []byte) error {
+// PutPolyHeight stores the next poly height to be scanned by RelayToNeo
+func (w *BoltDB) PutPolyHeight(height uint32) error {
+	return w.putHeight([]byte("poly"), height)
+}
+
+// GetPolyHeight returns the stored poly checkpoint, 0 if there is none
+func (w *BoltDB) GetPolyHeight() uint32 {
+	return w.getHeight([]byte("poly"))
+}
+
+// PutNeoHeight stores the next neo height to be scanned by NeoToRelay
+func (w *BoltDB) PutNeoHeight(height uint32) error {
+	return w.putHeight([]byte("neo"), height)
+}
+
+// GetNeoHeight returns the stored neo checkpoint, 0 if there is none
+func (w *BoltDB) GetNeoHeight() uint32 {
+	return w.getHeight([]byte("neo"))
+}
+
+func (w *BoltDB) putHeight(k []byte, height uint32) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
-	return w.db.Update(func(btx *bolt.Tx) error {
-		bucket := btx.Bucket(BKTNeoRetry)
-		err := bucket.Put(k, []byte{0x00})
+	raw := make([]byte, 4)
+	binary.LittleEndian.PutUint32(raw, height)
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTHeight)
+		err := bucket.Put(k, raw)
 		if err != nil {
 			return err
 		}
@@ -161,6 +234,125 @@ func (w *BoltDB) PutNeoRetry(k []byte) error {
 	})
 }
 
+func (w *BoltDB) getHeight(k []byte) uint32 {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var height uint32
+	_ = w.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTHeight)
+		raw := bucket.Get(k)
+		if len(raw) != 4 {
+			height = 0
+			return nil
+		}
+		height = binary.LittleEndian.Uint32(raw)
+		return nil
+	})
+
+	return height
+}
+
+// PutNeoHash stores the hash of the neo block at height, and forgets the ones keep blocks below it
+func (w *BoltDB) PutNeoHash(height uint32, hash string, keep uint32) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTNeoHash)
+		if err := bucket.Put(neoHashKey(height), []byte(hash)); err != nil {
+			return err
+		}
+		if height < keep {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint32(k) < height-keep; k, _ = cursor.First() {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetNeoHash returns the stored hash of the neo block at height, empty if there is none
+func (w *BoltDB) GetNeoHash(height uint32) string {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var hash string
+	_ = w.db.View(func(tx *bolt.Tx) error {
+		hash = string(tx.Bucket(BKTNeoHash).Get(neoHashKey(height)))
+		return nil
+	})
+	return hash
+}
+
+// DeleteNeoHashFrom forgets the hashes of the neo blocks from height on
+func (w *BoltDB) DeleteNeoHashFrom(height uint32) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTNeoHash)
+		cursor := bucket.Cursor()
+		for k, _ := cursor.Seek(neoHashKey(height)); k != nil; k, _ = cursor.Seek(neoHashKey(height)) {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func neoHashKey(height uint32) []byte {
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, height)
+	return k
+}
+
+// AddNeoFee adds fee, in Fixed8, to the gas spent on day, and returns the sum
+func (w *BoltDB) AddNeoFee(day string, fee int64) (int64, error) {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	var sum int64
+	err := w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTNeoFee)
+		if raw := bucket.Get([]byte(day)); len(raw) == 8 {
+			sum = int64(binary.LittleEndian.Uint64(raw))
+		}
+		sum += fee
+		raw := make([]byte, 8)
+		binary.LittleEndian.PutUint64(raw, uint64(sum))
+		return bucket.Put([]byte(day), raw)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
+
+// GetNeoFee returns the gas spent on day in Fixed8, 0 if there is none
+func (w *BoltDB) GetNeoFee(day string) int64 {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var sum int64
+	_ = w.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(BKTNeoFee).Get([]byte(day)); len(raw) == 8 {
+			sum = int64(binary.LittleEndian.Uint64(raw))
+		}
+		return nil
+	})
+	return sum
+}
+
+func (w *BoltDB) PutNeoRetry(retry *Retry) error {
+	return w.putRetry(BKTNeoRetry, retry)
+}
+
 func (w *BoltDB) DeleteNeoRetry(k []byte) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
@@ -175,35 +367,84 @@ func (w *BoltDB) DeleteNeoRetry(k []byte) error {
 	})
 }
 
-func (w *BoltDB) GetAllNeoRetry() ([][]byte, error) {
+func (w *BoltDB) GetNeoRetry(k []byte) (*Retry, error) {
+	return w.getRetry(BKTNeoRetry, k)
+}
+
+func (w *BoltDB) GetAllNeoRetry() ([]*Retry, error) {
+	return w.getAllRetry(BKTNeoRetry)
+}
+
+func (w *BoltDB) PutNeoCheck(txHash string, check *NeoCheck) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
-	retryList := make([][]byte, 0)
-	err := w.db.Update(func(tx *bolt.Tx) error {
-		bw := tx.Bucket(BKTNeoRetry)
-		err := bw.ForEach(func(k, _ []byte) error {
-			_k := make([]byte, len(k))
-			copy(_k, k)
-			retryList = append(retryList, _k)
-			if len(retryList) >= MAX_NUM {
+	k, err := hex.DecodeString(txHash)
+	if err != nil {
+		return err
+	}
+	sink := common.NewZeroCopySink(nil)
+	check.Serialization(sink)
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTNeoCheck)
+		err := bucket.Put(k, sink.Bytes())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (w *BoltDB) DeleteNeoCheck(txHash string) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	k, err := hex.DecodeString(txHash)
+	if err != nil {
+		return err
+	}
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTNeoCheck)
+		err := bucket.Delete(k)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// GetAllNeoCheck returns the txs waiting for confirmation by tx hash in big endian hex
+func (w *BoltDB) GetAllNeoCheck() (map[string]*NeoCheck, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	checkMap := make(map[string]*NeoCheck)
+	err := w.db.View(func(tx *bolt.Tx) error {
+		bw := tx.Bucket(BKTNeoCheck)
+		err := bw.ForEach(func(k, v []byte) error {
+			check := new(NeoCheck)
+			if err := check.Deserialization(common.NewZeroCopySource(v)); err != nil {
+				log.Errorf("GetAllNeoCheck err: %s, db key: %x", err, k)
+				return nil
+			}
+			checkMap[hex.EncodeToString(k)] = check
+			if len(checkMap) >= MAX_NUM {
 				return fmt.Errorf("max num")
 			}
 			return nil
 		})
 		if err != nil {
-			log.Errorf("GetAllRetry err: %s", err)
+			log.Errorf("GetAllNeoCheck err: %s", err)
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return retryList, nil
+	return checkMap, nil
 }
 
-
-
 func (w *BoltDB) PutCheck(txHash string, v []byte) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
@@ -241,28 +482,84 @@ func (w *BoltDB) DeleteCheck(txHash string) error {
 	})
 }
 
-func (w *BoltDB) PutRetry(k []byte) error {
+// GetCheck returns the value of the check entry of txHash, nil if there is none
+func (w *BoltDB) GetCheck(txHash string) ([]byte, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	k, err := hex.DecodeString(txHash)
+	if err != nil {
+		return nil, err
+	}
+	var v []byte
+	err = w.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(BKTCheck).Get(k); value != nil {
+			v = make([]byte, len(value))
+			copy(v, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (w *BoltDB) PutRetry(retry *Retry) error {
+	return w.putRetry(BKTRetry, retry)
+}
+
+func (w *BoltDB) DeleteRetry(k []byte) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTRetry)
+		err := bucket.Delete(k)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (w *BoltDB) GetRetry(k []byte) (*Retry, error) {
+	return w.getRetry(BKTRetry, k)
+}
+
+func (w *BoltDB) GetAllRetry() ([]*Retry, error) {
+	return w.getAllRetry(BKTRetry)
+}
+
+// PutDeadLetter moves retry from the retry bucket of its direction into the dead letter bucket
+func (w *BoltDB) PutDeadLetter(prefix byte, retry *Retry) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
+	retryBucket := BKTRetry
+	if prefix == DEAD_RTON {
+		retryBucket = BKTNeoRetry
+	}
+	sink := common.NewZeroCopySink(nil)
+	retry.Serialization(sink)
 	return w.db.Update(func(btx *bolt.Tx) error {
-		bucket := btx.Bucket(BKTRetry)
-		err := bucket.Put(k, []byte{0x00})
+		bucket := btx.Bucket(BKTDeadLetter)
+		err := bucket.Put(append([]byte{prefix}, retry.Id()...), sink.Bytes())
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return btx.Bucket(retryBucket).Delete(retry.Id())
 	})
 }
 
-func (w *BoltDB) DeleteRetry(k []byte) error {
+func (w *BoltDB) DeleteDeadLetter(prefix byte, k []byte) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
 	return w.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(BKTRetry)
-		err := bucket.Delete(k)
+		bucket := tx.Bucket(BKTDeadLetter)
+		err := bucket.Delete(append([]byte{prefix}, k...))
 		if err != nil {
 			return err
 		}
@@ -270,6 +567,175 @@ func (w *BoltDB) DeleteRetry(k []byte) error {
 	})
 }
 
+func (w *BoltDB) GetDeadLetter(prefix byte, k []byte) (*Retry, error) {
+	return w.getRetry(BKTDeadLetter, append([]byte{prefix}, k...))
+}
+
+func (w *BoltDB) GetAllDeadLetter(prefix byte) ([]*Retry, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	deadList := make([]*Retry, 0)
+	err := w.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BKTDeadLetter).Cursor()
+		for k, v := c.Seek([]byte{prefix}); k != nil && k[0] == prefix; k, v = c.Next() {
+			retry, err := decodeRetry(k[1:], v)
+			if err != nil {
+				log.Errorf("GetAllDeadLetter err: %s", err)
+				continue
+			}
+			deadList = append(deadList, retry)
+			if len(deadList) >= MAX_NUM {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deadList, nil
+}
+
+func (w *BoltDB) PutTransfer(transfer *Transfer) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	sink := common.NewZeroCopySink(nil)
+	transfer.Serialization(sink)
+	return w.db.Update(func(btx *bolt.Tx) error {
+		return btx.Bucket(BKTTransfer).Put(transfer.Id(), sink.Bytes())
+	})
+}
+
+// GetTransfer returns nil if k does not exist
+func (w *BoltDB) GetTransfer(k []byte) (*Transfer, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var transfer *Transfer
+	err := w.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(BKTTransfer).Get(k)
+		if v == nil {
+			return nil
+		}
+		transfer = new(Transfer)
+		return transfer.Deserialization(common.NewZeroCopySource(v))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// GetAllTransfer returns at most MAX_NUM transfers
+func (w *BoltDB) GetAllTransfer() ([]*Transfer, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	transfers := make([]*Transfer, 0)
+	err := w.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BKTTransfer).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			transfer := new(Transfer)
+			if err := transfer.Deserialization(common.NewZeroCopySource(v)); err != nil {
+				log.Errorf("GetAllTransfer err: %s, db key: %x", err, k)
+				continue
+			}
+			transfers = append(transfers, transfer)
+			if len(transfers) >= MAX_NUM {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (w *BoltDB) putRetry(bucketName []byte, retry *Retry) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	sink := common.NewZeroCopySink(nil)
+	retry.Serialization(sink)
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(bucketName)
+		err := bucket.Put(retry.Id(), sink.Bytes())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// getRetry returns nil if k does not exist
+func (w *BoltDB) getRetry(bucketName []byte, k []byte) (*Retry, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var retry *Retry
+	err := w.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get(k)
+		if v == nil {
+			return nil
+		}
+		var err error
+		retry, err = decodeRetry(k, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retry, nil
+}
+
+func (w *BoltDB) getAllRetry(bucketName []byte) ([]*Retry, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	retryList := make([]*Retry, 0)
+	err := w.db.View(func(tx *bolt.Tx) error {
+		bw := tx.Bucket(bucketName)
+		err := bw.ForEach(func(k, v []byte) error {
+			retry, err := decodeRetry(k, v)
+			if err != nil {
+				log.Errorf("GetAllRetry err: %s", err)
+				return nil
+			}
+			retryList = append(retryList, retry)
+			if len(retryList) >= MAX_NUM {
+				return fmt.Errorf("max num")
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("GetAllRetry err: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retryList, nil
+}
+
+// decodeRetry decodes the retry state in v, entries written before RETRY_VERSION_1 only have a placeholder value
+// and Height and Key in k
+func decodeRetry(k, v []byte) (*Retry, error) {
+	retry := new(Retry)
+	if len(v) == 1 && v[0] == 0x00 {
+		v = k
+	}
+	if err := retry.Deserialization(common.NewZeroCopySource(v)); err != nil {
+		return nil, fmt.Errorf("retry.Deserialization error: %s, db key: %x", err, k)
+	}
+	return retry, nil
+}
+
 func (w *BoltDB) GetAllCheck() (map[string][]byte, error) {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
@@ -299,75 +765,152 @@ func (w *BoltDB) GetAllCheck() (map[string][]byte, error) {
 	return checkMap, nil
 }
 
-func (w *BoltDB) GetAllRetry() ([][]byte, error) {
+// PutUtxo saves the state of a utxo of the relayer
+func (w *BoltDB) PutUtxo(utxo *NeoUtxo, state *UtxoState) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
-	retryList := make([][]byte, 0)
-	err := w.db.Update(func(tx *bolt.Tx) error {
-		bw := tx.Bucket(BKTRetry)
-		err := bw.ForEach(func(k, _ []byte) error {
-			_k := make([]byte, len(k))
-			copy(_k, k)
-			retryList = append(retryList, _k)
-			if len(retryList) >= MAX_NUM {
-				return fmt.Errorf("max num")
-			}
-			return nil
-		})
+	k := common.NewZeroCopySink(nil)
+	utxo.Serialization(k)
+	v := common.NewZeroCopySink(nil)
+	state.Serialization(v)
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTUtxo)
+		err := bucket.Put(k.Bytes(), v.Bytes())
 		if err != nil {
-			log.Errorf("GetAllRetry err: %s", err)
+			return err
 		}
+
 		return nil
 	})
+}
+
+// GetUtxo returns nil if utxo is not in db
+func (w *BoltDB) GetUtxo(utxo *NeoUtxo) (*UtxoState, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	k := common.NewZeroCopySink(nil)
+	utxo.Serialization(k)
+	var state *UtxoState
+	err := w.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(BKTUtxo).Get(k.Bytes())
+		if v == nil {
+			return nil
+		}
+		state = new(UtxoState)
+		return state.Deserialization(common.NewZeroCopySource(v))
+	})
 	if err != nil {
 		return nil, err
 	}
-	return retryList, nil
+	return state, nil
 }
 
-func (w *BoltDB) PutUtxo(k []byte, isSpent bool) error {
+func (w *BoltDB) DeleteUtxo(utxo *NeoUtxo) error {
 	w.rwLock.Lock()
 	defer w.rwLock.Unlock()
 
-	var v []byte
-	if isSpent {
-		v = []byte{0x01}
-	} else {
-		v = []byte{0x00}
-	}
-	return w.db.Update(func(btx *bolt.Tx) error {
-		bucket := btx.Bucket(BKTUtxo)
-		err := bucket.Put(k, v)
+	k := common.NewZeroCopySink(nil)
+	utxo.Serialization(k)
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTUtxo)
+		err := bucket.Delete(k.Bytes())
 		if err != nil {
 			return err
 		}
-
 		return nil
 	})
 }
 
-func (w *BoltDB) GetUtxo(k []byte) (*bool, error) {
+// GetAllUtxo returns every utxo in db and its state
+func (w *BoltDB) GetAllUtxo() (map[NeoUtxo]*UtxoState, error) {
 	w.rwLock.RLock()
 	defer w.rwLock.RUnlock()
 
-	var isSpent bool
+	utxoMap := make(map[NeoUtxo]*UtxoState)
 	err := w.db.View(func(tx *bolt.Tx) error {
-		_v := tx.Bucket(BKTUtxo).Get(k)
-		if _v == nil || len(_v) < 1 {
-			return fmt.Errorf("value does not exist")
+		return tx.Bucket(BKTUtxo).ForEach(func(k, v []byte) error {
+			var utxo NeoUtxo
+			state := new(UtxoState)
+			if err := utxo.Deserialization(common.NewZeroCopySource(k)); err != nil {
+				log.Errorf("GetAllUtxo err: %s, db key: %x", err, k)
+				return nil
+			}
+			if err := state.Deserialization(common.NewZeroCopySource(v)); err != nil {
+				log.Errorf("GetAllUtxo err: %s, db key: %x", err, k)
+				return nil
+			}
+			utxoMap[utxo] = state
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return utxoMap, nil
+}
+
+func (w *BoltDB) PutNeoChange(utxo *NeoUtxo, change *NeoChange) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	k := common.NewZeroCopySink(nil)
+	utxo.Serialization(k)
+	v := common.NewZeroCopySink(nil)
+	change.Serialization(v)
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTNeoChange)
+		err := bucket.Put(k.Bytes(), v.Bytes())
+		if err != nil {
+			return err
 		}
-		if _v[0] == 0x00 {
-			isSpent = false
-		} else {
-			isSpent = true
+
+		return nil
+	})
+}
+
+func (w *BoltDB) DeleteNeoChange(utxo *NeoUtxo) error {
+	w.rwLock.Lock()
+	defer w.rwLock.Unlock()
+
+	k := common.NewZeroCopySink(nil)
+	utxo.Serialization(k)
+	return w.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(BKTNeoChange)
+		err := bucket.Delete(k.Bytes())
+		if err != nil {
+			return err
 		}
 		return nil
 	})
+}
+
+func (w *BoltDB) GetAllNeoChange() (map[NeoUtxo]*NeoChange, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	changeMap := make(map[NeoUtxo]*NeoChange)
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(BKTNeoChange).ForEach(func(k, v []byte) error {
+			var utxo NeoUtxo
+			change := new(NeoChange)
+			if err := utxo.Deserialization(common.NewZeroCopySource(k)); err != nil {
+				log.Errorf("GetAllNeoChange err: %s, db key: %x", err, k)
+				return nil
+			}
+			if err := change.Deserialization(common.NewZeroCopySource(v)); err != nil {
+				log.Errorf("GetAllNeoChange err: %s, db key: %x", err, k)
+				return nil
+			}
+			changeMap[utxo] = change
+			return nil
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &isSpent, nil
+	return changeMap, nil
 }
 
 func (w *BoltDB) PutHeader(height uint32, rawHeader []byte) error {
@@ -531,6 +1074,26 @@ func (w *BoltDB) PutValueInHeightList(height uint32) error {
 	return nil
 }
 
+// Count returns the number of entries in bucket
+func (w *BoltDB) Count(bucket []byte) (int, error) {
+	w.rwLock.RLock()
+	defer w.rwLock.RUnlock()
+
+	var n int
+	err := w.db.View(func(tx *bolt.Tx) error {
+		bw := tx.Bucket(bucket)
+		if bw == nil {
+			return fmt.Errorf("bucket %s does not exist", bucket)
+		}
+		n = bw.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 func (w *BoltDB) Close() {
 	w.rwLock.Lock()
 	w.db.Close()
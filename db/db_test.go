@@ -0,0 +1,261 @@
+package db
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/polynetwork/poly/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDB(t *testing.T) (*BoltDB, func()) {
+	dir, err := ioutil.TempDir("", "neo-relayer-db")
+	assert.Nil(t, err)
+	w, err := NewBoltDB(dir)
+	assert.Nil(t, err)
+	return w, func() {
+		w.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltDB_Height(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	assert.Equal(t, uint32(0), w.GetPolyHeight())
+	assert.Equal(t, uint32(0), w.GetNeoHeight())
+
+	assert.Nil(t, w.PutPolyHeight(11027320))
+	assert.Nil(t, w.PutNeoHeight(7795800))
+	assert.Equal(t, uint32(11027320), w.GetPolyHeight())
+	assert.Equal(t, uint32(7795800), w.GetNeoHeight())
+
+	assert.Nil(t, w.PutNeoHeight(7795801))
+	assert.Equal(t, uint32(7795801), w.GetNeoHeight())
+	assert.Equal(t, uint32(11027320), w.GetPolyHeight())
+}
+
+func TestBoltDB_Count(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	n, err := w.Count(BKTRetry)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, w.PutRetry(NewRetry(1, "01")))
+	assert.Nil(t, w.PutRetry(NewRetry(2, "02")))
+	n, err = w.Count(BKTRetry)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = w.Count([]byte("NotExist"))
+	assert.NotNil(t, err)
+}
+
+func TestBoltDB_Retry(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	// written before RETRY_VERSION_1, the value is a placeholder and the retry is in the key
+	legacy := &Retry{Height: 100, Key: "0a0b"}
+	assert.Nil(t, w.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(BKTNeoRetry).Put(legacy.Id(), []byte{0x00})
+	}))
+	retry, err := w.GetNeoRetry(legacy.Id())
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, retry)
+
+	retry.Attempts = 3
+	retry.LastError = "SendRawTransaction error"
+	retry.NextAttempt = 1600000000
+	assert.Nil(t, w.PutNeoRetry(retry))
+	retryList, err := w.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, []*Retry{retry}, retryList)
+
+	assert.Nil(t, w.PutDeadLetter(DEAD_RTON, retry))
+	retry2, err := w.GetNeoRetry(retry.Id())
+	assert.Nil(t, err)
+	assert.Nil(t, retry2)
+	deadList, err := w.GetAllDeadLetter(DEAD_RTON)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Retry{retry}, deadList)
+	deadList, err = w.GetAllDeadLetter(DEAD_NTOR)
+	assert.Nil(t, err)
+	assert.Empty(t, deadList)
+
+	assert.Nil(t, w.DeleteDeadLetter(DEAD_RTON, retry.Id()))
+	retry2, err = w.GetDeadLetter(DEAD_RTON, retry.Id())
+	assert.Nil(t, err)
+	assert.Nil(t, retry2)
+}
+
+func TestBoltDB_NeoCheck(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	txHash := "526bf799e3d6d524b314c5fc8cc5ce49bf9e26b2b727f34fe8409e71cb6b29a8"
+	check := &NeoCheck{
+		Method: "VerifyAndExecuteTx",
+		Retry:  Retry{Height: 100, Key: "0a0b", Attempts: 2, FirstSeen: 1600000000, NextAttempt: 1600000000},
+		SentAt: 1600000100,
+	}
+	assert.Nil(t, w.PutNeoCheck(txHash, check))
+	checkMap, err := w.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]*NeoCheck{txHash: check}, checkMap)
+
+	// the replacement state is kept since NEO_CHECK_VERSION_1
+	check.SentHeight = 5000
+	check.Fee = 200000
+	check.RawTx = "d1001b00"
+	check.Replaced = []string{"0a0b", "0c0d"}
+	assert.Nil(t, w.PutNeoCheck(txHash, check))
+	checkMap, err = w.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]*NeoCheck{txHash: check}, checkMap)
+
+	// written before NEO_CHECK_VERSION_1
+	legacy := &NeoCheck{Method: "syncBlockHeader", Retry: Retry{Height: 200}, SentAt: 1600000200}
+	sink := common.NewZeroCopySink(nil)
+	sink.WriteString(legacy.Method)
+	sink.WriteInt64(legacy.SentAt)
+	legacy.Retry.Serialization(sink)
+	assert.Nil(t, w.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(BKTNeoCheck).Put([]byte{0x0e, 0x0f}, sink.Bytes())
+	}))
+	checkMap, err = w.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, checkMap["0e0f"])
+	assert.Nil(t, w.DeleteNeoCheck("0e0f"))
+
+	assert.Nil(t, w.DeleteNeoCheck(txHash))
+	checkMap, err = w.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checkMap)
+}
+
+func TestBoltDB_Utxo(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	// written before UTXO_RESERVED, the value is a flag of spent
+	legacy := &NeoUtxo{TxId: "0a0b", Index: 1}
+	sink := common.NewZeroCopySink(nil)
+	legacy.Serialization(sink)
+	assert.Nil(t, w.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(BKTUtxo).Put(sink.Bytes(), []byte{UTXO_SPENT})
+	}))
+	state, err := w.GetUtxo(legacy)
+	assert.Nil(t, err)
+	assert.Equal(t, &UtxoState{Spent: true}, state)
+
+	utxo := &NeoUtxo{TxId: "0c0d", Index: 0}
+	state, err = w.GetUtxo(utxo)
+	assert.Nil(t, err)
+	assert.Nil(t, state)
+	reserved := &UtxoState{Spent: true, TxHash: "0e0f", ReservedAt: 1600000000}
+	assert.Nil(t, w.PutUtxo(utxo, reserved))
+	assert.Nil(t, w.PutUtxo(legacy, &UtxoState{}))
+	utxoMap, err := w.GetAllUtxo()
+	assert.Nil(t, err)
+	assert.Equal(t, map[NeoUtxo]*UtxoState{*legacy: {}, *utxo: reserved}, utxoMap)
+
+	assert.Nil(t, w.DeleteUtxo(legacy))
+	state, err = w.GetUtxo(legacy)
+	assert.Nil(t, err)
+	assert.Nil(t, state)
+}
+
+func TestBoltDB_NeoChange(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	utxo := &NeoUtxo{TxId: "0a0b", Index: 1}
+	change := &NeoChange{Value: 100000000, SentAt: 1600000000}
+	assert.Nil(t, w.PutNeoChange(utxo, change))
+	changeMap, err := w.GetAllNeoChange()
+	assert.Nil(t, err)
+	assert.Equal(t, map[NeoUtxo]*NeoChange{*utxo: change}, changeMap)
+
+	assert.Nil(t, w.DeleteNeoChange(utxo))
+	changeMap, err = w.GetAllNeoChange()
+	assert.Nil(t, err)
+	assert.Empty(t, changeMap)
+}
+
+func TestBoltDB_NeoFee(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	assert.Equal(t, int64(0), w.GetNeoFee("2020-01-01"))
+	sum, err := w.AddNeoFee("2020-01-01", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), sum)
+	sum, err = w.AddNeoFee("2020-01-01", 50)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(150), sum)
+	assert.Equal(t, int64(150), w.GetNeoFee("2020-01-01"))
+	assert.Equal(t, int64(0), w.GetNeoFee("2020-01-02"))
+}
+
+func TestBoltDB_NeoHash(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	assert.Equal(t, "", w.GetNeoHash(1))
+	for height := uint32(1); height <= 5; height++ {
+		assert.Nil(t, w.PutNeoHash(height, hex.EncodeToString([]byte{byte(height)}), 3))
+	}
+	// the hashes more than 3 blocks below the last one are forgotten
+	assert.Equal(t, "", w.GetNeoHash(1))
+	assert.Equal(t, "02", w.GetNeoHash(2))
+	assert.Equal(t, "05", w.GetNeoHash(5))
+
+	assert.Nil(t, w.DeleteNeoHashFrom(4))
+	assert.Equal(t, "03", w.GetNeoHash(3))
+	assert.Equal(t, "", w.GetNeoHash(4))
+	assert.Equal(t, "", w.GetNeoHash(5))
+	count, err := w.Count(BKTNeoHash)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestBoltDB_Transfer(t *testing.T) {
+	w, clean := newTestDB(t)
+	defer clean()
+
+	transfer := &Transfer{
+		Height:       10,
+		Key:          "0102",
+		PolyTxHash:   "aa",
+		FromChainID:  2,
+		FromContract: "bb",
+		ToContract:   "cc",
+		AssetHash:    "dd",
+		ToAddress:    "AKkkumHbBipZ46UMZJoFynJMXzSRnBvKcs",
+		Amount:       "100",
+		Status:       TRANSFER_QUARANTINED,
+		Reason:       "amount 0 is not positive",
+		UpdatedAt:    1600000000,
+	}
+	assert.Nil(t, w.PutTransfer(transfer))
+	got, err := w.GetTransfer(NewRetry(10, "0102").Id())
+	assert.Nil(t, err)
+	assert.Equal(t, transfer, got)
+
+	got, err = w.GetTransfer(NewRetry(11, "0102").Id())
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+
+	transfer.Status, transfer.NeoTxHash = TRANSFER_SENT, "ee"
+	assert.Nil(t, w.PutTransfer(transfer))
+	transfers, err := w.GetAllTransfer()
+	assert.Nil(t, err)
+	assert.Equal(t, []*Transfer{transfer}, transfers)
+}
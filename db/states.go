@@ -3,16 +3,54 @@ package db
 import (
 	"fmt"
 	"github.com/polynetwork/poly/common"
+	"time"
+)
+
+const (
+	// RETRY_VERSION_1 adds the retry state after Height and Key, entries written before it end right after Key
+	RETRY_VERSION_1 byte = 1
+	// NEO_CHECK_VERSION_1 adds the replacement state after Retry, entries written before it end right after Retry
+	NEO_CHECK_VERSION_1 byte = 1
 )
 
 type Retry struct {
 	Height uint32
 	Key    string
+
+	// since RETRY_VERSION_1
+	Attempts    uint32
+	LastError   string
+	FirstSeen   int64 // unix time
+	NextAttempt int64 // unix time, not retried before it
+}
+
+// NewRetry creates a retry which is due now
+func NewRetry(height uint32, key string) *Retry {
+	now := time.Now().Unix()
+	return &Retry{
+		Height:      height,
+		Key:         key,
+		FirstSeen:   now,
+		NextAttempt: now,
+	}
+}
+
+// Id is the unversioned serialization of Height and Key, used as the key in db
+func (this *Retry) Id() []byte {
+	sink := common.NewZeroCopySink(nil)
+	sink.WriteUint32(this.Height)
+	sink.WriteString(this.Key)
+	return sink.Bytes()
 }
 
 func (this *Retry) Serialization(sink *common.ZeroCopySink) {
 	sink.WriteUint32(this.Height)
 	sink.WriteString(this.Key)
+	sink.WriteByte(RETRY_VERSION_1)
+	sink.WriteUint32(this.Attempts)
+	sink.WriteString(this.LastError)
+	sink.WriteInt64(this.FirstSeen)
+	sink.WriteInt64(this.NextAttempt)
 }
 
 func (this *Retry) Deserialization(source *common.ZeroCopySource) error {
@@ -27,6 +65,200 @@ func (this *Retry) Deserialization(source *common.ZeroCopySource) error {
 
 	this.Height = height
 	this.Key = key
+	if source.Len() == 0 {
+		// written before RETRY_VERSION_1
+		return nil
+	}
+
+	version, eof := source.NextByte()
+	if eof {
+		return fmt.Errorf("waiting deserialize version error")
+	}
+	if version != RETRY_VERSION_1 {
+		return fmt.Errorf("unknown retry version %d", version)
+	}
+	attempts, eof := source.NextUint32()
+	if eof {
+		return fmt.Errorf("waiting deserialize attempts error")
+	}
+	lastError, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize last error error")
+	}
+	firstSeen, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize first seen error")
+	}
+	nextAttempt, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize next attempt error")
+	}
+
+	this.Attempts = attempts
+	this.LastError = lastError
+	this.FirstSeen = firstSeen
+	this.NextAttempt = nextAttempt
+	return nil
+}
+
+const (
+	UTXO_FREE     byte = 0x00
+	UTXO_SPENT    byte = 0x01 // spent by an unknown tx, written before UTXO_RESERVED
+	UTXO_RESERVED byte = 0x02
+)
+
+// UtxoState is whether a utxo of the relayer is reserved by a tx spending it, which may not be in a block yet
+type UtxoState struct {
+	Spent      bool
+	TxHash     string // empty if the utxo was spent before UTXO_RESERVED
+	ReservedAt int64  // unix time, the time it is loaded at if the utxo was spent before UTXO_RESERVED
+}
+
+func (this *UtxoState) Serialization(sink *common.ZeroCopySink) {
+	if !this.Spent {
+		sink.WriteByte(UTXO_FREE)
+		return
+	}
+	sink.WriteByte(UTXO_RESERVED)
+	sink.WriteString(this.TxHash)
+	sink.WriteInt64(this.ReservedAt)
+}
+
+func (this *UtxoState) Deserialization(source *common.ZeroCopySource) error {
+	state, eof := source.NextByte()
+	if eof {
+		return fmt.Errorf("waiting deserialize state error")
+	}
+	switch state {
+	case UTXO_FREE:
+		*this = UtxoState{}
+	case UTXO_SPENT:
+		*this = UtxoState{Spent: true}
+	case UTXO_RESERVED:
+		txHash, eof := source.NextString()
+		if eof {
+			return fmt.Errorf("waiting deserialize tx hash error")
+		}
+		reservedAt, eof := source.NextInt64()
+		if eof {
+			return fmt.Errorf("waiting deserialize reserved at error")
+		}
+		*this = UtxoState{Spent: true, TxHash: txHash, ReservedAt: reservedAt}
+	default:
+		return fmt.Errorf("unknown utxo state %d", state)
+	}
+	return nil
+}
+
+// NeoChange is a gas output of a tx sent by the relayer which is not in a block yet, spendable by the next txs
+type NeoChange struct {
+	Value  int64 // Fixed8 value
+	SentAt int64 // unix time
+}
+
+func (this *NeoChange) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteInt64(this.Value)
+	sink.WriteInt64(this.SentAt)
+}
+
+func (this *NeoChange) Deserialization(source *common.ZeroCopySource) error {
+	value, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize value error")
+	}
+	sentAt, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize sent at error")
+	}
+
+	this.Value = value
+	this.SentAt = sentAt
+	return nil
+}
+
+// NeoCheck is a tx sent to neo and waiting to be found in a block
+type NeoCheck struct {
+	Method string // method of the neo ccmc invoked by the tx
+	Retry  Retry  // the cross chain tx for VerifyAndExecuteTx, only Height is set for the txs syncing poly headers
+	SentAt int64  // unix time
+
+	// since NEO_CHECK_VERSION_1
+	SentHeight uint32   // neo height when the tx is first checked, 0 before
+	Fee        int64    // system and network fee paid by the tx, in Fixed8 value
+	RawTx      string   // signed tx in hex, the tx is rebuilt from it when it is replaced
+	Replaced   []string // hashes of the earlier txs spending the same inputs, which are replaced by the tx
+}
+
+func (this *NeoCheck) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteString(this.Method)
+	sink.WriteInt64(this.SentAt)
+	this.Retry.Serialization(sink)
+	sink.WriteByte(NEO_CHECK_VERSION_1)
+	sink.WriteUint32(this.SentHeight)
+	sink.WriteInt64(this.Fee)
+	sink.WriteString(this.RawTx)
+	sink.WriteUint32(uint32(len(this.Replaced)))
+	for _, txHash := range this.Replaced {
+		sink.WriteString(txHash)
+	}
+}
+
+func (this *NeoCheck) Deserialization(source *common.ZeroCopySource) error {
+	method, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize method error")
+	}
+	sentAt, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize sent at error")
+	}
+	if err := this.Retry.Deserialization(source); err != nil {
+		return err
+	}
+
+	this.Method = method
+	this.SentAt = sentAt
+	if source.Len() == 0 {
+		// written before NEO_CHECK_VERSION_1
+		return nil
+	}
+
+	version, eof := source.NextByte()
+	if eof {
+		return fmt.Errorf("waiting deserialize version error")
+	}
+	if version != NEO_CHECK_VERSION_1 {
+		return fmt.Errorf("unknown neo check version %d", version)
+	}
+	sentHeight, eof := source.NextUint32()
+	if eof {
+		return fmt.Errorf("waiting deserialize sent height error")
+	}
+	fee, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize fee error")
+	}
+	rawTx, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize raw tx error")
+	}
+	count, eof := source.NextUint32()
+	if eof {
+		return fmt.Errorf("waiting deserialize replaced count error")
+	}
+	var replaced []string
+	for i := uint32(0); i < count; i++ {
+		txHash, eof := source.NextString()
+		if eof {
+			return fmt.Errorf("waiting deserialize replaced tx hash error")
+		}
+		replaced = append(replaced, txHash)
+	}
+
+	this.SentHeight = sentHeight
+	this.Fee = fee
+	this.RawTx = rawTx
+	this.Replaced = replaced
 	return nil
 }
 
@@ -55,3 +287,117 @@ func (this *NeoUtxo) Deserialization(source *common.ZeroCopySource) error {
 	this.Index = int(index)
 	return nil
 }
+
+const (
+	TRANSFER_DECODED     byte = 0x00 // the unlock args are decoded, the tx is not sent yet
+	TRANSFER_SENT        byte = 0x01
+	TRANSFER_QUARANTINED byte = 0x02 // the unlock args can not be decoded or are invalid, the tx is not sent
+)
+
+// Transfer is the record of a poly to neo transfer decoded from its proof, keyed by the Retry.Id of the proof
+type Transfer struct {
+	Height       uint32 // poly height of the cross chain tx
+	Key          string // key of the makeProof event
+	PolyTxHash   string
+	FromChainID  uint64
+	FromContract string
+	ToContract   string
+	AssetHash    string // script hash of the asset on neo, big endian hex
+	ToAddress    string // neo address of the receiver
+	Amount       string // decimal, in the smallest unit of the asset
+	Status       byte
+	Reason       string // why the transfer is quarantined
+	NeoTxHash    string // the last tx sent to neo
+	UpdatedAt    int64  // unix time
+}
+
+// Id is the Retry.Id of the proof of the transfer
+func (this *Transfer) Id() []byte {
+	return (&Retry{Height: this.Height, Key: this.Key}).Id()
+}
+
+func (this *Transfer) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteUint32(this.Height)
+	sink.WriteString(this.Key)
+	sink.WriteString(this.PolyTxHash)
+	sink.WriteUint64(this.FromChainID)
+	sink.WriteString(this.FromContract)
+	sink.WriteString(this.ToContract)
+	sink.WriteString(this.AssetHash)
+	sink.WriteString(this.ToAddress)
+	sink.WriteString(this.Amount)
+	sink.WriteByte(this.Status)
+	sink.WriteString(this.Reason)
+	sink.WriteString(this.NeoTxHash)
+	sink.WriteInt64(this.UpdatedAt)
+}
+
+func (this *Transfer) Deserialization(source *common.ZeroCopySource) error {
+	height, eof := source.NextUint32()
+	if eof {
+		return fmt.Errorf("waiting deserialize height error")
+	}
+	key, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize key error")
+	}
+	polyTxHash, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize poly tx hash error")
+	}
+	fromChainID, eof := source.NextUint64()
+	if eof {
+		return fmt.Errorf("waiting deserialize from chain id error")
+	}
+	fromContract, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize from contract error")
+	}
+	toContract, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize to contract error")
+	}
+	assetHash, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize asset hash error")
+	}
+	toAddress, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize to address error")
+	}
+	amount, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize amount error")
+	}
+	status, eof := source.NextByte()
+	if eof {
+		return fmt.Errorf("waiting deserialize status error")
+	}
+	reason, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize reason error")
+	}
+	neoTxHash, eof := source.NextString()
+	if eof {
+		return fmt.Errorf("waiting deserialize neo tx hash error")
+	}
+	updatedAt, eof := source.NextInt64()
+	if eof {
+		return fmt.Errorf("waiting deserialize updated at error")
+	}
+
+	this.Height = height
+	this.Key = key
+	this.PolyTxHash = polyTxHash
+	this.FromChainID = fromChainID
+	this.FromContract = fromContract
+	this.ToContract = toContract
+	this.AssetHash = assetHash
+	this.ToAddress = toAddress
+	this.Amount = amount
+	this.Status = status
+	this.Reason = reason
+	this.NeoTxHash = neoTxHash
+	this.UpdatedAt = updatedAt
+	return nil
+}
@@ -11,6 +11,7 @@ require (
 	github.com/ontio/ontology-crypto v1.0.9
 	github.com/polynetwork/poly v0.0.0-20210112063446-24e3d053e9d6
 	github.com/polynetwork/poly-go-sdk v0.0.0-20210114120411-3dcba035134f
+	github.com/prometheus/client_golang v1.8.0
 	github.com/stretchr/testify v1.6.1
 	github.com/urfave/cli v1.22.4
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/joeqian10/neo-gogogo/rpc"
 	"github.com/joeqian10/neo-gogogo/wallet"
 	"github.com/polynetwork/poly/core/types"
 	"golang.org/x/crypto/ssh/terminal"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -16,12 +19,21 @@ import (
 	"github.com/polynetwork/neo-relayer/common"
 	"github.com/polynetwork/neo-relayer/config"
 	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+	"github.com/polynetwork/neo-relayer/notify"
 	"github.com/polynetwork/neo-relayer/service"
 
 	relaySdk "github.com/polynetwork/poly-go-sdk"
 	"github.com/urfave/cli"
 )
 
+// POLY_SETUP_TIMEOUT is how long a poly node is waited for its genesis header at startup
+const POLY_SETUP_TIMEOUT = 5 * time.Second
+
+// ADMIN_COMMAND is the help of the commands which need the db the running relayer holds
+const ADMIN_COMMAND = "When AdminAddress is set in the config and the relayer is running, the command is sent to its " +
+	"admin api. Otherwise it opens the db itself, which the running relayer locks, so the relayer must be stopped first."
+
 func setupApp() *cli.App {
 	app := cli.NewApp()
 	app.Usage = "NEO Relayer"
@@ -32,8 +44,52 @@ func setupApp() *cli.App {
 		cmd.ConfigPathFlag,
 		cmd.NeoPwd,
 		cmd.RelayPwd,
+		cmd.PolyStartHeightFlag,
+		cmd.NeoStartHeightFlag,
+		cmd.SkipPreflightFlag,
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:        "relay-to-poly",
+			Usage:       "Relay the cross chain txs in one NEO tx to Poly and exit",
+			Description: ADMIN_COMMAND,
+			Action:      relayToPoly,
+			Flags:       []cli.Flag{cmd.NeoTxFlag},
+		},
+		{
+			Name:        "relay-to-neo",
+			Usage:       "Relay one cross chain tx of Poly to NEO and exit",
+			Description: ADMIN_COMMAND,
+			Action:      relayToNeo,
+			Flags:       []cli.Flag{cmd.PolyHeightFlag, cmd.KeyFlag},
+		},
+		{
+			Name:  "utxo",
+			Usage: "Manage the GAS utxos of the NEO relayer account",
+			Subcommands: []cli.Command{
+				{
+					Name:        "list",
+					Usage:       "List the GAS utxos and the ones reserved by txs not in a block yet",
+					Description: ADMIN_COMMAND,
+					Action:      listUtxos,
+				},
+				{
+					Name:        "consolidate",
+					Usage:       "Move the GAS utxos smaller than dust into one",
+					Description: ADMIN_COMMAND,
+					Action:      consolidateUtxos,
+					Flags:       []cli.Flag{cmd.UtxoDustFlag, cmd.UtxoMaxInputsFlag},
+				},
+				{
+					Name:        "split",
+					Usage:       "Split count GAS utxos of size out of the balance for concurrent relays",
+					Description: ADMIN_COMMAND,
+					Action:      splitUtxos,
+					Flags:       []cli.Flag{cmd.UtxoCountFlag, cmd.UtxoSizeFlag},
+				},
+			},
+		},
 	}
-	app.Commands = []cli.Command{}
 	app.Before = func(context *cli.Context) error {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 		return nil
@@ -49,42 +105,298 @@ func main() {
 }
 
 func startSync(ctx *cli.Context) {
+	syncService, err := setupSyncService(ctx)
+	if err != nil {
+		log.Errorf("[NEO Relayer] %s", err)
+		return
+	}
+
+	if ctx.GlobalIsSet(cmd.GetFlagName(cmd.PolyStartHeightFlag)) {
+		config.DefConfig.PolyStartHeight = uint32(ctx.GlobalUint(cmd.GetFlagName(cmd.PolyStartHeightFlag)))
+		config.DefConfig.ForcePolyStartHeight = true
+	}
+	if ctx.GlobalIsSet(cmd.GetFlagName(cmd.NeoStartHeightFlag)) {
+		config.DefConfig.NeoStartHeight = uint32(ctx.GlobalUint(cmd.GetFlagName(cmd.NeoStartHeightFlag)))
+		config.DefConfig.ForceNeoStartHeight = true
+	}
+
+	if config.DefConfig.MetricsAddress != "" {
+		metrics.Start(config.DefConfig.MetricsAddress)
+	}
+
+	var dispatcher *notify.Dispatcher
+	if len(config.DefConfig.Notifiers) > 0 {
+		notifiers, err := notify.NewNotifiers(config.DefConfig.Notifiers)
+		if err != nil {
+			log.Errorf("[NEO Relayer] notify.NewNotifiers error: %s", err)
+			syncService.Stop()
+			return
+		}
+		window := config.DefConfig.AlertDedupWindow
+		if window == 0 {
+			window = config.DEFAULT_ALERT_DEDUPE
+		}
+		rate := config.DefConfig.AlertRateLimit
+		if rate == 0 {
+			rate = config.DEFAULT_ALERT_RATE
+		}
+		dispatcher = notify.NewDispatcher(notifiers, time.Duration(window)*time.Second, int(rate))
+		syncService.SetAlertHook(dispatcher.Notify)
+	}
+
+	if !ctx.GlobalBool(cmd.GetFlagName(cmd.SkipPreflightFlag)) {
+		if err := syncService.Preflight(); err != nil {
+			log.Errorf("[NEO Relayer] %s, fix the start height or use flag %s", err, cmd.GetFlagName(cmd.SkipPreflightFlag))
+			syncService.Stop()
+			if dispatcher != nil {
+				dispatcher.Close()
+			}
+			return
+		}
+	}
+
+	if config.DefConfig.AdminAddress != "" {
+		if err := syncService.StartAdmin(config.DefConfig.AdminAddress); err != nil {
+			log.Errorf("[NEO Relayer] %s", err)
+			syncService.Stop()
+			if dispatcher != nil {
+				dispatcher.Close()
+			}
+			return
+		}
+	}
+
+	//Start syncing
+	syncService.Run(context.Background())
+
+	waitToExit()
+	if !stopSync(syncService) {
+		// the loops still running may alert, so the dispatcher is left open
+		os.Exit(1)
+	}
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+}
+
+// relayToPoly relays the cross chain txs in one neo tx and exits
+func relayToPoly(ctx *cli.Context) error {
+	txId := ctx.String(cmd.GetFlagName(cmd.NeoTxFlag))
+	if txId == "" {
+		return fmt.Errorf("flag %s is required", cmd.GetFlagName(cmd.NeoTxFlag))
+	}
+	if sent, err := adminCall(ctx, http.MethodPost, "relay/ntor", &service.RelayRequest{TxId: txId}, nil); sent || err != nil {
+		return err
+	}
+	syncService, err := setupSyncService(ctx)
+	if err != nil {
+		return err
+	}
+	defer syncService.Stop()
+	return syncService.RelayNeoTx(txId)
+}
+
+// relayToNeo relays one cross chain tx of poly and exits
+func relayToNeo(ctx *cli.Context) error {
+	key := ctx.String(cmd.GetFlagName(cmd.KeyFlag))
+	if !ctx.IsSet(cmd.GetFlagName(cmd.PolyHeightFlag)) || key == "" {
+		return fmt.Errorf("flag %s and %s are required", cmd.GetFlagName(cmd.PolyHeightFlag), cmd.GetFlagName(cmd.KeyFlag))
+	}
+	height := uint32(ctx.Uint(cmd.GetFlagName(cmd.PolyHeightFlag)))
+	req := &service.RelayRequest{Height: height, Key: key}
+	if sent, err := adminCall(ctx, http.MethodPost, "relay/rton", req, nil); sent || err != nil {
+		return err
+	}
+	syncService, err := setupSyncService(ctx)
+	if err != nil {
+		return err
+	}
+	defer syncService.Stop()
+	return syncService.RelayPolyTx(height, key)
+}
+
+// listUtxos prints the gas utxos of the neo account
+func listUtxos(ctx *cli.Context) error {
+	var entries []*service.UtxoEntry
+	sent, err := adminCall(ctx, http.MethodGet, "utxo", nil, &entries)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		syncService, err := setupSyncService(ctx)
+		if err != nil {
+			return err
+		}
+		defer syncService.Stop()
+		entries, err = syncService.ListUtxos()
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		state := "free"
+		if entry.SpentBy != "" {
+			state = "reserved by " + entry.SpentBy
+		}
+		if entry.Change {
+			state += ", not in a block"
+		}
+		fmt.Printf("%s:%d\t%.8f\t%s\n", entry.TxId, entry.Index, entry.Value, state)
+	}
+	return nil
+}
+
+// consolidateUtxos moves the gas dust of the neo account into one utxo and exits
+func consolidateUtxos(ctx *cli.Context) error {
+	dust := ctx.Float64(cmd.GetFlagName(cmd.UtxoDustFlag))
+	if dust <= 0 {
+		return fmt.Errorf("flag %s is required", cmd.GetFlagName(cmd.UtxoDustFlag))
+	}
+	maxInputs := int(ctx.Uint(cmd.GetFlagName(cmd.UtxoMaxInputsFlag)))
+	result := new(service.UtxoResult)
+	sent, err := adminCall(ctx, http.MethodPost, "utxo/consolidate", &service.UtxoRequest{Dust: dust, MaxInputs: maxInputs}, result)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		syncService, err := setupSyncService(ctx)
+		if err != nil {
+			return err
+		}
+		defer syncService.Stop()
+		result.TxHash, err = syncService.ConsolidateUtxos(dust, maxInputs)
+		if err != nil {
+			return err
+		}
+	}
+	if result.TxHash == "" {
+		fmt.Println("less than two utxos to consolidate")
+		return nil
+	}
+	fmt.Printf("consolidated in tx %s\n", result.TxHash)
+	return nil
+}
+
+// splitUtxos splits the gas of the neo account into utxos of the same size and exits
+func splitUtxos(ctx *cli.Context) error {
+	count := int(ctx.Uint(cmd.GetFlagName(cmd.UtxoCountFlag)))
+	size := ctx.Float64(cmd.GetFlagName(cmd.UtxoSizeFlag))
+	if count <= 0 || size <= 0 {
+		return fmt.Errorf("flag %s and %s are required", cmd.GetFlagName(cmd.UtxoCountFlag), cmd.GetFlagName(cmd.UtxoSizeFlag))
+	}
+	result := new(service.UtxoResult)
+	sent, err := adminCall(ctx, http.MethodPost, "utxo/split", &service.UtxoRequest{Count: count, Size: size}, result)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		syncService, err := setupSyncService(ctx)
+		if err != nil {
+			return err
+		}
+		defer syncService.Stop()
+		result.TxHash, err = syncService.SplitUtxos(count, size)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("split in tx %s\n", result.TxHash)
+	return nil
+}
+
+// adminCall sends a command to the admin api of the relayer running with the config, which holds the db. It returns
+// false if AdminAddress is not set or no relayer listens on it, the command has to open the db itself then.
+func adminCall(ctx *cli.Context, method, path string, req, resp interface{}) (bool, error) {
+	configPath := ctx.GlobalString(cmd.GetFlagName(cmd.ConfigPathFlag))
+	if err := config.DefConfig.Init(configPath); err != nil {
+		return false, fmt.Errorf("DefConfig.Init error: %s", err)
+	}
+	if config.DefConfig.AdminAddress == "" {
+		return false, nil
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return false, fmt.Errorf("json.Marshal error: %s", err)
+	}
+	request, err := http.NewRequest(method, "http://"+config.DefConfig.AdminAddress+service.ADMIN_PREFIX+path, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("http.NewRequest error: %s", err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "no relayer serves the admin api on %s, the command runs on its own: %s\n", config.DefConfig.AdminAddress, err)
+		return false, nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		result := make(map[string]string)
+		json.NewDecoder(response.Body).Decode(&result)
+		return true, fmt.Errorf("admin api error: %s %s", response.Status, result["error"])
+	}
+	if resp != nil {
+		if err := json.NewDecoder(response.Body).Decode(resp); err != nil {
+			return true, fmt.Errorf("decode admin api response error: %s", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "done by the relayer serving the admin api on %s\n", config.DefConfig.AdminAddress)
+	return true, nil
+}
+
+// setupSyncService loads the config, opens both wallets and creates the sync service
+func setupSyncService(ctx *cli.Context) (*service.SyncService, error) {
 	logLevel := ctx.GlobalInt(cmd.GetFlagName(cmd.LogLevelFlag))
 	log.InitLog(logLevel, log.PATH, log.Stdout)
 	//log.InitErrorCaseLogger(logLevel, log.ErrorCasePath, log.Stdout)
-	configPath := ctx.String(cmd.GetFlagName(cmd.ConfigPathFlag))
+	configPath := ctx.GlobalString(cmd.GetFlagName(cmd.ConfigPathFlag))
 	err := config.DefConfig.Init(configPath)
 	if err != nil {
-		fmt.Println("DefConfig.Init error: ", err)
-		return
+		return nil, fmt.Errorf("DefConfig.Init error: %s", err)
 	}
 
 	neoPwd := ctx.GlobalString(cmd.GetFlagName(cmd.NeoPwd))
 	relayPwd := ctx.GlobalString(cmd.GetFlagName(cmd.RelayPwd))
 
-	//create Relay Chain RPC Client
-	relaySdk := relaySdk.NewPolySdk()
-	err = SetUpPoly(relaySdk, config.DefConfig.RelayJsonRpcUrl)
+	//create Relay Chain RPC Clients
+	relayUrls, relaySdks, reached := setUpPolys(config.DefConfig.RelayRpcUrls())
+	var reachedUrls []string
+	var relayClients []service.PolyClient
+	for i, sdk := range relaySdks {
+		if reached[i] {
+			reachedUrls = append(reachedUrls, relayUrls[i])
+			relayClients = append(relayClients, service.NewPolyClient(sdk))
+		}
+	}
+	if len(relayClients) == 0 {
+		return nil, fmt.Errorf("failed to set up poly: no poly node reached")
+	}
+	relayPool, err := service.NewPolyPool(reachedUrls, relayClients, config.DefConfig.RelayMaxLag)
 	if err != nil {
-		panic(fmt.Errorf("failed to set up poly: %v", err))
+		return nil, fmt.Errorf("failed to set up poly: %s", err)
+	}
+	for i, sdk := range relaySdks {
+		if !reached[i] {
+			relayPool.AddNode(relayUrls[i], service.NewPolyClient(sdk))
+		}
 	}
 
 	// Get wallet account from Relay Chain
-	account, ok := common.GetAccountByPassword(relaySdk, config.DefConfig.WalletFile, relayPwd)
+	account, ok := common.GetAccountByPassword(relaySdks[0], config.DefConfig.WalletFile, relayPwd)
 	if !ok {
-		log.Errorf("[NEO Relayer] common.GetAccountByPassword error")
-		return
+		return nil, fmt.Errorf("common.GetAccountByPassword error")
 	}
 
 	// create an NEO RPC client
-	neoRpcClient := rpc.NewClient(config.DefConfig.NeoJsonRpcUrl)
+	neoUrls := config.DefConfig.NeoRpcUrls()
+	if len(neoUrls) == 0 {
+		return nil, fmt.Errorf("no NEO rpc url configured")
+	}
+	neoRpcClient := service.NewNeoPool(neoUrls, config.DefConfig.NeoMaxLag)
 
 	// open the NEO wallet
 	//neoAccount, err := wallet.NewAccountFromWIF(config.DefConfig.NeoWalletWIF)
 	w, err := wallet.NewWalletFromFile(config.DefConfig.NeoWalletFile)
 	if err != nil {
-		log.Errorf("[NEO Relayer] Failed to open NEO wallet")
-		return
+		return nil, fmt.Errorf("Failed to open NEO wallet")
 	}
 
 	if neoPwd == "" {
@@ -99,16 +411,33 @@ func startSync(ctx *cli.Context) {
 	}
 	err = w.DecryptAll(neoPwd)
 	if err != nil {
-		log.Errorf("[NEO Relayer] Failed to decrypt NEO account")
-		return
+		return nil, fmt.Errorf("Failed to decrypt NEO account")
 	}
 	neoAccount := w.Accounts[0]
 
-	//Start syncing
-	syncService := service.NewSyncService(account, relaySdk, neoAccount, neoRpcClient)
-	syncService.Run()
+	return service.NewSyncService(account, relayPool, neoAccount, neoRpcClient), nil
+}
 
-	waitToExit()
+// stopSync waits for the sync service to drain, and returns false if it does not make it in time
+func stopSync(syncService *service.SyncService) bool {
+	timeout := config.DefConfig.ShutdownTimeout
+	if timeout == 0 {
+		timeout = config.DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	done := make(chan struct{})
+	go func() {
+		syncService.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Infof("Neo Relayer exited.")
+		return true
+	case <-time.After(time.Duration(timeout) * time.Second):
+		log.Errorf("Neo Relayer failed to stop in %d seconds, force to exit.", timeout)
+		return false
+	}
 }
 
 func waitToExit() {
@@ -125,6 +454,22 @@ func waitToExit() {
 	<-exit
 }
 
+// setUpPolys sets up an sdk for each poly node at urls, and reports whether the node is reached. The chain id of a
+// node which can not be reached is not set, it is checked by the pool once the node answers.
+func setUpPolys(urls []string) ([]string, []*relaySdk.PolySdk, []bool) {
+	sdks := make([]*relaySdk.PolySdk, len(urls))
+	reached := make([]bool, len(urls))
+	for i, url := range urls {
+		sdks[i] = relaySdk.NewPolySdk()
+		if err := SetUpPoly(sdks[i], url); err != nil {
+			log.Errorf("[setUpPolys] failed to set up poly node %s: %s, it is not used until it answers", url, err)
+			continue
+		}
+		reached[i] = true
+	}
+	return urls, sdks, reached
+}
+
 func SetUpPoly(poly *relaySdk.PolySdk, rpcAddr string) error {
 	poly.NewRpcClient().SetAddress(rpcAddr)
 	c1 := make(chan *types.Header, 1)
@@ -135,6 +480,7 @@ func SetUpPoly(poly *relaySdk.PolySdk, rpcAddr string) error {
 		hdr, err := poly.GetHeaderByHeight(0)
 		if err != nil {
 			c2 <- err
+			return
 		}
 		c1 <- hdr
 	}()
@@ -144,7 +490,7 @@ func SetUpPoly(poly *relaySdk.PolySdk, rpcAddr string) error {
 		poly.SetChainId(hdr.ChainID)
 	case err := <- c2:
 		return  err
-	case <- time.After(time.Second * 5):
+	case <- time.After(POLY_SETUP_TIMEOUT):
 		return fmt.Errorf("poly rpc port timeout")
 	}
 
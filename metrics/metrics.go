@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	NAMESPACE = "neo_relayer"
+
+	NEO_TO_RELAY = "neo_to_relay"
+	RELAY_TO_NEO = "relay_to_neo"
+
+	CHAIN_NEO   = "neo"
+	CHAIN_RELAY = "relay"
+
+	SUCCESS = "success"
+	FAILURE = "failure"
+)
+
+var (
+	// ScanHeight is the next height to be scanned of each direction
+	ScanHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "scan_height",
+		Help:      "Next block height to be scanned, by direction.",
+	}, []string{"direction"})
+
+	// ChainHeight is the current tip of each chain
+	ChainHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "chain_height",
+		Help:      "Current block height of the chain.",
+	}, []string{"chain"})
+
+	// BucketSize is the number of entries in a db bucket
+	BucketSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "bucket_size",
+		Help:      "Number of entries in the bolt db bucket.",
+	}, []string{"bucket"})
+
+	// Calls counts the relay methods by outcome
+	Calls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "calls_total",
+		Help:      "Number of relay method calls, by method and outcome.",
+	}, []string{"method", "outcome"})
+
+	// ContractTxs counts the cross chain txs relayed for each contract monitored
+	ContractTxs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "contract_txs_total",
+		Help:      "Number of cross chain txs relayed, by direction and contract.",
+	}, []string{"direction", "contract"})
+
+	// RpcLatency is the latency of rpc requests to both chains
+	RpcLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of rpc requests, by chain and method.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"chain", "method"})
+
+	// NodeHeight is the block height reported by each rpc node
+	NodeHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "node_height",
+		Help:      "Block height reported by the rpc node, by chain and url.",
+	}, []string{"chain", "url"})
+
+	// NodeUp is 1 for the rpc nodes which are used, 0 for the ones down or behind
+	NodeUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "node_up",
+		Help:      "Whether the rpc node is reachable and in sync, by chain and url.",
+	}, []string{"chain", "url"})
+
+	// GasBalance is the available GAS of the neo relayer account
+	GasBalance = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "neo_gas_balance",
+		Help:      "Available GAS of the neo relayer account.",
+	})
+
+	// NeoFeeSpent is the GAS spent by the txs sent to neo today, counted by the fee budget
+	NeoFeeSpent = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "neo_fee_spent",
+		Help:      "GAS spent by the txs sent to neo today (UTC).",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(ScanHeight, ChainHeight, BucketSize, Calls, ContractTxs, RpcLatency, NodeHeight, NodeUp, GasBalance, NeoFeeSpent)
+}
+
+// Start serves the metrics on addr in a new goroutine
+func Start(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Infof("[metrics] listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("[metrics] ListenAndServe error: %s", err)
+		}
+	}()
+}
+
+// ObserveCall counts one call of method, failed if err is not nil
+func ObserveCall(method string, err error) {
+	if err != nil {
+		Calls.WithLabelValues(method, FAILURE).Inc()
+		return
+	}
+	Calls.WithLabelValues(method, SUCCESS).Inc()
+}
+
+// ObserveRpc records the latency of an rpc request started at start
+func ObserveRpc(chain, method string, start time.Time) {
+	RpcLatency.WithLabelValues(chain, method).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/config"
+)
+
+const (
+	TYPE_WEBHOOK = "webhook"
+	TYPE_SLACK   = "slack"
+	TYPE_EXEC    = "exec"
+
+	TIMEOUT = 10 * time.Second
+)
+
+// NewNotifiers makes the notifiers of cfgs
+func NewNotifiers(cfgs []*config.NotifierConfig) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		switch cfg.Type {
+		case TYPE_WEBHOOK:
+			if cfg.Url == "" {
+				return nil, fmt.Errorf("url of %s notifier is empty", cfg.Type)
+			}
+			notifiers = append(notifiers, NewWebhook(cfg.Url))
+		case TYPE_SLACK:
+			if cfg.Url == "" {
+				return nil, fmt.Errorf("url of %s notifier is empty", cfg.Type)
+			}
+			notifiers = append(notifiers, NewSlack(cfg.Url))
+		case TYPE_EXEC:
+			if cfg.Command == "" {
+				return nil, fmt.Errorf("command of %s notifier is empty", cfg.Type)
+			}
+			notifiers = append(notifiers, NewExec(cfg.Command, cfg.Args))
+		default:
+			return nil, fmt.Errorf("unknown notifier type: %s", cfg.Type)
+		}
+	}
+	return notifiers, nil
+}
+
+// Webhook posts the alerts as json to Url
+type Webhook struct {
+	Url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{Url: url, client: &http.Client{Timeout: TIMEOUT}}
+}
+
+func (this *Webhook) Notify(alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return post(this.client, this.Url, body)
+}
+
+// Slack posts the alerts to a slack compatible incoming webhook at Url
+type Slack struct {
+	Url    string
+	client *http.Client
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{Url: url, client: &http.Client{Timeout: TIMEOUT}}
+}
+
+func (this *Slack) Notify(alert *Alert) error {
+	body, err := json.Marshal(map[string]string{"text": SlackText(alert)})
+	if err != nil {
+		return err
+	}
+	return post(this.client, this.Url, body)
+}
+
+// SlackText formats alert as a slack message
+func SlackText(alert *Alert) string {
+	icon := ":warning:"
+	switch alert.Level {
+	case CRITICAL:
+		icon = ":rotating_light:"
+	case RESOLVED:
+		icon = ":white_check_mark:"
+	}
+	return fmt.Sprintf("%s *neo-relayer %s* `%s`\n%s", icon, alert.Level, alert.Event, alert.Message)
+}
+
+// Exec runs Command with Args for every alert. The alert is written to its stdin as json, and set in the
+// environment as NEO_RELAYER_ALERT_LEVEL, NEO_RELAYER_ALERT_EVENT, NEO_RELAYER_ALERT_MESSAGE and
+// NEO_RELAYER_ALERT_TIME.
+type Exec struct {
+	Command string
+	Args    []string
+}
+
+func NewExec(command string, args []string) *Exec {
+	return &Exec{Command: command, Args: args}
+}
+
+func (this *Exec) Notify(alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, this.Command, this.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"NEO_RELAYER_ALERT_LEVEL="+alert.Level,
+		"NEO_RELAYER_ALERT_EVENT="+alert.Event,
+		"NEO_RELAYER_ALERT_MESSAGE="+alert.Message,
+		"NEO_RELAYER_ALERT_TIME="+strconv.FormatInt(alert.Time, 10),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s error: %s, output: %s", this.Command, err, output)
+	}
+	return nil
+}
+
+func post(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("post %s: %s", url, resp.Status)
+	}
+	return nil
+}
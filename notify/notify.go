@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+const (
+	WARN     = "warn"
+	CRITICAL = "critical"
+	RESOLVED = "resolved"
+
+	QUEUE_SIZE = 100
+)
+
+// Alert is an operational event which needs the attention of the operator
+type Alert struct {
+	Level   string `json:"level"` // WARN, CRITICAL or RESOLVED
+	Event   string `json:"event"`
+	Message string `json:"message"`
+	Time    int64  `json:"time"`
+}
+
+// Notifier sends alerts out of the relayer
+type Notifier interface {
+	Notify(alert *Alert) error
+}
+
+// Dispatcher sends the alerts to the notifiers in the background. An alert same as one sent in the dedupe window is
+// dropped, so are the alerts over the rate limit.
+type Dispatcher struct {
+	notifiers []Notifier
+	window    int64 // seconds
+	rate      int   // alerts per minute
+
+	lock    sync.Mutex
+	sent    map[string]int64 // key of the alert -> time it is sent
+	recent  []int64          // times of the alerts sent in the last minute
+	dropped int              // alerts dropped by the rate limit since the last one sent
+
+	queueLock sync.Mutex
+	closed    bool // alerts are dropped once the dispatcher is closed
+	queue     chan *Alert
+	done      chan struct{}
+}
+
+// NewDispatcher starts a dispatcher, which should be closed after the last alert
+func NewDispatcher(notifiers []Notifier, window time.Duration, rate int) *Dispatcher {
+	this := &Dispatcher{
+		notifiers: notifiers,
+		window:    int64(window / time.Second),
+		rate:      rate,
+		sent:      make(map[string]int64),
+		queue:     make(chan *Alert, QUEUE_SIZE),
+		done:      make(chan struct{}),
+	}
+	go this.run()
+	return this
+}
+
+// Notify queues alert to be sent if it is not a duplicate or over the rate limit, it does not block. The alert is
+// dropped if the dispatcher is closed.
+func (this *Dispatcher) Notify(alert *Alert) {
+	alert = this.admit(alert)
+	if alert == nil {
+		return
+	}
+	this.queueLock.Lock()
+	defer this.queueLock.Unlock()
+	if this.closed {
+		log.Warnf("[Dispatcher] closed, drop alert %s %s: %s", alert.Level, alert.Event, alert.Message)
+		return
+	}
+	select {
+	case this.queue <- alert:
+	default:
+		log.Warnf("[Dispatcher] queue is full, drop alert %s %s: %s", alert.Level, alert.Event, alert.Message)
+	}
+}
+
+// Close sends the alerts queued and stops the dispatcher, it can be called more than once
+func (this *Dispatcher) Close() {
+	this.queueLock.Lock()
+	if !this.closed {
+		this.closed = true
+		close(this.queue)
+	}
+	this.queueLock.Unlock()
+	<-this.done
+}
+
+// admit returns the alert to send, or nil if it is dropped. The number of alerts dropped by the rate limit is told
+// by the next one sent.
+func (this *Dispatcher) admit(alert *Alert) *Alert {
+	if alert.Time == 0 {
+		alert.Time = time.Now().Unix()
+	}
+	now := alert.Time
+	key := alert.Level + "|" + alert.Event + "|" + alert.Message
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for k, t := range this.sent {
+		if now-t >= this.window {
+			delete(this.sent, k)
+		}
+	}
+	if _, ok := this.sent[key]; ok {
+		log.Debugf("[Dispatcher] drop duplicate alert %s %s", alert.Level, alert.Event)
+		return nil
+	}
+	recent := this.recent[:0]
+	for _, t := range this.recent {
+		if now-t < 60 {
+			recent = append(recent, t)
+		}
+	}
+	this.recent = recent
+	if this.rate > 0 && len(this.recent) >= this.rate {
+		this.dropped++
+		log.Warnf("[Dispatcher] rate limited, drop alert %s %s: %s", alert.Level, alert.Event, alert.Message)
+		return nil
+	}
+
+	this.sent[key] = now
+	this.recent = append(this.recent, now)
+	if this.dropped > 0 {
+		copied := *alert
+		copied.Message = fmt.Sprintf("%s (%d alerts dropped by rate limit)", alert.Message, this.dropped)
+		alert = &copied
+		this.dropped = 0
+	}
+	return alert
+}
+
+func (this *Dispatcher) run() {
+	defer close(this.done)
+	for alert := range this.queue {
+		for _, notifier := range this.notifiers {
+			if err := notifier.Notify(alert); err != nil {
+				log.Errorf("[Dispatcher] %T notify error: %s, alert: %s %s", notifier, err, alert.Level, alert.Event)
+			}
+		}
+	}
+}
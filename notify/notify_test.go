@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	lock   sync.Mutex
+	alerts []*Alert
+}
+
+func (this *recorder) Notify(alert *Alert) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.alerts = append(this.alerts, alert)
+	return nil
+}
+
+func TestDispatcher_Dedupe(t *testing.T) {
+	r := &recorder{}
+	d := NewDispatcher([]Notifier{r}, 10*time.Second, 0)
+	d.Notify(&Alert{Level: CRITICAL, Event: "dead_letter", Message: "a", Time: 100})
+	d.Notify(&Alert{Level: CRITICAL, Event: "dead_letter", Message: "a", Time: 105})
+	d.Notify(&Alert{Level: CRITICAL, Event: "dead_letter", Message: "b", Time: 105})
+	d.Notify(&Alert{Level: RESOLVED, Event: "dead_letter", Message: "a", Time: 105})
+	d.Notify(&Alert{Level: CRITICAL, Event: "dead_letter", Message: "a", Time: 110})
+	d.Close()
+
+	assert.Equal(t, 4, len(r.alerts))
+	assert.Equal(t, "b", r.alerts[1].Message)
+	assert.Equal(t, RESOLVED, r.alerts[2].Level)
+	assert.Equal(t, int64(110), r.alerts[3].Time)
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	r := &recorder{}
+	d := NewDispatcher([]Notifier{r}, time.Second, 2)
+	for i, message := range []string{"a", "b", "c", "d"} {
+		d.Notify(&Alert{Level: WARN, Event: "e", Message: message, Time: 100 + int64(i)})
+	}
+	d.Notify(&Alert{Level: WARN, Event: "e", Message: "e", Time: 160})
+	d.Close()
+
+	assert.Equal(t, 3, len(r.alerts))
+	assert.Equal(t, "b", r.alerts[1].Message)
+	assert.Equal(t, "e (2 alerts dropped by rate limit)", r.alerts[2].Message)
+}
+
+func TestDispatcher_Closed(t *testing.T) {
+	r := &recorder{}
+	d := NewDispatcher([]Notifier{r}, time.Second, 0)
+	d.Notify(&Alert{Level: WARN, Event: "e", Message: "a", Time: 100})
+	d.Close()
+	d.Notify(&Alert{Level: WARN, Event: "e", Message: "b", Time: 100})
+	d.Close()
+
+	assert.Equal(t, 1, len(r.alerts))
+	assert.Equal(t, "a", r.alerts[0].Message)
+}
+
+func TestNotifiers(t *testing.T) {
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "neo-relayer-notify")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "alert")
+
+	notifiers, err := NewNotifiers([]*config.NotifierConfig{
+		{Type: TYPE_WEBHOOK, Url: server.URL},
+		{Type: TYPE_SLACK, Url: server.URL},
+		{Type: TYPE_EXEC, Command: "sh", Args: []string{"-c", "cat > " + out + "; echo $NEO_RELAYER_ALERT_EVENT >> " + out}},
+	})
+	assert.Nil(t, err)
+	alert := &Alert{Level: CRITICAL, Event: "key_header", Message: "sync key header error", Time: 100}
+	for _, notifier := range notifiers {
+		assert.Nil(t, notifier.Notify(alert))
+	}
+
+	assert.Equal(t, 2, len(bodies))
+	var posted Alert
+	assert.Nil(t, json.Unmarshal(bodies[0], &posted))
+	assert.Equal(t, *alert, posted)
+	var slack map[string]string
+	assert.Nil(t, json.Unmarshal(bodies[1], &slack))
+	assert.Equal(t, SlackText(alert), slack["text"])
+	written, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"level":"critical","event":"key_header","message":"sync key header error","time":100}key_header`+"\n", string(written))
+
+	_, err = NewNotifiers([]*config.NotifierConfig{{Type: "email"}})
+	assert.NotNil(t, err)
+	_, err = NewNotifiers([]*config.NotifierConfig{{Type: TYPE_WEBHOOK}})
+	assert.NotNil(t, err)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	assert.NotNil(t, NewWebhook(failing.URL).Notify(alert))
+}
@@ -0,0 +1,651 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+	pCommon "github.com/polynetwork/poly/common"
+)
+
+const (
+	ADMIN_PREFIX = "/api/v1/"
+
+	ADMIN_READ_TIMEOUT  = 10 * time.Second
+	ADMIN_WRITE_TIMEOUT = 3 * time.Minute // a relay or retry waits for the chains
+
+	NTOR = "ntor" // neo to relay, the Retry bucket
+	RTON = "rton" // relay to neo, the NeoRetry bucket
+)
+
+// RetryEntry is a decoded entry of the retry, dead letter or check buckets
+type RetryEntry struct {
+	Id          string `json:"id"` // hex of the db key, used to address the entry, the tx hash for check entries
+	Height      uint32 `json:"height"`
+	Key         string `json:"key"`
+	Attempts    uint32 `json:"attempts"`
+	LastError   string `json:"lastError,omitempty"`
+	FirstSeen   int64  `json:"firstSeen,omitempty"`
+	NextAttempt int64  `json:"nextAttempt,omitempty"`
+	TxHash      string `json:"txHash,omitempty"` // only for check entries, the poly tx waiting for confirmation
+	Error       string `json:"error,omitempty"`  // set when the db value can not be decoded
+}
+
+// TransferEntry is a decoded entry of the transfer bucket
+type TransferEntry struct {
+	Id           string `json:"id"` // hex of the db key, the same as the id of the retry of the transfer
+	Height       uint32 `json:"height"`
+	Key          string `json:"key"`
+	PolyTxHash   string `json:"polyTxHash"`
+	FromChainID  uint64 `json:"fromChainId"`
+	FromContract string `json:"fromContract"`
+	ToContract   string `json:"toContract"`
+	AssetHash    string `json:"assetHash,omitempty"`
+	ToAddress    string `json:"toAddress,omitempty"`
+	Amount       string `json:"amount,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	NeoTxHash    string `json:"neoTxHash,omitempty"`
+	UpdatedAt    int64  `json:"updatedAt"`
+}
+
+// RelayRequest is the cross chain tx the relay-to-poly and relay-to-neo commands ask the admin api to relay
+type RelayRequest struct {
+	TxId   string `json:"txId,omitempty"` // ntor, hash of the neo tx
+	Height uint32 `json:"height,omitempty"`
+	Key    string `json:"key,omitempty"` // rton, with the poly height
+}
+
+// UtxoRequest is the consolidate or split the utxo commands ask the admin api to do
+type UtxoRequest struct {
+	Dust      float64 `json:"dust,omitempty"` // consolidate
+	MaxInputs int     `json:"maxInputs,omitempty"`
+	Count     int     `json:"count,omitempty"` // split
+	Size      float64 `json:"size,omitempty"`
+}
+
+// UtxoResult is the tx made by a consolidate or split, empty if there is nothing to consolidate
+type UtxoResult struct {
+	TxHash string `json:"txHash"`
+}
+
+var transferStatus = map[byte]string{
+	db.TRANSFER_DECODED:     "decoded",
+	db.TRANSFER_SENT:        "sent",
+	db.TRANSFER_QUARANTINED: "quarantined",
+}
+
+// StartAdmin serves the admin api on addr in a new goroutine, it is shut down by Stop. There is no authentication,
+// so addr has to be a loopback address unless AdminAllowRemote is set.
+//
+//	GET    /api/v1/check                        list the Check bucket
+//	DELETE /api/v1/check/{txHash}               delete an entry
+//	POST   /api/v1/check/{txHash}/retry         relay the entry to poly again without waiting for its tx
+//	GET    /api/v1/retry/{ntor|rton}            list the Retry or NeoRetry bucket
+//	POST   /api/v1/retry/{ntor|rton}            enqueue {"height": h, "key": k}
+//	DELETE /api/v1/retry/{ntor|rton}/{id}       delete an entry
+//	POST   /api/v1/retry/{ntor|rton}/{id}/retry retry an entry immediately
+//	GET    /api/v1/dead/{ntor|rton}             list the dead letters
+//	DELETE /api/v1/dead/{ntor|rton}/{id}        delete a dead letter
+//	POST   /api/v1/dead/{ntor|rton}/{id}/requeue move a dead letter back to retry with attempts reset
+//	GET    /api/v1/transfer[?status=s]          list the poly to neo transfers, with status decoded, sent or quarantined
+//	GET    /api/v1/transfer/{id}                get a transfer by the id of its retry
+//	POST   /api/v1/relay/ntor                   relay the cross chain txs in the neo tx {"txId": t} to poly
+//	POST   /api/v1/relay/rton                   relay the cross chain tx {"height": h, "key": k} of poly to neo
+//	GET    /api/v1/utxo                         list the gas utxos of the neo account
+//	POST   /api/v1/utxo/consolidate             consolidate {"dust": d, "maxInputs": n}
+//	POST   /api/v1/utxo/split                   split {"count": c, "size": s}
+func (this *SyncService) StartAdmin(addr string) error {
+	if !this.config.AdminAllowRemote && !isLoopback(addr) {
+		return fmt.Errorf("[StartAdmin] %s is not a loopback address, set AdminAllowRemote to serve the admin api on it", addr)
+	}
+	this.admin = &http.Server{
+		Addr:         addr,
+		Handler:      this.adminHandler(),
+		ReadTimeout:  ADMIN_READ_TIMEOUT,
+		WriteTimeout: ADMIN_WRITE_TIMEOUT,
+	}
+	go func() {
+		log.Infof("[StartAdmin] listening on %s", addr)
+		if err := this.admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("[StartAdmin] ListenAndServe error: %s", err)
+		}
+	}()
+	return nil
+}
+
+// isLoopback reports whether the host of addr is localhost or a loopback ip, an empty host listens on all interfaces
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (this *SyncService) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ADMIN_PREFIX+"check", this.handleCheck)
+	mux.HandleFunc(ADMIN_PREFIX+"check/", this.handleCheck)
+	mux.HandleFunc(ADMIN_PREFIX+"retry/", this.handleRetry)
+	mux.HandleFunc(ADMIN_PREFIX+"dead/", this.handleDead)
+	mux.HandleFunc(ADMIN_PREFIX+"transfer", this.handleTransfer)
+	mux.HandleFunc(ADMIN_PREFIX+"transfer/", this.handleTransfer)
+	mux.HandleFunc(ADMIN_PREFIX+"relay/", this.handleRelay)
+	mux.HandleFunc(ADMIN_PREFIX+"utxo", this.handleUtxo)
+	mux.HandleFunc(ADMIN_PREFIX+"utxo/", this.handleUtxo)
+	return mux
+}
+
+func (this *SyncService) handleCheck(w http.ResponseWriter, r *http.Request) {
+	// [{txHash}[/retry]]
+	var parts []string
+	if path := strings.Trim(strings.TrimPrefix(r.URL.Path, ADMIN_PREFIX+"check"), "/"); path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		this.listCheck(w)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		this.deleteCheck(w, parts[0])
+	case len(parts) == 2 && parts[1] == "retry" && r.Method == http.MethodPost:
+		this.forceCheck(w, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+	}
+}
+
+func (this *SyncService) handleRetry(w http.ResponseWriter, r *http.Request) {
+	// {ntor|rton}[/{id}[/retry]]
+	parts, ok := splitAdminPath(w, r, "retry/")
+	if !ok {
+		return
+	}
+	direction := parts[0]
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		this.listRetry(w, direction)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		this.enqueueRetry(w, r, direction)
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		this.deleteRetry(w, direction, parts[1])
+	case len(parts) == 3 && parts[2] == "retry" && r.Method == http.MethodPost:
+		this.forceRetry(w, direction, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+	}
+}
+
+func (this *SyncService) handleDead(w http.ResponseWriter, r *http.Request) {
+	// {ntor|rton}[/{id}[/requeue]]
+	parts, ok := splitAdminPath(w, r, "dead/")
+	if !ok {
+		return
+	}
+	direction := parts[0]
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		this.listDead(w, direction)
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		this.deleteDead(w, direction, parts[1])
+	case len(parts) == 3 && parts[2] == "requeue" && r.Method == http.MethodPost:
+		this.requeueDead(w, direction, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+	}
+}
+
+func (this *SyncService) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, ADMIN_PREFIX+"transfer"), "/")
+	if id != "" {
+		k, err := hex.DecodeString(id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("id is not a hex string: %s", err))
+			return
+		}
+		transfer, err := this.db.GetTransfer(k)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if transfer == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("transfer %s not found", id))
+			return
+		}
+		writeJson(w, http.StatusOK, newTransferEntry(transfer))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	transfers, err := this.db.GetAllTransfer()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries := make([]*TransferEntry, 0, len(transfers))
+	for _, transfer := range transfers {
+		if entry := newTransferEntry(transfer); status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	writeJson(w, http.StatusOK, entries)
+}
+
+func (this *SyncService) handleRelay(w http.ResponseWriter, r *http.Request) {
+	// {ntor|rton}
+	parts, ok := splitAdminPath(w, r, "relay/")
+	if !ok {
+		return
+	}
+	if len(parts) != 1 || r.Method != http.MethodPost {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+	direction := parts[0]
+	req := new(RelayRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request error: %s", err))
+		return
+	}
+
+	var err error
+	if direction == NTOR {
+		if req.TxId == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("txId is empty"))
+			return
+		}
+		log.Infof("[admin] relay neo tx %s", req.TxId)
+		err = this.RelayNeoTx(req.TxId)
+	} else {
+		if req.Key == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("key is empty"))
+			return
+		}
+		log.Infof("[admin] relay poly tx at height %d, key %s", req.Height, req.Key)
+		err = this.RelayPolyTx(req.Height, req.Key)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJson(w, http.StatusOK, req)
+}
+
+func (this *SyncService) handleUtxo(w http.ResponseWriter, r *http.Request) {
+	// [consolidate|split]
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, ADMIN_PREFIX+"utxo"), "/")
+	if action == "" && r.Method == http.MethodGet {
+		entries, err := this.ListUtxos()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJson(w, http.StatusOK, entries)
+		return
+	}
+	if (action != "consolidate" && action != "split") || r.Method != http.MethodPost {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+	req := new(UtxoRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request error: %s", err))
+		return
+	}
+
+	result := new(UtxoResult)
+	var err error
+	if action == "consolidate" {
+		if req.Dust <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("dust is not positive"))
+			return
+		}
+		log.Infof("[admin] consolidate utxos smaller than %.8f", req.Dust)
+		result.TxHash, err = this.ConsolidateUtxos(req.Dust, req.MaxInputs)
+	} else {
+		if req.Count <= 0 || req.Size <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("count or size is not positive"))
+			return
+		}
+		log.Infof("[admin] split %d utxos of %.8f", req.Count, req.Size)
+		result.TxHash, err = this.SplitUtxos(req.Count, req.Size)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJson(w, http.StatusOK, result)
+}
+
+func (this *SyncService) listCheck(w http.ResponseWriter) {
+	checkMap, err := this.db.GetAllCheck()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries := make([]*RetryEntry, 0, len(checkMap))
+	for txHash, v := range checkMap {
+		entry, _ := newCheckEntry(txHash, v)
+		entries = append(entries, entry)
+	}
+	writeJson(w, http.StatusOK, entries)
+}
+
+func (this *SyncService) deleteCheck(w http.ResponseWriter, txHash string) {
+	entry, _, ok := this.findCheck(w, txHash)
+	if !ok {
+		return
+	}
+	if err := this.db.DeleteCheck(entry.Id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Infof("[admin] delete check, poly tx: %s", entry.Id)
+	writeJson(w, http.StatusOK, entry)
+}
+
+// forceCheck stops waiting for the poly tx of a check entry and relays its retry again, which goes to the Retry
+// bucket if it fails
+func (this *SyncService) forceCheck(w http.ResponseWriter, txHash string) {
+	entry, retry, ok := this.findCheck(w, txHash)
+	if !ok {
+		return
+	}
+	if retry == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("check %s can not be decoded: %s, delete it instead", entry.Id, entry.Error))
+		return
+	}
+	log.Infof("[admin] force check retry, poly tx: %s", entry.Id)
+
+	this.retryLock.Lock()
+	err := this.db.DeleteCheck(entry.Id)
+	if err == nil {
+		err = this.retrySyncProofToRelay(retry)
+	}
+	this.retryLock.Unlock()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newRetryEntry(retry))
+}
+
+func (this *SyncService) listRetry(w http.ResponseWriter, direction string) {
+	var retryList []*db.Retry
+	var err error
+	if direction == NTOR {
+		retryList, err = this.db.GetAllRetry()
+	} else {
+		retryList, err = this.db.GetAllNeoRetry()
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newRetryEntries(retryList))
+}
+
+func (this *SyncService) enqueueRetry(w http.ResponseWriter, r *http.Request, direction string) {
+	req := new(struct {
+		Height uint32 `json:"height"`
+		Key    string `json:"key"`
+	})
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request error: %s", err))
+		return
+	}
+	if req.Key == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("key is empty"))
+		return
+	}
+	if _, err := hex.DecodeString(req.Key); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("key is not a hex string: %s", err))
+		return
+	}
+	retry := db.NewRetry(req.Height, req.Key)
+	if err := this.putRetry(direction, retry); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Infof("[admin] enqueue %s retry, height: %d, key: %s", direction, retry.Height, retry.Key)
+	writeJson(w, http.StatusOK, newRetryEntry(retry))
+}
+
+func (this *SyncService) deleteRetry(w http.ResponseWriter, direction string, id string) {
+	retry, ok := this.findRetry(w, direction, id)
+	if !ok {
+		return
+	}
+	var err error
+	if direction == NTOR {
+		err = this.db.DeleteRetry(retry.Id())
+	} else {
+		err = this.db.DeleteNeoRetry(retry.Id())
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Infof("[admin] delete %s retry, db key: %s", direction, id)
+	writeJson(w, http.StatusOK, newRetryEntry(retry))
+}
+
+func (this *SyncService) forceRetry(w http.ResponseWriter, direction string, id string) {
+	retry, ok := this.findRetry(w, direction, id)
+	if !ok {
+		return
+	}
+	log.Infof("[admin] force %s retry, db key: %s", direction, id)
+
+	var err error
+	this.retryLock.Lock()
+	if direction == NTOR {
+		err = this.retrySyncProofToRelay(retry)
+	} else {
+		var lastSynced uint64
+		lastSynced, err = this.GetCurrentNeoChainSyncHeight(this.relaySdk.GetChainId())
+		if err == nil {
+			err = this.retrySyncProofToNeo(retry, uint32(lastSynced))
+		}
+	}
+	this.retryLock.Unlock()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newRetryEntry(retry))
+}
+
+func (this *SyncService) listDead(w http.ResponseWriter, direction string) {
+	retryList, err := this.db.GetAllDeadLetter(deadPrefix(direction))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, newRetryEntries(retryList))
+}
+
+func (this *SyncService) deleteDead(w http.ResponseWriter, direction string, id string) {
+	retry, ok := this.findDead(w, direction, id)
+	if !ok {
+		return
+	}
+	if err := this.db.DeleteDeadLetter(deadPrefix(direction), retry.Id()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Infof("[admin] delete %s dead letter, db key: %s", direction, id)
+	writeJson(w, http.StatusOK, newRetryEntry(retry))
+}
+
+func (this *SyncService) requeueDead(w http.ResponseWriter, direction string, id string) {
+	retry, ok := this.findDead(w, direction, id)
+	if !ok {
+		return
+	}
+	requeued := db.NewRetry(retry.Height, retry.Key)
+	requeued.LastError = retry.LastError
+	if err := this.putRetry(direction, requeued); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := this.db.DeleteDeadLetter(deadPrefix(direction), retry.Id()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Infof("[admin] requeue %s dead letter, db key: %s", direction, id)
+	writeJson(w, http.StatusOK, newRetryEntry(requeued))
+}
+
+func (this *SyncService) findRetry(w http.ResponseWriter, direction string, id string) (*db.Retry, bool) {
+	k, err := hex.DecodeString(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("id is not a hex string: %s", err))
+		return nil, false
+	}
+	var retry *db.Retry
+	if direction == NTOR {
+		retry, err = this.db.GetRetry(k)
+	} else {
+		retry, err = this.db.GetNeoRetry(k)
+	}
+	return checkFound(w, retry, err, fmt.Sprintf("%s retry %s", direction, id))
+}
+
+// findCheck returns the check entry of txHash, and the retry in it which is nil if the value can not be decoded
+func (this *SyncService) findCheck(w http.ResponseWriter, txHash string) (*RetryEntry, *db.Retry, bool) {
+	txHash = strings.ToLower(txHash)
+	if _, err := hex.DecodeString(txHash); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("tx hash is not a hex string: %s", err))
+		return nil, nil, false
+	}
+	v, err := this.db.GetCheck(txHash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+	if v == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("check %s not found", txHash))
+		return nil, nil, false
+	}
+	entry, retry := newCheckEntry(txHash, v)
+	return entry, retry, true
+}
+
+func (this *SyncService) findDead(w http.ResponseWriter, direction string, id string) (*db.Retry, bool) {
+	k, err := hex.DecodeString(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("id is not a hex string: %s", err))
+		return nil, false
+	}
+	retry, err := this.db.GetDeadLetter(deadPrefix(direction), k)
+	return checkFound(w, retry, err, fmt.Sprintf("%s dead letter %s", direction, id))
+}
+
+func checkFound(w http.ResponseWriter, retry *db.Retry, err error, what string) (*db.Retry, bool) {
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if retry == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", what))
+		return nil, false
+	}
+	return retry, true
+}
+
+// splitAdminPath splits the path after ADMIN_PREFIX+resource, the first part of which must be a direction
+func splitAdminPath(w http.ResponseWriter, r *http.Request, resource string) ([]string, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ADMIN_PREFIX+resource), "/"), "/")
+	if parts[0] != NTOR && parts[0] != RTON {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown direction %s", parts[0]))
+		return nil, false
+	}
+	return parts, true
+}
+
+func deadPrefix(direction string) byte {
+	if direction == RTON {
+		return db.DEAD_RTON
+	}
+	return db.DEAD_NTOR
+}
+
+func newRetryEntry(retry *db.Retry) *RetryEntry {
+	return &RetryEntry{
+		Id:          hex.EncodeToString(retry.Id()),
+		Height:      retry.Height,
+		Key:         retry.Key,
+		Attempts:    retry.Attempts,
+		LastError:   retry.LastError,
+		FirstSeen:   retry.FirstSeen,
+		NextAttempt: retry.NextAttempt,
+	}
+}
+
+// newCheckEntry decodes the check entry of txHash, which is addressed by txHash whether v can be decoded or not
+func newCheckEntry(txHash string, v []byte) (*RetryEntry, *db.Retry) {
+	retry := new(db.Retry)
+	if err := retry.Deserialization(pCommon.NewZeroCopySource(v)); err != nil {
+		return &RetryEntry{Id: txHash, TxHash: txHash, Error: err.Error()}, nil
+	}
+	entry := newRetryEntry(retry)
+	entry.Id, entry.TxHash = txHash, txHash
+	return entry, retry
+}
+
+func newRetryEntries(retryList []*db.Retry) []*RetryEntry {
+	entries := make([]*RetryEntry, 0, len(retryList))
+	for _, retry := range retryList {
+		entries = append(entries, newRetryEntry(retry))
+	}
+	return entries
+}
+
+func newTransferEntry(transfer *db.Transfer) *TransferEntry {
+	return &TransferEntry{
+		Id:           hex.EncodeToString(transfer.Id()),
+		Height:       transfer.Height,
+		Key:          transfer.Key,
+		PolyTxHash:   transfer.PolyTxHash,
+		FromChainID:  transfer.FromChainID,
+		FromContract: transfer.FromContract,
+		ToContract:   transfer.ToContract,
+		AssetHash:    transfer.AssetHash,
+		ToAddress:    transfer.ToAddress,
+		Amount:       transfer.Amount,
+		Status:       transferStatus[transfer.Status],
+		Reason:       transfer.Reason,
+		NeoTxHash:    transfer.NeoTxHash,
+		UpdatedAt:    transfer.UpdatedAt,
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("[admin] encode response error: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
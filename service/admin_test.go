@@ -0,0 +1,248 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAdminTestService(t *testing.T) (*SyncService, func()) {
+	dir, err := ioutil.TempDir("", "neo-relayer-admin")
+	assert.Nil(t, err)
+	boltDB, err := db.NewBoltDB(dir)
+	assert.Nil(t, err)
+	return &SyncService{db: boltDB, config: config.NewConfig()}, func() {
+		boltDB.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func doAdmin(t *testing.T, h http.Handler, method, path, body string) (int, []byte) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestAdmin_Retry(t *testing.T) {
+	s, clean := newAdminTestService(t)
+	defer clean()
+	h := s.adminHandler()
+
+	code, body := doAdmin(t, h, http.MethodPost, "/api/v1/retry/rton", `{"height": 11027320, "key": "0102050a"}`)
+	assert.Equal(t, http.StatusOK, code)
+	entry := new(RetryEntry)
+	assert.Nil(t, json.Unmarshal(body, entry))
+	assert.Equal(t, uint32(11027320), entry.Height)
+	assert.Equal(t, "0102050a", entry.Key)
+
+	code, body = doAdmin(t, h, http.MethodGet, "/api/v1/retry/rton", "")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*RetryEntry
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, entry.Id, entries[0].Id)
+
+	code, _ = doAdmin(t, h, http.MethodGet, "/api/v1/retry/ntor", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/retry/rton/"+entry.Id, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/retry/rton/"+entry.Id, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/retry/rton", `{"height": 1, "key": "not hex"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doAdmin(t, h, http.MethodGet, "/api/v1/retry/unknown", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdmin_Dead(t *testing.T) {
+	s, clean := newAdminTestService(t)
+	defer clean()
+	s.config.RetryInterval = 2
+	s.config.RetryMaxAttempts = 3
+	h := s.adminHandler()
+
+	retry := db.NewRetry(11027320, "0102050a")
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, s.failRetry(RTON, retry, fmt.Errorf("SendRawTransaction error")))
+	}
+	retry, err := s.db.GetNeoRetry(retry.Id())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), retry.Attempts)
+	assert.False(t, isDue(retry))
+	assert.Equal(t, int64(4), s.retryDelay(retry.Attempts))
+
+	assert.Nil(t, s.failRetry(RTON, retry, fmt.Errorf("SendRawTransaction error")))
+	code, body := doAdmin(t, h, http.MethodGet, "/api/v1/retry/rton", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[]\n", string(body))
+
+	code, body = doAdmin(t, h, http.MethodGet, "/api/v1/dead/rton", "")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*RetryEntry
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, uint32(3), entries[0].Attempts)
+	assert.Equal(t, "SendRawTransaction error", entries[0].LastError)
+
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/dead/rton/"+entries[0].Id+"/requeue", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/dead/rton/"+entries[0].Id+"/requeue", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	retry, err = s.db.GetNeoRetry(retry.Id())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), retry.Attempts)
+	assert.True(t, isDue(retry))
+}
+
+func TestAdmin_Check(t *testing.T) {
+	s, clean := newAdminTestService(t)
+	defer clean()
+	h := s.adminHandler()
+
+	// an entry which can not be decoded is addressed by its db key, not by its value
+	assert.Nil(t, s.db.PutCheck("0a0b", []byte{0xff}))
+	code, body := doAdmin(t, h, http.MethodGet, "/api/v1/check", "")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*RetryEntry
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "0a0b", entries[0].Id)
+		assert.Equal(t, "0a0b", entries[0].TxHash)
+		assert.NotEmpty(t, entries[0].Error)
+	}
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/check/0a0b/retry", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/check/0a0b", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/check/0a0b", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/check/not-hex", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdmin_CheckRetry(t *testing.T) {
+	s, _, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	h := s.adminHandler()
+
+	// a decoded entry is addressed by its tx hash too, and replaced by the tx of the retry
+	sink := pCommon.NewZeroCopySink(nil)
+	db.NewRetry(1, testLockKey).Serialization(sink)
+	assert.Nil(t, s.db.PutCheck("0a0b", sink.Bytes()))
+	code, body := doAdmin(t, h, http.MethodGet, "/api/v1/check", "")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*RetryEntry
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "0a0b", entries[0].Id)
+		assert.Equal(t, testLockKey, entries[0].Key)
+	}
+
+	code, body = doAdmin(t, h, http.MethodPost, "/api/v1/check/0a0b/retry", "")
+	assert.Equal(t, http.StatusOK, code, string(body))
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+	checks, err := s.db.GetAllCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checks))
+	_, ok := checks["0a0b"]
+	assert.False(t, ok)
+
+	// a failed retry goes to the Retry bucket
+	for txHash := range checks {
+		polyFake.importError = fmt.Errorf("poly node is down")
+		code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/check/"+txHash+"/retry", "")
+		assert.Equal(t, http.StatusBadGateway, code)
+	}
+	checks, err = s.db.GetAllCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(checks))
+	retries, err := s.db.GetAllRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+}
+
+func TestAdmin_Remote(t *testing.T) {
+	assert.True(t, isLoopback("127.0.0.1:9101"))
+	assert.True(t, isLoopback("localhost:9101"))
+	assert.True(t, isLoopback("[::1]:9101"))
+	assert.False(t, isLoopback(":9101"))
+	assert.False(t, isLoopback("0.0.0.0:9101"))
+	assert.False(t, isLoopback("10.0.0.1:9101"))
+
+	s, clean := newAdminTestService(t)
+	defer clean()
+	assert.NotNil(t, s.StartAdmin("0.0.0.0:0"))
+	assert.Nil(t, s.admin)
+}
+
+func TestAdmin_Relay(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	h := s.adminHandler()
+
+	code, _ := doAdmin(t, h, http.MethodPost, "/api/v1/relay/rton", `{"height": 10}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, body := doAdmin(t, h, http.MethodPost, "/api/v1/relay/rton",
+		fmt.Sprintf(`{"height": %d, "key": "%s"}`, testPolyTxHeight, testUnlockKey))
+	assert.Equal(t, http.StatusOK, code, string(body))
+	assert.Equal(t, 1, len(neoFake.sent))
+	code, _ = doAdmin(t, h, http.MethodGet, "/api/v1/relay/rton", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	s, neoFake, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	h = s.adminHandler()
+	code, body = doAdmin(t, h, http.MethodPost, "/api/v1/relay/ntor",
+		fmt.Sprintf(`{"txId": "%s"}`, neoFake.blocks[1].Tx[0].Txid))
+	assert.Equal(t, http.StatusOK, code, string(body))
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/relay/ntor", `{"txId": "0x0a"}`)
+	assert.Equal(t, http.StatusBadGateway, code)
+}
+
+func TestAdmin_Utxo(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoNetFee = 0.001
+	h := s.adminHandler()
+	neoFake.unspents = []models.Unspent{
+		{Txid: fakeHash(1), N: 0, Value: 0.01},
+		{Txid: fakeHash(2), N: 0, Value: 0.02},
+		{Txid: fakeHash(3), N: 0, Value: 5},
+	}
+
+	code, body := doAdmin(t, h, http.MethodGet, "/api/v1/utxo", "")
+	assert.Equal(t, http.StatusOK, code)
+	var entries []*UtxoEntry
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	assert.Equal(t, 3, len(entries))
+
+	code, _ = doAdmin(t, h, http.MethodPost, "/api/v1/utxo/consolidate", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, body = doAdmin(t, h, http.MethodPost, "/api/v1/utxo/consolidate", `{"dust": 0.1, "maxInputs": 10}`)
+	assert.Equal(t, http.StatusOK, code, string(body))
+	result := new(UtxoResult)
+	assert.Nil(t, json.Unmarshal(body, result))
+	assert.NotEmpty(t, result.TxHash)
+	assert.Equal(t, 1, len(neoFake.sent))
+
+	code, body = doAdmin(t, h, http.MethodPost, "/api/v1/utxo/split", `{"count": 2, "size": 1}`)
+	assert.Equal(t, http.StatusOK, code, string(body))
+	assert.Equal(t, 2, len(neoFake.sent))
+	code, _ = doAdmin(t, h, http.MethodDelete, "/api/v1/utxo", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
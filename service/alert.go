@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/notify"
+)
+
+const (
+	EVENT_NEO_BALANCE    = "neo_balance"       // gas of the neo account below the thresholds
+	EVENT_RELAY_BALANCE  = "relay_balance"     // balance of the relay account on poly below the thresholds
+	EVENT_NEO_FEE        = "neo_fee"           // the neo account can not pay the fee of a tx
+	EVENT_RELAY_FEE      = "relay_fee"         // the relay account can not pay the fee of a tx on poly
+	EVENT_NEO_FEE_BUDGET = "neo_fee_budget"    // gas spent on neo today reaches the budget
+	EVENT_KEY_HEADER     = "key_header"        // a key header is not synced
+	EVENT_BOOKKEEPER     = "change_bookkeeper" // the book keepers of poly are not changed on neo
+	EVENT_DEAD_LETTER    = "dead_letter"       // a transfer is moved to the dead letters
+	EVENT_QUARANTINE     = "quarantine"        // a transfer which can not be decoded is moved to the dead letters
+	EVENT_NEO_FORK       = "neo_fork"          // the neo node serves a different chain from the one scanned
+	EVENT_LOCK_EVENT     = "lock_event"        // a CrossChainLockEvent of the neo CCMC can not be decoded
+	EVENT_STALLED        = "_stalled"          // suffix of the direction of a scanner which is stalled
+)
+
+// AlertHook receives the alerts of the sync service, it should return quickly
+type AlertHook func(alert *notify.Alert)
+
+// SetAlertHook sets the hook which receives the alerts, it should be called before Run
+func (this *SyncService) SetAlertHook(hook AlertHook) {
+	this.alertHook = hook
+}
+
+// alert logs an alert and passes it to the hook
+func (this *SyncService) alert(level, event, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	switch level {
+	case notify.CRITICAL:
+		log.Errorf("[alert] %s %s: %s", level, event, message)
+	case notify.WARN:
+		log.Warnf("[alert] %s %s: %s", level, event, message)
+	default:
+		log.Infof("[alert] %s %s: %s", level, event, message)
+	}
+	if this.alertHook != nil {
+		this.alertHook(&notify.Alert{Level: level, Event: event, Message: message, Time: time.Now().Unix()})
+	}
+}
+
+// setAlertLevel alerts when the level of event changes. An empty level means the event is back to normal, which is
+// alerted as resolved.
+func (this *SyncService) setAlertLevel(event, level, format string, a ...interface{}) {
+	this.alertLock.Lock()
+	if this.alertLevels == nil {
+		this.alertLevels = make(map[string]string)
+	}
+	last := this.alertLevels[event]
+	this.alertLevels[event] = level
+	this.alertLock.Unlock()
+	if level == last {
+		return
+	}
+	if level == "" {
+		level = notify.RESOLVED
+	}
+	this.alert(level, event, format, a...)
+}
+
+// stallWatch counts the scan intervals a scanner stays at one height
+type stallWatch struct {
+	height    uint32
+	intervals uint32
+}
+
+// watchStall alerts when the scanner of direction stays at height for StallIntervals intervals while it is behind
+// chainHeight, the next height to be scanned is height and the last one is chainHeight - 1
+func (this *SyncService) watchStall(watch *stallWatch, direction string, height, chainHeight uint32) {
+	if this.config.StallIntervals == 0 {
+		return
+	}
+	if height != watch.height || height >= chainHeight {
+		watch.height, watch.intervals = height, 0
+		this.setAlertLevel(direction+EVENT_STALLED, "", "%s scanner moves on at height %d", direction, height)
+		return
+	}
+	watch.intervals++
+	if watch.intervals >= this.config.StallIntervals {
+		this.setAlertLevel(direction+EVENT_STALLED, notify.CRITICAL, "%s scanner is stalled at height %d for %d "+
+			"intervals, chain height: %d", direction, height, watch.intervals, chainHeight)
+	}
+}
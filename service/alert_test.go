@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncService_watchStall(t *testing.T) {
+	s, _, _, clean := newFakeService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	s.config.StallIntervals = 2
+
+	var stall stallWatch
+	s.watchStall(&stall, "relay_to_neo", 10, 10) // caught up
+	s.watchStall(&stall, "relay_to_neo", 10, 20)
+	assert.Empty(t, alerts)
+	s.watchStall(&stall, "relay_to_neo", 10, 20)
+	s.watchStall(&stall, "relay_to_neo", 10, 21)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "relay_to_neo"+EVENT_STALLED, alerts[0].Event)
+	assert.Equal(t, notify.CRITICAL, alerts[0].Level)
+
+	s.watchStall(&stall, "relay_to_neo", 11, 21)
+	assert.Equal(t, 2, len(alerts))
+	assert.Equal(t, notify.RESOLVED, alerts[1].Level)
+}
+
+func TestSyncService_deadLetterAlert(t *testing.T) {
+	s, _, _, clean := newFakeService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	s.config.RetryMaxAttempts = 1
+
+	assert.Nil(t, s.failRetry(RTON, db.NewRetry(1, "0a"), fmt.Errorf("vm fault")))
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, EVENT_DEAD_LETTER, alerts[0].Event)
+	assert.Contains(t, alerts[0].Message, "vm fault")
+}
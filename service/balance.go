@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/notify"
+)
+
+// CheckBalances alerts when the gas of the neo account or the balance of the relay account falls below the configured
+// thresholds
+func (this *SyncService) CheckBalances() {
+	interval := this.config.BalanceCheckInterval
+	if interval == 0 {
+		interval = config.DEFAULT_BALANCE_CHECK
+	}
+	for {
+		if this.config.NeoBalanceWarn > 0 || this.config.NeoBalanceCritical > 0 {
+			if err := this.checkNeoBalance(); err != nil {
+				log.Errorf("[CheckBalances] %s", err)
+			}
+		}
+		if this.config.RelayBalanceWarn > 0 || this.config.RelayBalanceCritical > 0 {
+			if err := this.checkRelayBalance(); err != nil {
+				log.Errorf("[CheckBalances] %s", err)
+			}
+		}
+		if !this.sleep(time.Duration(interval) * time.Second) {
+			return
+		}
+	}
+}
+
+// checkNeoBalance compares the gas on chain of the neo account, reserved or not, with the thresholds
+func (this *SyncService) checkNeoBalance() error {
+	entries, err := this.ListUtxos()
+	if err != nil {
+		return fmt.Errorf("ListUtxos error: %s", err)
+	}
+	balance := helper.Zero
+	for _, entry := range entries {
+		if !entry.Change {
+			balance = balance.Add(helper.Fixed8FromFloat64(entry.Value))
+		}
+	}
+	gas := helper.Fixed8ToFloat64(balance)
+	address := this.neoAccount.Address
+	switch {
+	case this.config.NeoBalanceCritical > 0 && gas < this.config.NeoBalanceCritical:
+		this.setAlertLevel(EVENT_NEO_BALANCE, notify.CRITICAL, "gas balance %.8f of %s is below %.8f",
+			gas, address, this.config.NeoBalanceCritical)
+	case this.config.NeoBalanceWarn > 0 && gas < this.config.NeoBalanceWarn:
+		this.setAlertLevel(EVENT_NEO_BALANCE, notify.WARN, "gas balance %.8f of %s is below %.8f",
+			gas, address, this.config.NeoBalanceWarn)
+	default:
+		this.setAlertLevel(EVENT_NEO_BALANCE, "", "gas balance %.8f of %s is enough", gas, address)
+	}
+	return nil
+}
+
+// checkRelayBalance compares the balance on poly of the relay account with the thresholds
+func (this *SyncService) checkRelayBalance() error {
+	checker, ok := this.relaySdk.PolyClient.(balanceChecker)
+	if !ok {
+		return fmt.Errorf("the poly client can not query the balance of the relay account")
+	}
+	address := this.relayAccount.Address.ToBase58()
+	balance, err := checker.GetBalance(address)
+	if err != nil {
+		return fmt.Errorf("GetBalance error: %s", err)
+	}
+	switch {
+	case this.config.RelayBalanceCritical > 0 && balance < this.config.RelayBalanceCritical:
+		this.setAlertLevel(EVENT_RELAY_BALANCE, notify.CRITICAL, "balance %.8f of relay account %s is below %.8f",
+			balance, address, this.config.RelayBalanceCritical)
+	case this.config.RelayBalanceWarn > 0 && balance < this.config.RelayBalanceWarn:
+		this.setAlertLevel(EVENT_RELAY_BALANCE, notify.WARN, "balance %.8f of relay account %s is below %.8f",
+			balance, address, this.config.RelayBalanceWarn)
+	default:
+		this.setAlertLevel(EVENT_RELAY_BALANCE, "", "balance %.8f of relay account %s is enough", balance, address)
+	}
+	return nil
+}
+
+// lackOfFee alerts the account which can not pay the fee of a tx, by cause which is taken by isLackOfFee. The
+// alert is resolved when the account pays a fee again.
+func (this *SyncService) lackOfFee(cause error) {
+	if strings.Contains(cause.Error(), UTXO_NOT_ENOUGH) {
+		this.setAlertLevel(EVENT_RELAY_FEE, notify.CRITICAL, "relay account %s can not pay the fee: %s",
+			this.relayAccount.Address.ToBase58(), cause)
+	} else {
+		this.setAlertLevel(EVENT_NEO_FEE, notify.CRITICAL, "neo account %s can not pay the fee: %s",
+			this.neoAccount.Address, cause)
+	}
+}
+
+// spendNeoFee counts the fee of t, which is sent to neo, in the budget of today and returns it. The fee is estimated
+// again if t is not made by the relayer.
+func (this *SyncService) spendNeoFee(t neoTx) helper.Fixed8 {
+	fee, ok := this.fees.take(t.HashString())
+	if !ok {
+		fee = this.fees.estimate(t.Size(), this.fees.netFee(0))
+		if itx, ok := t.(*tx.InvocationTransaction); ok {
+			fee = fee.Add(itx.Gas)
+		}
+	}
+	if _, err := this.db.AddNeoFee(feeDay(time.Now()), fee.Value); err != nil {
+		log.Errorf("[spendNeoFee] this.db.AddNeoFee error: %s, tx: %s", err, t.HashString())
+	}
+	this.setAlertLevel(EVENT_NEO_FEE, "", "neo account %s pays the fee again", this.neoAccount.Address)
+	return fee
+}
+
+// neoPaused reports whether the fee budget of today is spent, the txs to neo wait for the next day then
+func (this *SyncService) neoPaused() bool {
+	if this.config.NeoFeeBudget <= 0 {
+		return false
+	}
+	spent := helper.Fixed8ToFloat64(helper.NewFixed8(this.db.GetNeoFee(feeDay(time.Now()))))
+	if spent < this.config.NeoFeeBudget {
+		this.setAlertLevel(EVENT_NEO_FEE_BUDGET, "", "neo submissions resumed, %.8f gas spent today", spent)
+		return false
+	}
+	this.setAlertLevel(EVENT_NEO_FEE_BUDGET, notify.CRITICAL, "%.8f gas spent today reaches the budget %.8f, "+
+		"neo submissions are paused until tomorrow (UTC)", spent, this.config.NeoFeeBudget)
+	return true
+}
+
+// feeDay is the utc day of t which the fee budget is counted by
+func feeDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
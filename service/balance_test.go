@@ -0,0 +1,135 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncService_checkNeoBalance(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	s.config.NeoBalanceWarn = 10
+	s.config.NeoBalanceCritical = 1
+
+	neoFake.unspents = []models.Unspent{{Txid: fakeHash(1), N: 0, Value: 5}}
+	assert.Nil(t, s.checkNeoBalance())
+	assert.Nil(t, s.checkNeoBalance())
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, notify.WARN, alerts[0].Level)
+	assert.Equal(t, EVENT_NEO_BALANCE, alerts[0].Event)
+
+	// reserved gas is still counted
+	u := models.Unspent{Txid: fakeHash(2), N: 0, Value: 20}
+	neoFake.unspents = []models.Unspent{u}
+	assert.Nil(t, s.utxos.reserve("0a", []*tx.CoinReference{tx.ToCoinReference(u)}))
+	assert.Nil(t, s.checkNeoBalance())
+	assert.Equal(t, 2, len(alerts))
+	assert.Equal(t, notify.RESOLVED, alerts[1].Level)
+
+	neoFake.unspents = []models.Unspent{{Txid: fakeHash(3), N: 0, Value: 0.5}}
+	assert.Nil(t, s.checkNeoBalance())
+	assert.Equal(t, 3, len(alerts))
+	assert.Equal(t, notify.CRITICAL, alerts[2].Level)
+}
+
+// balancePoly is a poly client which can query the balance of the relay account
+type balancePoly struct {
+	*fakePoly
+	balance float64
+}
+
+func (this *balancePoly) GetBalance(address string) (float64, error) {
+	return this.balance, nil
+}
+
+func TestSyncService_checkRelayBalance(t *testing.T) {
+	s, _, polyFake, clean := newFakeService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	s.config.RelayBalanceWarn = 10
+	s.config.RelayBalanceCritical = 1
+
+	// the sdk of poly can not query a balance
+	assert.NotNil(t, s.checkRelayBalance())
+	assert.Empty(t, alerts)
+
+	poly := &balancePoly{fakePoly: polyFake, balance: 5}
+	s.relaySdk.PolyClient = poly
+	assert.Nil(t, s.checkRelayBalance())
+	assert.Nil(t, s.checkRelayBalance())
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, notify.WARN, alerts[0].Level)
+	assert.Equal(t, EVENT_RELAY_BALANCE, alerts[0].Event)
+
+	poly.balance = 0.5
+	assert.Nil(t, s.checkRelayBalance())
+	assert.Equal(t, notify.CRITICAL, alerts[1].Level)
+
+	poly.balance = 20
+	assert.Nil(t, s.checkRelayBalance())
+	assert.Equal(t, 3, len(alerts))
+	assert.Equal(t, notify.RESOLVED, alerts[2].Level)
+}
+
+func TestSyncService_lackOfFee(t *testing.T) {
+	s, _, _, clean := newFakeService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+
+	retry := db.NewRetry(1, "0a")
+	assert.Nil(t, s.postponeRetry(NTOR, retry, fmt.Errorf(UTXO_NOT_ENOUGH)))
+	assert.Nil(t, s.postponeRetry(NTOR, retry, fmt.Errorf(UTXO_NOT_ENOUGH)))
+	assert.Nil(t, s.postponeRetry(RTON, retry, fmt.Errorf(BALANCE_NOT_ENOUGH)))
+	assert.Equal(t, 2, len(alerts))
+	assert.Equal(t, EVENT_RELAY_FEE, alerts[0].Event)
+	assert.Equal(t, EVENT_NEO_FEE, alerts[1].Event)
+	assert.Equal(t, notify.CRITICAL, alerts[1].Level)
+}
+
+func TestRelayToNeo_FeeBudget(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	s.config.NeoFeeBudget = 0.0015
+
+	// the fee of the first tx is counted, and the budget is spent
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 1, len(neoFake.sent))
+	spent := s.db.GetNeoFee(feeDay(time.Now()))
+	assert.True(t, spent >= helper.Fixed8FromFloat64(s.config.NeoNetFee).Value)
+
+	_, err := s.db.AddNeoFee(feeDay(time.Now()), helper.Fixed8FromFloat64(0.001).Value)
+	assert.Nil(t, err)
+	s.neoSyncHeight = testPolyTxHeight
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 1, len(neoFake.sent))
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, EVENT_NEO_FEE_BUDGET, alerts[0].Event)
+
+	// the scan goes on, and the proof waits in the retries
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, 1, len(neoFake.sent))
+
+	// a new budget resumes the submissions
+	s.config.NeoFeeBudget = 1
+	assert.False(t, s.neoPaused())
+	assert.Nil(t, s.neoRetryTx())
+	assert.Equal(t, 2, len(neoFake.sent))
+	assert.Equal(t, notify.RESOLVED, alerts[1].Level)
+}
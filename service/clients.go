@@ -0,0 +1,216 @@
+package service
+
+import (
+	"time"
+
+	neoRpc "github.com/joeqian10/neo-gogogo/rpc"
+	"github.com/polynetwork/neo-relayer/metrics"
+	rsdk "github.com/polynetwork/poly-go-sdk"
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+)
+
+// NeoClient is the part of the neo rpc api the service uses, *neoRpc.RpcClient implements it
+type NeoClient interface {
+	GetApplicationLog(txId string) neoRpc.GetApplicationLogResponse
+	GetBlockByIndex(index uint32) neoRpc.GetBlockResponse
+	GetBlockCount() neoRpc.GetBlockCountResponse
+	GetBlockHeaderByIndex(index uint32) neoRpc.GetBlockHeaderResponse
+	GetBlockHeaderByHash(hash string) neoRpc.GetBlockHeaderResponse
+	GetProof(stateRoot, contractScriptHash, storeKey string) neoRpc.CrossChainProofResponse
+	GetRawMemPool() neoRpc.GetRawMemPoolResponse
+	GetRawTransaction(txId string) neoRpc.GetRawTransactionResponse
+	GetStateHeight() neoRpc.StateHeightResponse
+	GetStateRootByIndex(height uint32) neoRpc.StateRootResponse
+	GetStorage(scriptHash string, key string) neoRpc.GetStorageResponse
+	GetUnspents(address string) neoRpc.GetUnspentsResponse
+	InvokeScript(script string, checkWitnessHashes string) neoRpc.InvokeScriptResponse
+	SendRawTransaction(rawTx string) neoRpc.SendRawTransactionResponse
+}
+
+// PolyClient is the part of the poly sdk the service uses, see NewPolyClient
+type PolyClient interface {
+	GetChainId() uint64
+	GetBlockByHeight(height uint32) (*types.Block, error)
+	GetCrossStatesProof(height uint32, key string) (*sdkcom.MerkleProof, error)
+	GetCurrentBlockHeight() (uint32, error)
+	GetHeaderByHeight(height uint32) (*types.Header, error)
+	GetMerkleProof(blockHeight, rootHeight uint32) (*sdkcom.MerkleProof, error)
+	GetSmartContractEvent(txHash string) (*sdkcom.SmartContactEvent, error)
+	GetSmartContractEventByBlock(height uint32) ([]*sdkcom.SmartContactEvent, error)
+	GetStorage(contractAddress string, key []byte) ([]byte, error)
+	ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+		relayerAddress []byte, headerOrCrossChainMsg []byte, signer *rsdk.Account) (pCommon.Uint256, error)
+	SyncBlockHeader(chainId uint64, address pCommon.Address, headers [][]byte, signer *rsdk.Account) (pCommon.Uint256, error)
+	WaitForGenerateBlock(timeout time.Duration, blockCount ...uint32) (bool, error)
+}
+
+// balanceChecker is implemented by the poly clients which can query the balance of an account. Poly has no balance api
+// in this version, so the relay account balance is only checked with such a client.
+type balanceChecker interface {
+	GetBalance(address string) (float64, error)
+}
+
+// chainIdSetter is implemented by the poly clients whose chain id is set once the node is reached
+type chainIdSetter interface {
+	SetChainId(chainId uint64)
+}
+
+// polySdk adapts the chain id and the native contract calls of the poly sdk to PolyClient
+type polySdk struct {
+	*rsdk.PolySdk
+}
+
+// NewPolyClient wraps sdk, which should have its rpc client and chain id set
+func NewPolyClient(sdk *rsdk.PolySdk) PolyClient {
+	return &polySdk{sdk}
+}
+
+func (this *polySdk) GetChainId() uint64 {
+	return this.ChainId
+}
+
+func (this *polySdk) SetChainId(chainId uint64) {
+	this.PolySdk.SetChainId(chainId)
+}
+
+func (this *polySdk) ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+	relayerAddress []byte, headerOrCrossChainMsg []byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	return this.Native.Ccm.ImportOuterTransfer(sourceChainId, txData, height, proof, relayerAddress, headerOrCrossChainMsg, signer)
+}
+
+func (this *polySdk) SyncBlockHeader(chainId uint64, address pCommon.Address, headers [][]byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	return this.Native.Hs.SyncBlockHeader(chainId, address, headers, signer)
+}
+
+// neoClient wraps the neo rpc client to record the latency of the requests the service makes
+type neoClient struct {
+	NeoClient
+}
+
+func (this *neoClient) GetApplicationLog(txId string) neoRpc.GetApplicationLogResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getapplicationlog", time.Now())
+	return this.NeoClient.GetApplicationLog(txId)
+}
+
+func (this *neoClient) GetBlockByIndex(index uint32) neoRpc.GetBlockResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getblock", time.Now())
+	return this.NeoClient.GetBlockByIndex(index)
+}
+
+func (this *neoClient) GetBlockCount() neoRpc.GetBlockCountResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getblockcount", time.Now())
+	return this.NeoClient.GetBlockCount()
+}
+
+func (this *neoClient) GetBlockHeaderByIndex(index uint32) neoRpc.GetBlockHeaderResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getblockheader", time.Now())
+	return this.NeoClient.GetBlockHeaderByIndex(index)
+}
+
+func (this *neoClient) GetBlockHeaderByHash(hash string) neoRpc.GetBlockHeaderResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getblockheader", time.Now())
+	return this.NeoClient.GetBlockHeaderByHash(hash)
+}
+
+func (this *neoClient) GetProof(stateRoot, contractScriptHash, storeKey string) neoRpc.CrossChainProofResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getproof", time.Now())
+	return this.NeoClient.GetProof(stateRoot, contractScriptHash, storeKey)
+}
+
+func (this *neoClient) GetRawMemPool() neoRpc.GetRawMemPoolResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getrawmempool", time.Now())
+	return this.NeoClient.GetRawMemPool()
+}
+
+func (this *neoClient) GetRawTransaction(txId string) neoRpc.GetRawTransactionResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getrawtransaction", time.Now())
+	return this.NeoClient.GetRawTransaction(txId)
+}
+
+func (this *neoClient) GetStateHeight() neoRpc.StateHeightResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getstateheight", time.Now())
+	return this.NeoClient.GetStateHeight()
+}
+
+func (this *neoClient) GetStateRootByIndex(height uint32) neoRpc.StateRootResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getstateroot", time.Now())
+	return this.NeoClient.GetStateRootByIndex(height)
+}
+
+func (this *neoClient) GetStorage(scriptHash string, key string) neoRpc.GetStorageResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getstorage", time.Now())
+	return this.NeoClient.GetStorage(scriptHash, key)
+}
+
+func (this *neoClient) GetUnspents(address string) neoRpc.GetUnspentsResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "getunspents", time.Now())
+	return this.NeoClient.GetUnspents(address)
+}
+
+func (this *neoClient) InvokeScript(script string, checkWitnessHashes string) neoRpc.InvokeScriptResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "invokescript", time.Now())
+	return this.NeoClient.InvokeScript(script, checkWitnessHashes)
+}
+
+func (this *neoClient) SendRawTransaction(rawTx string) neoRpc.SendRawTransactionResponse {
+	defer metrics.ObserveRpc(metrics.CHAIN_NEO, "sendrawtransaction", time.Now())
+	return this.NeoClient.SendRawTransaction(rawTx)
+}
+
+// relayClient wraps the poly sdk to record the latency of the requests the service makes
+type relayClient struct {
+	PolyClient
+}
+
+func (this *relayClient) GetBlockByHeight(height uint32) (*types.Block, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getblock", time.Now())
+	return this.PolyClient.GetBlockByHeight(height)
+}
+
+func (this *relayClient) GetCrossStatesProof(height uint32, key string) (*sdkcom.MerkleProof, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getcrossstatesproof", time.Now())
+	return this.PolyClient.GetCrossStatesProof(height, key)
+}
+
+func (this *relayClient) GetCurrentBlockHeight() (uint32, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getblockcount", time.Now())
+	return this.PolyClient.GetCurrentBlockHeight()
+}
+
+func (this *relayClient) GetHeaderByHeight(height uint32) (*types.Header, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getheader", time.Now())
+	return this.PolyClient.GetHeaderByHeight(height)
+}
+
+func (this *relayClient) GetMerkleProof(blockHeight, rootHeight uint32) (*sdkcom.MerkleProof, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getmerkleproof", time.Now())
+	return this.PolyClient.GetMerkleProof(blockHeight, rootHeight)
+}
+
+func (this *relayClient) GetSmartContractEvent(txHash string) (*sdkcom.SmartContactEvent, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getsmartcodeevent", time.Now())
+	return this.PolyClient.GetSmartContractEvent(txHash)
+}
+
+func (this *relayClient) GetSmartContractEventByBlock(height uint32) ([]*sdkcom.SmartContactEvent, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getsmartcodeeventbyblock", time.Now())
+	return this.PolyClient.GetSmartContractEventByBlock(height)
+}
+
+func (this *relayClient) GetStorage(contractAddress string, key []byte) ([]byte, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "getstorage", time.Now())
+	return this.PolyClient.GetStorage(contractAddress, key)
+}
+
+func (this *relayClient) ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+	relayerAddress []byte, headerOrCrossChainMsg []byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "importoutertransfer", time.Now())
+	return this.PolyClient.ImportOuterTransfer(sourceChainId, txData, height, proof, relayerAddress, headerOrCrossChainMsg, signer)
+}
+
+func (this *relayClient) SyncBlockHeader(chainId uint64, address pCommon.Address, headers [][]byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	defer metrics.ObserveRpc(metrics.CHAIN_RELAY, "syncblockheader", time.Now())
+	return this.PolyClient.SyncBlockHeader(chainId, address, headers, signer)
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/metrics"
+)
+
+// contractCounter counts the cross chain txs relayed for each contract monitored
+type contractCounter struct {
+	lock   sync.Mutex
+	counts map[string]uint64 // by direction + "/" + contract
+}
+
+func newContractCounter() *contractCounter {
+	return &contractCounter{counts: make(map[string]uint64)}
+}
+
+// count counts one cross chain tx relayed for contract in direction, and returns the txs counted for it so far
+func (this *contractCounter) count(direction, contract string) uint64 {
+	metrics.ContractTxs.WithLabelValues(direction, contract).Inc()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.counts[direction+"/"+contract]++
+	return this.counts[direction+"/"+contract]
+}
+
+// ntorContract returns the NtorContract which calls the CCMC for event. If NtorContract is empty, it is the contract
+// calling the CCMC. If the caller is not in NtorContract, it is the one emitting one of notifications, which are of
+// the tx emitting event, like the relayer did before the caller was decoded.
+func (this *SyncService) ntorContract(notifications []models.RpcNotification, event *CrossChainLockEvent) (string, bool) {
+	if len(this.config.NtorContract) == 0 || this.config.NtorContract.Has(event.FromContract) {
+		return event.FromContract, true
+	}
+	for _, ntf := range notifications {
+		v, _ := helper.UInt160FromString(ntf.Contract)
+		if contract := helper.BytesToHex(v.Bytes()); this.config.NtorContract.Has(contract) {
+			return contract, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testOtherContract = "19cd39b09acc059ef6cc92bf2aff80baae2533d2"
+	testLockProxy     = "f5d8ba1e39f2e2dd2c1a6a2d4d1b2a4d5e0a8a3b" // the caller of the CCMC in lockEventLog
+)
+
+func TestContracts_UnmarshalJSON(t *testing.T) {
+	cfg := &config.Config{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"NtorContract": "`+testNeoCCMC+`", "RtonContract": ""}`), cfg))
+	assert.Equal(t, config.Contracts{testNeoCCMC}, cfg.NtorContract)
+	assert.Empty(t, cfg.RtonContract)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"NtorContract": ["`+testOtherContract+`", "", "0x`+testNeoCCMC+`"]}`), cfg))
+	assert.Equal(t, config.Contracts{testOtherContract, "0x" + testNeoCCMC}, cfg.NtorContract)
+	assert.True(t, cfg.NtorContract.Has(testNeoCCMC))
+	assert.False(t, cfg.NtorContract.Has(testUnlockKey))
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"NtorContract": 1}`), cfg))
+}
+
+func TestNeoToRelay_Contracts(t *testing.T) {
+	s, _, polyFake, clean := newNtorTestService(t)
+	defer clean()
+
+	s.config.NtorContract = config.Contracts{testOtherContract}
+	assert.Nil(t, s.neoToRelay(0, 4))
+	assert.Empty(t, polyFake.imports)
+
+	s.config.NtorContract = config.Contracts{testOtherContract, testNeoCCMC}
+	assert.Nil(t, s.neoToRelay(0, 4))
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+	assert.Equal(t, uint64(1), s.contracts.counts[metrics.NEO_TO_RELAY+"/"+testNeoCCMC])
+
+	// the caller of the CCMC is matched before the contracts emitting notifications, scanned again from height 0
+	s.relaySyncHeight = 0
+	s.config.NtorContract = config.Contracts{testNeoCCMC, testLockProxy}
+	assert.Nil(t, s.neoToRelay(s.relaySyncHeight, 4))
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+	assert.Equal(t, []uint32{1, 1}, polyFake.imports)
+	assert.Equal(t, uint64(1), s.contracts.counts[metrics.NEO_TO_RELAY+"/"+testLockProxy])
+}
+
+func TestRelayToNeo_Contracts(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	s.config.RtonContract = config.Contracts{testOtherContract}
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Empty(t, neoFake.sent)
+
+	// a retry is checked against the contracts too, and settled without being sent
+	retry := db.NewRetry(testPolyTxHeight, testUnlockKey)
+	assert.Nil(t, s.db.PutNeoRetry(retry))
+	assert.Nil(t, s.retrySyncProofToNeo(retry, testPolyLastSynced))
+	assert.Empty(t, neoFake.sent)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+
+	s.config.RtonContract = config.Contracts{testOtherContract, testUnlockKey}
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 1, len(neoFake.sent))
+	assert.Equal(t, uint64(1), s.contracts.counts[metrics.RELAY_TO_NEO+"/"+testUnlockKey])
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	neoRpc "github.com/joeqian10/neo-gogogo/rpc"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/joeqian10/neo-gogogo/wallet"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	rsdk "github.com/polynetwork/poly-go-sdk"
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// LIVE_TEST_ENV enables the tests which talk to public neo and poly nodes
+const LIVE_TEST_ENV = "NEO_RELAYER_LIVE_TEST"
+
+func liveTest(t *testing.T) {
+	if os.Getenv(LIVE_TEST_ENV) == "" {
+		t.Skipf("talks to public nodes, set %s to run it", LIVE_TEST_ENV)
+	}
+}
+
+var errNeoDown = neoRpc.ErrorResponse{NetError: fmt.Errorf("connection refused")}
+
+func neoError(format string, a ...interface{}) neoRpc.ErrorResponse {
+	return neoRpc.ErrorResponse{Error: neoRpc.RpcError{Code: -100, Message: fmt.Sprintf(format, a...)}}
+}
+
+// fakeNeo is an in memory neo chain, missing items are answered with rpc errors
+type fakeNeo struct {
+	lock        sync.Mutex
+	blocks      map[uint32]models.RpcBlock
+	appLogs     map[string]models.RpcApplicationLog
+	storage     map[string]string // scriptHash + key -> value
+	proofs      map[string]string // storeKey -> proof
+	stateHeight uint32
+	unspents    []models.Unspent // gas of the relayer
+	mempool     []string
+	sendError   string
+	sent        []string
+	down        bool // the node can not be reached
+}
+
+func newFakeNeo() *fakeNeo {
+	return &fakeNeo{
+		blocks:  make(map[uint32]models.RpcBlock),
+		appLogs: make(map[string]models.RpcApplicationLog),
+		storage: make(map[string]string),
+		proofs:  make(map[string]string),
+	}
+}
+
+func (this *fakeNeo) GetApplicationLog(txId string) neoRpc.GetApplicationLogResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	appLog, ok := this.appLogs[txId]
+	if !ok {
+		return neoRpc.GetApplicationLogResponse{ErrorResponse: neoError("unknown transaction %s", txId)}
+	}
+	return neoRpc.GetApplicationLogResponse{Result: appLog}
+}
+
+func (this *fakeNeo) GetBlockByIndex(index uint32) neoRpc.GetBlockResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return neoRpc.GetBlockResponse{ErrorResponse: errNeoDown}
+	}
+	blk, ok := this.blocks[index]
+	if !ok {
+		return neoRpc.GetBlockResponse{ErrorResponse: neoError("unknown block %d", index)}
+	}
+	return neoRpc.GetBlockResponse{Result: blk}
+}
+
+func (this *fakeNeo) GetBlockCount() neoRpc.GetBlockCountResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return neoRpc.GetBlockCountResponse{ErrorResponse: errNeoDown}
+	}
+	return neoRpc.GetBlockCountResponse{Result: len(this.blocks)}
+}
+
+func (this *fakeNeo) GetBlockHeaderByIndex(index uint32) neoRpc.GetBlockHeaderResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	blk, ok := this.blocks[index]
+	if !ok {
+		return neoRpc.GetBlockHeaderResponse{ErrorResponse: neoError("unknown block %d", index)}
+	}
+	return neoRpc.GetBlockHeaderResponse{Result: blk.RpcBlockHeader}
+}
+
+func (this *fakeNeo) GetBlockHeaderByHash(hash string) neoRpc.GetBlockHeaderResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, blk := range this.blocks {
+		if blk.Hash == hash {
+			return neoRpc.GetBlockHeaderResponse{Result: blk.RpcBlockHeader}
+		}
+	}
+	return neoRpc.GetBlockHeaderResponse{ErrorResponse: neoError("unknown block %s", hash)}
+}
+
+func (this *fakeNeo) GetProof(stateRoot, contractScriptHash, storeKey string) neoRpc.CrossChainProofResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	proof, ok := this.proofs[storeKey]
+	if !ok {
+		return neoRpc.CrossChainProofResponse{ErrorResponse: neoError("unknown key %s", storeKey)}
+	}
+	return neoRpc.CrossChainProofResponse{CrosschainProof: models.MPTProof{Success: true, Proof: proof}}
+}
+
+func (this *fakeNeo) GetRawMemPool() neoRpc.GetRawMemPoolResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return neoRpc.GetRawMemPoolResponse{ErrorResponse: errNeoDown}
+	}
+	return neoRpc.GetRawMemPoolResponse{Result: append([]string{}, this.mempool...)}
+}
+
+func (this *fakeNeo) GetRawTransaction(txId string) neoRpc.GetRawTransactionResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, blk := range this.blocks {
+		for _, t := range blk.Tx {
+			if t.Txid == txId {
+				t.BlockHash = blk.Hash
+				return neoRpc.GetRawTransactionResponse{Result: t}
+			}
+		}
+	}
+	for _, hash := range this.mempool {
+		if hash == txId {
+			return neoRpc.GetRawTransactionResponse{Result: models.RpcTransaction{Txid: txId}}
+		}
+	}
+	return neoRpc.GetRawTransactionResponse{ErrorResponse: neoError("unknown transaction %s", txId)}
+}
+
+func (this *fakeNeo) GetStateHeight() neoRpc.StateHeightResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return neoRpc.StateHeightResponse{ErrorResponse: errNeoDown}
+	}
+	return neoRpc.StateHeightResponse{Result: models.StateHeight{
+		BlockHeight: uint32(len(this.blocks)),
+		StateHeight: this.stateHeight,
+	}}
+}
+
+func (this *fakeNeo) GetStateRootByIndex(height uint32) neoRpc.StateRootResponse {
+	response := neoRpc.StateRootResponse{}
+	response.Result.Flag = "Verified"
+	response.Result.StateRoot.Index = height
+	response.Result.StateRoot.PreHash = fakeHash(height)
+	response.Result.StateRoot.StateRoot = fakeHash(height + 1)
+	return response
+}
+
+func (this *fakeNeo) GetStorage(scriptHash string, key string) neoRpc.GetStorageResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return neoRpc.GetStorageResponse{Result: this.storage[scriptHash+key]}
+}
+
+func (this *fakeNeo) GetUnspents(address string) neoRpc.GetUnspentsResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	response := neoRpc.GetUnspentsResponse{}
+	response.Result.Address = address
+	response.Result.Balances = []models.UnspentBalance{{
+		Unspents:  append([]models.Unspent{}, this.unspents...),
+		AssetHash: tx.GasToken.String(),
+		Asset:     "GAS",
+	}}
+	return response
+}
+
+func (this *fakeNeo) InvokeScript(script string, checkWitnessHashes string) neoRpc.InvokeScriptResponse {
+	response := neoRpc.InvokeScriptResponse{}
+	response.Result.Script = script
+	response.Result.State = "HALT"
+	response.Result.GasConsumed = "0"
+	return response
+}
+
+func (this *fakeNeo) SendRawTransaction(rawTx string) neoRpc.SendRawTransactionResponse {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.sendError != "" {
+		return neoRpc.SendRawTransactionResponse{ErrorResponse: neoError(this.sendError)}
+	}
+	this.sent = append(this.sent, rawTx)
+	return neoRpc.SendRawTransactionResponse{Result: true}
+}
+
+// fakePoly is an in memory poly chain, missing items are answered with errors
+type fakePoly struct {
+	lock         sync.Mutex
+	chainId      uint64
+	height       uint32
+	headers      map[uint32]*types.Header
+	events       map[uint32][]*sdkcom.SmartContactEvent
+	txEvents     map[string]*sdkcom.SmartContactEvent
+	proofs       map[string]string // height + key -> audit path
+	storage      map[string][]byte // hex key -> value
+	importError  error
+	imports      []uint32 // neo heights of the imported proofs
+	syncedHeader [][]byte
+	down         bool // the node can not be reached
+}
+
+var errPolyDown = fmt.Errorf("http post request:{} error:connection refused")
+
+func newFakePoly() *fakePoly {
+	return &fakePoly{
+		headers:  make(map[uint32]*types.Header),
+		events:   make(map[uint32][]*sdkcom.SmartContactEvent),
+		txEvents: make(map[string]*sdkcom.SmartContactEvent),
+		proofs:   make(map[string]string),
+		storage:  make(map[string][]byte),
+	}
+}
+
+func (this *fakePoly) GetChainId() uint64 {
+	return this.chainId
+}
+
+func (this *fakePoly) SetChainId(chainId uint64) {
+	this.chainId = chainId
+}
+
+func (this *fakePoly) GetBlockByHeight(height uint32) (*types.Block, error) {
+	header, err := this.GetHeaderByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Block{Header: header}, nil
+}
+
+func (this *fakePoly) GetCrossStatesProof(height uint32, key string) (*sdkcom.MerkleProof, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	path, ok := this.proofs[fmt.Sprintf("%d%s", height, key)]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s at height %d", key, height)
+	}
+	return &sdkcom.MerkleProof{Type: "MerkleProof", AuditPath: path}, nil
+}
+
+func (this *fakePoly) GetCurrentBlockHeight() (uint32, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return 0, errPolyDown
+	}
+	return this.height, nil
+}
+
+func (this *fakePoly) GetHeaderByHeight(height uint32) (*types.Header, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	header, ok := this.headers[height]
+	if !ok {
+		return nil, fmt.Errorf("unknown header %d", height)
+	}
+	// a copy, as a node serves, since the signatures are converted in place
+	h := *header
+	h.SigData = make([][]byte, len(header.SigData))
+	for i, sig := range header.SigData {
+		h.SigData[i] = append([]byte{}, sig...)
+	}
+	return &h, nil
+}
+
+func (this *fakePoly) GetMerkleProof(blockHeight, rootHeight uint32) (*sdkcom.MerkleProof, error) {
+	return &sdkcom.MerkleProof{Type: "MerkleProof"}, nil
+}
+
+func (this *fakePoly) GetSmartContractEvent(txHash string) (*sdkcom.SmartContactEvent, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.txEvents[txHash], nil
+}
+
+func (this *fakePoly) GetSmartContractEventByBlock(height uint32) ([]*sdkcom.SmartContactEvent, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return nil, errPolyDown
+	}
+	return this.events[height], nil
+}
+
+func (this *fakePoly) GetStorage(contractAddress string, key []byte) ([]byte, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.storage[hex.EncodeToString(key)], nil
+}
+
+func (this *fakePoly) ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+	relayerAddress []byte, headerOrCrossChainMsg []byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.down {
+		return pCommon.UINT256_EMPTY, errPolyDown
+	}
+	if this.importError != nil {
+		return pCommon.UINT256_EMPTY, this.importError
+	}
+	this.imports = append(this.imports, height)
+	return pCommon.Uint256{byte(len(this.imports))}, nil
+}
+
+func (this *fakePoly) SyncBlockHeader(chainId uint64, address pCommon.Address, headers [][]byte, signer *rsdk.Account) (pCommon.Uint256, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.syncedHeader = append(this.syncedHeader, headers...)
+	return pCommon.Uint256{0xff, byte(len(this.syncedHeader))}, nil
+}
+
+func (this *fakePoly) WaitForGenerateBlock(timeout time.Duration, blockCount ...uint32) (bool, error) {
+	return true, nil
+}
+
+// fakeHash makes a distinct 0x prefixed uint256 string from n
+func fakeHash(n uint32) string {
+	b := make([]byte, 32)
+	b[0], b[1], b[2], b[3] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+	return "0x" + helper.BytesToHex(b)
+}
+
+// newFakeService builds a service over fresh fakes and a temporary db
+func newFakeService(t *testing.T) (*SyncService, *fakeNeo, *fakePoly, func()) {
+	dir, err := ioutil.TempDir("", "neo-relayer-service")
+	assert.Nil(t, err)
+	boltDB, err := db.NewBoltDB(dir)
+	assert.Nil(t, err)
+	neoAccount, err := wallet.NewAccount()
+	assert.Nil(t, err)
+
+	neo, poly := newFakeNeo(), newFakePoly()
+	s := newSyncService(&rsdk.Account{}, poly, neoAccount, neo, boltDB, config.NewConfig())
+	return s, neo, poly, func() {
+		s.cancel()
+		boltDB.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+const (
+	PRIORITY_FEE = 0.001 // neo takes the txs paying at least this network fee as high priority
+	MEMPOOL_TTL  = 15    // seconds the mempool size is cached, about one neo block
+)
+
+// feePolicy estimates the network fee of the txs sent to neo, and keeps the fee of each tx made until it is sent
+type feePolicy struct {
+	neoSdk NeoClient
+	config *config.Config
+
+	lock      sync.Mutex
+	mempool   int
+	checkedAt int64
+	pending   map[string]helper.Fixed8 // fee of the txs made by hash, until they are sent or refused
+}
+
+func newFeePolicy(neoSdk NeoClient, cfg *config.Config) *feePolicy {
+	return &feePolicy{neoSdk: neoSdk, config: cfg, pending: make(map[string]helper.Fixed8)}
+}
+
+// netFee is the network fee the attempts-th retry of a tx starts from. It is NeoNetFee for the first try, and grows
+// by NeoFeeEscalation per failed attempt from at least PRIORITY_FEE.
+func (this *feePolicy) netFee(attempts uint32) helper.Fixed8 {
+	fee := this.config.NeoNetFee
+	if attempts == 0 || this.config.NeoFeeEscalation <= 0 {
+		return helper.Fixed8FromFloat64(fee)
+	}
+	if fee < PRIORITY_FEE {
+		fee = PRIORITY_FEE
+	}
+	return helper.Fixed8FromFloat64(fee * math.Pow(1+this.config.NeoFeeEscalation, float64(attempts)))
+}
+
+// estimate is the network fee of a tx of size starting from netFee. When neo is congested it is raised by
+// NeoFeePerByte times the size for every NeoCongestion txs in the mempool, to at least PRIORITY_FEE. It is kept
+// between NeoFeeMin and NeoFeeMax, and the size fee required by neo is paid on top.
+func (this *feePolicy) estimate(size int, netFee helper.Fixed8) helper.Fixed8 {
+	fee := helper.Fixed8ToFloat64(netFee)
+	if this.config.NeoFeePerByte > 0 {
+		congestion := this.config.NeoCongestion
+		if congestion == 0 {
+			congestion = config.DEFAULT_NEO_CONGESTION
+		}
+		if busy := this.mempoolSize() / int(congestion); busy > 0 {
+			fee += this.config.NeoFeePerByte * float64(size) * float64(busy)
+			if fee < PRIORITY_FEE {
+				fee = PRIORITY_FEE
+			}
+		}
+	}
+	if fee < this.config.NeoFeeMin {
+		fee = this.config.NeoFeeMin
+	}
+	if this.config.NeoFeeMax > 0 && fee > this.config.NeoFeeMax {
+		fee = this.config.NeoFeeMax
+	}
+	return helper.Fixed8FromFloat64(fee).Add(sizeFee(size))
+}
+
+// replaceFee is the system and network fee of the attempts-th replacement of a tx of size, which pays gas as system
+// fee and oldFee in all. It is more than oldFee by at least PRIORITY_FEE, false if NeoFeeMax does not allow it.
+func (this *feePolicy) replaceFee(size int, gas, oldFee helper.Fixed8, attempts uint32) (helper.Fixed8, bool) {
+	least := oldFee.Add(helper.Fixed8FromFloat64(PRIORITY_FEE))
+	fee := gas.Add(this.estimate(size, this.netFee(attempts)))
+	if !least.GreaterThan(fee) {
+		return fee, true
+	}
+	netFee := helper.Fixed8ToFloat64(least.Sub(gas).Sub(sizeFee(size)))
+	if this.config.NeoFeeMax > 0 && netFee > this.config.NeoFeeMax {
+		return oldFee, false
+	}
+	return least, true
+}
+
+// mempoolSize is the number of txs in the mempool of neo, the last one known if it can not be got
+func (this *feePolicy) mempoolSize() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now().Unix()
+	if now-this.checkedAt < MEMPOOL_TTL {
+		return this.mempool
+	}
+	response := this.neoSdk.GetRawMemPool()
+	if response.HasError() {
+		log.Errorf("[mempoolSize] neoSdk.GetRawMemPool error: %s", response.GetErrorInfo())
+		return this.mempool
+	}
+	this.mempool, this.checkedAt = len(response.Result), now
+	return this.mempool
+}
+
+// track keeps fee, the system and network fee of the tx of txHash, until it is sent or refused
+func (this *feePolicy) track(txHash string, fee helper.Fixed8) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.pending[txHash] = fee
+}
+
+// take returns and forgets the fee of the tx of txHash, false if it is not tracked
+func (this *feePolicy) take(txHash string) (helper.Fixed8, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	fee, ok := this.pending[txHash]
+	delete(this.pending, txHash)
+	return fee, ok
+}
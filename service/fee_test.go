@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeePolicy_netFee(t *testing.T) {
+	s, _, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoNetFee = 0
+
+	assert.Equal(t, helper.Zero, s.fees.netFee(3))
+	s.config.NeoFeeEscalation = 1
+	assert.Equal(t, helper.Zero, s.fees.netFee(0))
+	assert.Equal(t, helper.Fixed8FromFloat64(0.002), s.fees.netFee(1))
+	assert.Equal(t, helper.Fixed8FromFloat64(0.008), s.fees.netFee(3))
+	s.config.NeoNetFee = 0.01
+	assert.Equal(t, helper.Fixed8FromFloat64(0.01), s.fees.netFee(0))
+	assert.Equal(t, helper.Fixed8FromFloat64(0.02), s.fees.netFee(1))
+}
+
+func TestFeePolicy_estimate(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	netFee := helper.Fixed8FromFloat64(0.0001)
+
+	// the size fee of neo is paid on top
+	assert.Equal(t, netFee, s.fees.estimate(500, netFee))
+	assert.Equal(t, netFee.Add(sizeFee(2000)), s.fees.estimate(2000, netFee))
+
+	// congestion raises the fee by size, to at least the priority fee
+	s.config.NeoFeePerByte = 0.00001
+	s.config.NeoCongestion = 10
+	neoFake.mempool = make([]string, 9)
+	assert.Equal(t, netFee, s.fees.estimate(500, netFee))
+	neoFake.mempool = make([]string, 25)
+	s.fees.checkedAt = 0
+	assert.Equal(t, helper.Fixed8FromFloat64(0.0101), s.fees.estimate(500, netFee))
+	assert.Equal(t, helper.Fixed8FromFloat64(PRIORITY_FEE), s.fees.estimate(10, helper.Zero))
+
+	// the mempool size is cached
+	neoFake.mempool = nil
+	assert.Equal(t, helper.Fixed8FromFloat64(0.0101), s.fees.estimate(500, netFee))
+
+	// caps
+	s.config.NeoFeeMax = 0.005
+	assert.Equal(t, helper.Fixed8FromFloat64(0.005), s.fees.estimate(500, netFee))
+	assert.Equal(t, helper.Fixed8FromFloat64(0.005).Add(sizeFee(2000)), s.fees.estimate(2000, netFee))
+	s.fees.checkedAt = 0
+	s.config.NeoFeeMin = 0.0002
+	assert.Equal(t, helper.Fixed8FromFloat64(0.0002), s.fees.estimate(500, netFee))
+}
+
+func TestRelayToNeo_EscalatedFee(t *testing.T) {
+	s, _, _, clean := newRtonTestService(t)
+	defer clean()
+	s.config.NeoFeeEscalation = 1
+
+	retry := db.NewRetry(testPolyTxHeight, testUnlockKey)
+	retry.Attempts = 2
+	assert.Nil(t, s.retrySyncProofToNeo(retry, testPolyLastSynced))
+	assert.Equal(t, 1, len(s.utxos.changes))
+	var change *db.NeoChange
+	for _, c := range s.utxos.changes {
+		change = c
+	}
+
+	// the fee counted is the one paid, escalated from 0.001 to 0.004
+	fee := helper.Fixed8FromFloat64(testGasUnspent.Value).Value - change.Value
+	assert.Equal(t, fee, s.db.GetNeoFee(feeDay(time.Now())))
+	assert.True(t, fee >= helper.Fixed8FromFloat64(0.004).Value)
+	assert.Empty(t, s.fees.pending)
+}
+
+func TestSyncService_MakeInvocationTransaction(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	neoFake.unspents = []models.Unspent{testGasUnspent}
+	from, err := helper.AddressToScriptHash(s.neoAccount.Address)
+	assert.Nil(t, err)
+
+	// the tx is under 1024 bytes before its input, change and witness are added, and over it after
+	script := make([]byte, 900)
+	itx, err := s.MakeInvocationTransaction(script, from, nil, from, helper.Zero, helper.Zero)
+	assert.Nil(t, err)
+	unsigned := itx.Size()
+	assert.Nil(t, tx.AddSignature(itx, s.neoAccount.KeyPair))
+	assert.Equal(t, unsigned+WITNESS_SIZE, itx.Size())
+	assert.True(t, itx.Size() > 1024)
+	fee := helper.Fixed8FromFloat64(testGasUnspent.Value).Sub(itx.Outputs[0].Value)
+	assert.Equal(t, sizeFee(itx.Size()), fee)
+}
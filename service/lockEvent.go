@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+)
+
+const CROSS_CHAIN_LOCK_EVENT = "43726f7373436861696e4c6f636b4576656e74" // "CrossChainLockEvent"
+
+// ErrNotLockEvent is returned for the notifications of the CCMC which are events other than CrossChainLockEvent
+var ErrNotLockEvent = errors.New("not a CrossChainLockEvent")
+
+// CrossChainLockEvent is the event the neo CCMC emits for every cross chain tx
+type CrossChainLockEvent struct {
+	FromContract string // hex of the contract calling the CCMC, like a lock proxy
+	ToChainID    uint64
+	ToContract   string // hex of the contract on the target chain
+	Key          string // hex of the storage key of the tx: 0102 + toChainId + toRequestId, like 01020501
+	Param        []byte // serialized CrossChainTxParameter
+}
+
+// LockEventError is the error of a notification of the CCMC which is not a valid CrossChainLockEvent
+type LockEventError struct {
+	Field  string // the part of the event which can not be decoded, like "toChainId"
+	Reason string
+}
+
+func (this *LockEventError) Error() string {
+	return fmt.Sprintf("CrossChainLockEvent %s error: %s", this.Field, this.Reason)
+}
+
+func lockEventError(field, format string, a ...interface{}) *LockEventError {
+	return &LockEventError{Field: field, Reason: fmt.Sprintf(format, a...)}
+}
+
+// DecodeCrossChainLockEvent decodes the state of a notification of the CCMC. It returns ErrNotLockEvent if the
+// notification is another event, or a *LockEventError if it is a CrossChainLockEvent which can not be decoded.
+func DecodeCrossChainLockEvent(state models.InvokeStack) (*CrossChainLockEvent, error) {
+	if state.Type != "Array" {
+		return nil, lockEventError("state", "type is %s, not Array", state.Type)
+	}
+	states, err := stackItems(state)
+	if err != nil {
+		return nil, lockEventError("state", "%s", err)
+	}
+	if len(states) == 0 {
+		return nil, lockEventError("name", "no states")
+	}
+	name, err := stackBytes(states[0])
+	if err != nil {
+		return nil, lockEventError("name", "%s", err)
+	}
+	if helper.BytesToHex(name) != CROSS_CHAIN_LOCK_EVENT {
+		return nil, ErrNotLockEvent
+	}
+	if len(states) != 6 {
+		return nil, lockEventError("states", "%d states, not 6", len(states))
+	}
+
+	event := &CrossChainLockEvent{}
+	fromContract, err := stackBytes(states[1])
+	if err != nil {
+		return nil, lockEventError("fromContract", "%s", err)
+	}
+	if len(fromContract) != 20 {
+		return nil, lockEventError("fromContract", "%x is not a script hash", fromContract)
+	}
+	event.FromContract = helper.BytesToHex(fromContract)
+	event.ToChainID, err = stackUint64(states[2])
+	if err != nil {
+		return nil, lockEventError("toChainId", "%s", err)
+	}
+	toContract, err := stackBytes(states[3])
+	if err != nil {
+		return nil, lockEventError("toContract", "%s", err)
+	}
+	if len(toContract) == 0 {
+		return nil, lockEventError("toContract", "empty")
+	}
+	event.ToContract = helper.BytesToHex(toContract)
+	key, err := stackBytes(states[4])
+	if err != nil {
+		return nil, lockEventError("key", "%s", err)
+	}
+	if len(key) == 0 {
+		return nil, lockEventError("key", "empty")
+	}
+	event.Key = helper.BytesToHex(key)
+	event.Param, err = stackBytes(states[5])
+	if err != nil {
+		return nil, lockEventError("param", "%s", err)
+	}
+	return event, nil
+}
+
+// stackItems returns the items of an Array, whether it is converted or not
+func stackItems(state models.InvokeStack) ([]models.InvokeStack, error) {
+	switch value := state.Value.(type) {
+	case []models.InvokeStack:
+		return value, nil
+	case []interface{}:
+		items := make([]models.InvokeStack, len(value))
+		for i, v := range value {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("state %d is %T, not a stack item", i, v)
+			}
+			items[i].Type, _ = m["type"].(string)
+			items[i].Value = m["value"]
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("value is %T, not a list of stack items", state.Value)
+}
+
+// stackBytes reads a ByteArray
+func stackBytes(stack models.InvokeStack) ([]byte, error) {
+	if stack.Type != "ByteArray" {
+		return nil, fmt.Errorf("type is %s, not ByteArray", stack.Type)
+	}
+	value, ok := stack.Value.(string)
+	if !ok {
+		return nil, fmt.Errorf("value is %T, not a hex string", stack.Value)
+	}
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("value %s is not hex: %s", value, err)
+	}
+	return b, nil
+}
+
+// stackUint64 reads an Integer, or a ByteArray of a little endian integer
+func stackUint64(stack models.InvokeStack) (uint64, error) {
+	switch stack.Type {
+	case "Integer":
+		switch value := stack.Value.(type) {
+		case string:
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("value %s is not a uint64: %s", value, err)
+			}
+			return n, nil
+		case float64:
+			if value < 0 || value != float64(uint64(value)) {
+				return 0, fmt.Errorf("value %v is not a uint64", value)
+			}
+			return uint64(value), nil
+		}
+		return 0, fmt.Errorf("value is %T, not an integer", stack.Value)
+	case "ByteArray":
+		b, err := stackBytes(stack)
+		if err != nil {
+			return 0, err
+		}
+		n := helper.BigIntFromNeoBytes(b)
+		if !n.IsUint64() {
+			return 0, fmt.Errorf("value %x is not a uint64", b)
+		}
+		return n.Uint64(), nil
+	}
+	return 0, fmt.Errorf("type is %s, not Integer nor ByteArray", stack.Type)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/rpc"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/notify"
+	"github.com/stretchr/testify/assert"
+)
+
+// LOCK_TX_ENV is the hash of a lock tx on the neo testnet, whose application log TestDecodeCrossChainLockEvent_Live
+// decodes
+const LOCK_TX_ENV = "NEO_RELAYER_LOCK_TX"
+
+// loadAppLog reads the application log of a neo tx in testdata
+func loadAppLog(t *testing.T, name string) models.RpcApplicationLog {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	assert.Nil(t, err)
+	appLog := models.RpcApplicationLog{}
+	assert.Nil(t, json.Unmarshal(data, &appLog))
+	return appLog
+}
+
+func TestDecodeCrossChainLockEvent(t *testing.T) {
+	notifications := loadAppLog(t, "lock_event.json").Executions[0].Notifications
+
+	// the transfer of the asset and the LockEvent of the lock proxy are not CrossChainLockEvent
+	_, err := DecodeCrossChainLockEvent(notifications[0].State)
+	assert.Equal(t, ErrNotLockEvent, err)
+	_, err = DecodeCrossChainLockEvent(notifications[2].State)
+	assert.Equal(t, ErrNotLockEvent, err)
+
+	event, err := DecodeCrossChainLockEvent(notifications[1].State)
+	assert.Nil(t, err)
+	assert.Equal(t, "f5d8ba1e39f2e2dd2c1a6a2d4d1b2a4d5e0a8a3b", event.FromContract)
+	assert.Equal(t, uint64(2), event.ToChainID)
+	assert.Equal(t, "250e76987d838a75310c34bf422ea9f1ac4cc906", event.ToContract)
+	assert.Equal(t, "0102022a", event.Key)
+	param, err := DeserializeCrossChainTxParameter(event.Param, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "unlock", string(param.Method))
+	_, _, amount, err := DeserializeArgs(param.Args)
+	assert.Nil(t, err)
+	assert.Equal(t, "100000000", amount.String())
+	policyTx := lockEventPolicyTx(testNeoChainID, event)
+	assert.Equal(t, "unlock", policyTx.method)
+	assert.Equal(t, "c2c0fbc6ab68d5bd1e1f3bb3c8dd2b2e70f8d9b6", policyTx.assetHash)
+
+	// a state which is converted already
+	state := notifications[1].State
+	state.Convert()
+	converted, err := DecodeCrossChainLockEvent(state)
+	assert.Nil(t, err)
+	assert.Equal(t, event, converted)
+
+	// the to chain id as a little endian ByteArray
+	notifications = loadAppLog(t, "lock_event_bytes.json").Executions[0].Notifications
+	event, err = DecodeCrossChainLockEvent(notifications[0].State)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), event.ToChainID)
+	assert.Equal(t, "0102022a", event.Key)
+}
+
+func TestDecodeCrossChainLockEvent_Errors(t *testing.T) {
+	notifications := loadAppLog(t, "lock_event_bad.json").Executions[0].Notifications
+	cases := []struct {
+		field  string
+		reason string
+	}{
+		{"state", "type is ByteArray, not Array"},
+		{"states", "5 states, not 6"},
+		{"key", "value zz02022a is not hex: encoding/hex: invalid byte: U+007A 'z'"},
+		{"toChainId", `value -2 is not a uint64: strconv.ParseUint: parsing "-2": invalid syntax`},
+	}
+	for i, c := range cases {
+		_, err := DecodeCrossChainLockEvent(notifications[i].State)
+		lockErr, ok := err.(*LockEventError)
+		if assert.True(t, ok, "notification %d", i) {
+			assert.Equal(t, c.field, lockErr.Field)
+			assert.Equal(t, c.reason, lockErr.Reason)
+		}
+	}
+	_, err := DecodeCrossChainLockEvent(notifications[len(cases)].State)
+	assert.Nil(t, err)
+
+	short := models.InvokeStack{Type: "Array", Value: []interface{}{
+		map[string]interface{}{"type": "ByteArray", "value": CROSS_CHAIN_LOCK_EVENT},
+		map[string]interface{}{"type": "ByteArray", "value": "f5d8"},
+	}}
+	_, err = DecodeCrossChainLockEvent(short)
+	assert.EqualError(t, err, "CrossChainLockEvent states error: 2 states, not 6")
+
+	_, err = DecodeCrossChainLockEvent(models.InvokeStack{Type: "Array", Value: "00"})
+	assert.EqualError(t, err, "CrossChainLockEvent state error: value is string, not a list of stack items")
+}
+
+func TestNeoToRelay_BadLockEvent(t *testing.T) {
+	s, neoFake, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	txId := neoFake.blocks[1].Tx[0].Txid
+	neoFake.appLogs[txId] = loadAppLog(t, "lock_event_bad.json")
+	neoFake.proofs["0102022b"] = "00"
+
+	// the bad events are alerted, and the good one after them is relayed
+	assert.Nil(t, s.neoToRelay(0, 4))
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+	assert.Equal(t, 4, len(alerts))
+	for _, alert := range alerts {
+		assert.Equal(t, EVENT_LOCK_EVENT, alert.Event)
+	}
+	assert.Contains(t, alerts[0].Message, "notification: 0, CrossChainLockEvent state error")
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+}
+
+// TestDecodeCrossChainLockEvent_Live decodes the application log of a lock tx on chain. It logs the log, which is
+// what testdata/lock_event.json should be replaced with, see testdata/README.md.
+func TestDecodeCrossChainLockEvent_Live(t *testing.T) {
+	liveTest(t)
+	txId := os.Getenv(LOCK_TX_ENV)
+	if txId == "" {
+		t.Skipf("set %s to the hash of a lock tx calling the neo CCMC", LOCK_TX_ENV)
+	}
+	client := rpc.NewClient("http://seed10.ngd.network:20332")
+	response := client.GetApplicationLog(txId)
+	if !assert.False(t, response.HasError(), response.GetErrorInfo()) {
+		return
+	}
+	events := 0
+	for _, execution := range response.Result.Executions {
+		for i, ntf := range execution.Notifications {
+			event, err := DecodeCrossChainLockEvent(ntf.State)
+			if err == ErrNotLockEvent {
+				continue
+			}
+			if assert.Nil(t, err, "notification %d", i) {
+				t.Logf("notification %d: %+v", i, event)
+				events++
+			}
+		}
+	}
+	assert.NotZero(t, events)
+	data, err := json.MarshalIndent(response.Result, "", "  ")
+	assert.Nil(t, err)
+	t.Logf("application log of %s:\n%s", txId, data)
+}
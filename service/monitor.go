@@ -0,0 +1,50 @@
+package service
+
+import (
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+)
+
+// Monitor collects the metrics which are not updated by the sync loops
+func (this *SyncService) Monitor() {
+	interval := this.config.MonitorInterval
+	if interval == 0 {
+		interval = config.DEFAULT_MONITOR_INTERVAL
+	}
+	for {
+		this.collectMetrics()
+		if !this.sleep(time.Duration(interval) * time.Second) {
+			return
+		}
+	}
+}
+
+func (this *SyncService) collectMetrics() {
+	metrics.NeoFeeSpent.Set(helper.Fixed8ToFloat64(helper.NewFixed8(this.db.GetNeoFee(feeDay(time.Now())))))
+	for _, bucket := range [][]byte{db.BKTCheck, db.BKTRetry, db.BKTNeoCheck, db.BKTNeoChange, db.BKTNeoRetry, db.BKTDeadLetter} {
+		n, err := this.db.Count(bucket)
+		if err != nil {
+			log.Errorf("[collectMetrics] this.db.Count error: %s", err)
+			continue
+		}
+		metrics.BucketSize.WithLabelValues(string(bucket)).Set(float64(n))
+	}
+
+	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
+	if err != nil {
+		log.Errorf("[collectMetrics] AddressToScriptHash error: %s", err)
+		return
+	}
+	_, balance, err := this.GetBalance(from, tx.GasToken)
+	if err != nil {
+		log.Errorf("[collectMetrics] this.GetBalance error: %s", err)
+		return
+	}
+	metrics.GasBalance.Set(helper.Fixed8ToFloat64(balance))
+}
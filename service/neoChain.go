@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/notify"
+)
+
+// verifyNeoChain checks the last neo block scanned against its hash kept, in case the node serves a different chain,
+// after a resync or when it is failed over. The scan is rewound to the block after the last one both chains share.
+// The next consensus is taken again from the last block scanned on the chain of the node.
+func (this *SyncService) verifyNeoChain() error {
+	height := this.relaySyncHeight
+	if height == 0 {
+		this.neoNextConsensus = ""
+		return nil
+	}
+	blk, err := this.getNeoBlock(height - 1)
+	if err != nil {
+		return fmt.Errorf("[verifyNeoChain] %s", err)
+	}
+	if hash := this.db.GetNeoHash(height - 1); hash != "" && hash != blk.Hash {
+		ancestor, err := this.findNeoAncestor(height - 1)
+		if err != nil {
+			this.alert(notify.CRITICAL, EVENT_NEO_FORK, "neo node serves a different chain at height %d, "+
+				"the scan can not be rewound: %s", height-1, err)
+			return fmt.Errorf("[verifyNeoChain] findNeoAncestor error: %s", err)
+		}
+		this.alert(notify.CRITICAL, EVENT_NEO_FORK, "neo node serves a different chain from height %d, "+
+			"the scan is rewound from %d", ancestor+1, height)
+		if err := this.db.DeleteNeoHashFrom(ancestor + 1); err != nil {
+			return fmt.Errorf("[verifyNeoChain] this.db.DeleteNeoHashFrom error: %s", err)
+		}
+		this.putRelaySyncHeight(ancestor + 1)
+		if blk, err = this.getNeoBlock(ancestor); err != nil {
+			return fmt.Errorf("[verifyNeoChain] %s", err)
+		}
+	}
+	this.neoNextConsensus = blk.NextConsensus
+	return nil
+}
+
+// findNeoAncestor returns the highest height below height where the block of the node is the one scanned
+func (this *SyncService) findNeoAncestor(height uint32) (uint32, error) {
+	for height > 0 {
+		height--
+		hash := this.db.GetNeoHash(height)
+		if hash == "" {
+			return 0, fmt.Errorf("no hash is kept at height %d", height)
+		}
+		blk, err := this.getNeoBlock(height)
+		if err != nil {
+			return 0, err
+		}
+		if blk.Hash == hash {
+			return height, nil
+		}
+		log.Warnf("[findNeoAncestor] neo block %d is %s, %s is scanned", height, blk.Hash, hash)
+	}
+	return 0, fmt.Errorf("genesis block differs")
+}
+
+// keepNeoHash keeps the hash of blk which is scanned, it fails if blk is not on the chain scanned before
+func (this *SyncService) keepNeoHash(height uint32, blk *models.RpcBlock) error {
+	if height > 0 {
+		if hash := this.db.GetNeoHash(height - 1); hash != "" && hash != blk.PreviousBlockHash {
+			return fmt.Errorf("previous hash %s of neo block %d is not %s scanned, the node serves a different chain",
+				blk.PreviousBlockHash, height, hash)
+		}
+	}
+	window := this.config.NeoHashWindow
+	if window == 0 {
+		window = config.DEFAULT_NEO_HASH_WINDOW
+	}
+	if err := this.db.PutNeoHash(height, blk.Hash, window); err != nil {
+		log.Errorf("[keepNeoHash] this.db.PutNeoHash error: %s, height: %d", err, height)
+	}
+	return nil
+}
+
+// getNeoBlock gets the neo block at height
+func (this *SyncService) getNeoBlock(height uint32) (models.RpcBlock, error) {
+	response := this.neoSdk.GetBlockByIndex(height)
+	if response.HasError() {
+		return models.RpcBlock{}, fmt.Errorf("neoSdk.GetBlockByIndex error: %s, height: %d", response.GetErrorInfo(), height)
+	}
+	if response.Result.Hash == "" {
+		return models.RpcBlock{}, fmt.Errorf("neoSdk.GetBlockByIndex returns an empty block, height: %d", height)
+	}
+	return response.Result, nil
+}
+
+// confirmedHeight is where the scan of the neo blocks below height stops, so they have confirmations more blocks on
+// top of them
+func confirmedHeight(height, confirmations uint32) uint32 {
+	if height < confirmations {
+		return 0
+	}
+	return height - confirmations
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	neoRpc "github.com/joeqian10/neo-gogogo/rpc"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+)
+
+// NeoPool is a NeoClient sending every request to the fastest node in sync, and failing over to the next one
+// when the node can not be reached. Nodes whose block count or state height is behind the others are not used
+// until they catch up.
+type NeoPool struct {
+	nodes   *rpcNodes
+	clients []NeoClient
+}
+
+// NewNeoPool connects the neo nodes at urls, and checks them once
+func NewNeoPool(urls []string, maxLag uint32) *NeoPool {
+	clients := make([]NeoClient, len(urls))
+	for i, url := range urls {
+		clients[i] = neoRpc.NewClient(url)
+	}
+	pool := newNeoPool(urls, clients, maxLag)
+	pool.CheckNodes()
+	return pool
+}
+
+func newNeoPool(urls []string, clients []NeoClient, maxLag uint32) *NeoPool {
+	if maxLag == 0 {
+		maxLag = config.DEFAULT_NEO_MAX_LAG
+	}
+	return &NeoPool{nodes: newRpcNodes(metrics.CHAIN_NEO, urls, maxLag), clients: clients}
+}
+
+// CheckNodes refreshes the block count, the state height and the latency of every node, and marks the ones behind
+func (this *NeoPool) CheckNodes() {
+	this.nodes.check(func(i int) nodeCheck {
+		res := this.clients[i].GetBlockCount()
+		if res.HasError() {
+			log.Warnf("[CheckNodes] neo node %s GetBlockCount error: %s", this.nodes.nodes[i].url, res.GetErrorInfo())
+			return nodeCheck{}
+		}
+		res2 := this.clients[i].GetStateHeight()
+		if res2.HasError() {
+			log.Warnf("[CheckNodes] neo node %s GetStateHeight error: %s", this.nodes.nodes[i].url, res2.GetErrorInfo())
+			return nodeCheck{}
+		}
+		return nodeCheck{heights: []uint64{uint64(res.Result), uint64(res2.Result.StateHeight)}, up: true}
+	})
+}
+
+// call sends request to the nodes in turn until one of them is reached, rpc errors are answers of the node
+func (this *NeoPool) call(method string, request func(NeoClient) *neoRpc.ErrorResponse) {
+	this.nodes.call(method, func(i int) (error, bool) {
+		res := request(this.clients[i])
+		return res.NetError, res.NetError == nil
+	})
+}
+
+func (this *NeoPool) GetApplicationLog(txId string) (response neoRpc.GetApplicationLogResponse) {
+	this.call("getapplicationlog", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetApplicationLog(txId)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetBlockByIndex(index uint32) (response neoRpc.GetBlockResponse) {
+	this.call("getblock", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetBlockByIndex(index)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetBlockCount() (response neoRpc.GetBlockCountResponse) {
+	this.call("getblockcount", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetBlockCount()
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetBlockHeaderByIndex(index uint32) (response neoRpc.GetBlockHeaderResponse) {
+	this.call("getblockheader", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetBlockHeaderByIndex(index)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetBlockHeaderByHash(hash string) (response neoRpc.GetBlockHeaderResponse) {
+	this.call("getblockheader", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetBlockHeaderByHash(hash)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetProof(stateRoot, contractScriptHash, storeKey string) (response neoRpc.CrossChainProofResponse) {
+	this.call("getproof", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetProof(stateRoot, contractScriptHash, storeKey)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetRawMemPool() (response neoRpc.GetRawMemPoolResponse) {
+	this.call("getrawmempool", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetRawMemPool()
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetRawTransaction(txId string) (response neoRpc.GetRawTransactionResponse) {
+	this.call("getrawtransaction", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetRawTransaction(txId)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetStateHeight() (response neoRpc.StateHeightResponse) {
+	this.call("getstateheight", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetStateHeight()
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetStateRootByIndex(height uint32) (response neoRpc.StateRootResponse) {
+	this.call("getstateroot", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetStateRootByIndex(height)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetStorage(scriptHash string, key string) (response neoRpc.GetStorageResponse) {
+	this.call("getstorage", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetStorage(scriptHash, key)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) GetUnspents(address string) (response neoRpc.GetUnspentsResponse) {
+	this.call("getunspents", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.GetUnspents(address)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) InvokeScript(script string, checkWitnessHashes string) (response neoRpc.InvokeScriptResponse) {
+	this.call("invokescript", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.InvokeScript(script, checkWitnessHashes)
+		return &response.ErrorResponse
+	})
+	return
+}
+
+func (this *NeoPool) SendRawTransaction(rawTx string) (response neoRpc.SendRawTransactionResponse) {
+	this.call("sendrawtransaction", func(c NeoClient) *neoRpc.ErrorResponse {
+		response = c.SendRawTransaction(rawTx)
+		return &response.ErrorResponse
+	})
+	return
+}
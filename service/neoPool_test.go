@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNeoPool(fakes ...*fakeNeo) *NeoPool {
+	urls := make([]string, len(fakes))
+	clients := make([]NeoClient, len(fakes))
+	for i, fake := range fakes {
+		urls[i] = string(rune('a' + i))
+		clients[i] = fake
+	}
+	pool := newNeoPool(urls, clients, 0)
+	pool.CheckNodes()
+	return pool
+}
+
+func TestNeoPool_Failover(t *testing.T) {
+	a, b := newFakeNeo(), newFakeNeo()
+	for i := uint32(0); i < 3; i++ {
+		a.blocks[i], b.blocks[i] = neoBlock(i, 1), neoBlock(i, 1)
+	}
+	a.down = true
+	pool := newTestNeoPool(a, b)
+	assert.False(t, pool.nodes.nodes[0].up)
+	assert.True(t, pool.nodes.nodes[1].up)
+
+	response := pool.GetBlockByIndex(2)
+	assert.False(t, response.HasError())
+	assert.Equal(t, 2, response.Result.Index)
+
+	// b goes down between two checks, a is still tried
+	a.down, b.down = false, true
+	response = pool.GetBlockByIndex(1)
+	assert.False(t, response.HasError())
+	assert.Equal(t, 1, response.Result.Index)
+	assert.True(t, pool.nodes.nodes[0].up)
+	assert.False(t, pool.nodes.nodes[1].up)
+
+	// rpc errors are answers, not failures of the node
+	response = pool.GetBlockByIndex(5)
+	assert.True(t, response.HasError())
+	assert.Nil(t, response.NetError)
+	assert.True(t, pool.nodes.nodes[0].up)
+
+	a.down = true
+	response = pool.GetBlockByIndex(1)
+	assert.NotNil(t, response.NetError)
+}
+
+func TestNeoPool_Behind(t *testing.T) {
+	a, b, c := newFakeNeo(), newFakeNeo(), newFakeNeo()
+	for i := uint32(0); i < 10; i++ {
+		a.blocks[i], c.blocks[i] = neoBlock(i, 1), neoBlock(i, 1)
+		if i < 5 {
+			b.blocks[i] = neoBlock(i, 1)
+		}
+	}
+	a.stateHeight, b.stateHeight, c.stateHeight = 9, 4, 3
+	pool := newTestNeoPool(a, b, c)
+	assert.False(t, pool.nodes.nodes[0].behind)
+	assert.True(t, pool.nodes.nodes[1].behind) // block count
+	assert.True(t, pool.nodes.nodes[2].behind) // state height
+	assert.Equal(t, 1, len(pool.nodes.candidates()))
+
+	// nodes behind are not used even if the only one in sync is down
+	a.down = true
+	response := pool.GetBlockByIndex(3)
+	assert.NotNil(t, response.NetError)
+
+	// and are used again once they catch up
+	for i := uint32(5); i < 10; i++ {
+		b.blocks[i] = neoBlock(i, 1)
+	}
+	b.stateHeight = 8
+	pool.CheckNodes()
+	assert.False(t, pool.nodes.nodes[1].behind)
+	response = pool.GetBlockByIndex(7)
+	assert.False(t, response.HasError())
+	assert.Equal(t, 7, response.Result.Index)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+)
+
+// nodeChecker is implemented by the clients which spread the requests over several nodes
+type nodeChecker interface {
+	CheckNodes()
+}
+
+// rpcNode is an rpc node and its health seen by the last check and requests
+type rpcNode struct {
+	url       string
+	heights   []uint64 // heights reported by the last check, like block count and state height
+	latency   time.Duration
+	up        bool // reachable, set by every check and request
+	behind    bool // one of the heights behind the best node, set by every check
+	unchecked bool // the chain is not checked yet as the node was not reached at startup, it is sent no request
+}
+
+// nodeCheck is the result of checking one node
+type nodeCheck struct {
+	heights []uint64
+	latency time.Duration
+	up      bool
+}
+
+// rpcNodes tracks the nodes of a chain, and orders them for every request
+type rpcNodes struct {
+	lock   sync.RWMutex
+	chain  string
+	nodes  []*rpcNode
+	maxLag uint32
+}
+
+func newRpcNodes(chain string, urls []string, maxLag uint32) *rpcNodes {
+	this := &rpcNodes{chain: chain, maxLag: maxLag}
+	for _, url := range urls {
+		this.nodes = append(this.nodes, &rpcNode{url: url})
+	}
+	return this
+}
+
+// add adds a node whose chain is not checked yet, and returns its index
+func (this *rpcNodes) add(url string) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.nodes = append(this.nodes, &rpcNode{url: url, unchecked: true})
+	return len(this.nodes) - 1
+}
+
+// isChecked reports whether the chain of node i is checked
+func (this *rpcNodes) isChecked(i int) bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return !this.nodes[i].unchecked
+}
+
+// setChecked marks the chain of node i checked, so it is sent requests
+func (this *rpcNodes) setChecked(i int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.nodes[i].unchecked = false
+}
+
+// check runs check on every node at the same time, then marks the nodes behind the best one
+func (this *rpcNodes) check(check func(i int) nodeCheck) {
+	results := make([]nodeCheck, len(this.nodes))
+	var wg sync.WaitGroup
+	for i := range this.nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = check(i)
+			results[i].latency = time.Since(start) / time.Duration(len(results[i].heights)+1)
+		}(i)
+	}
+	wg.Wait()
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var best []uint64
+	for i, node := range this.nodes {
+		node.up = results[i].up
+		if !node.up {
+			continue
+		}
+		node.heights, node.latency = results[i].heights, results[i].latency
+		for j, height := range node.heights {
+			if j == len(best) {
+				best = append(best, 0)
+			}
+			if height > best[j] {
+				best[j] = height
+			}
+		}
+	}
+	for _, node := range this.nodes {
+		if node.up {
+			node.behind = false
+			for j, height := range node.heights {
+				if best[j]-height > uint64(this.maxLag) {
+					node.behind = true
+					log.Warnf("[CheckNodes] %s node %s is behind, heights: %v, best: %v", this.chain, node.url, node.heights, best)
+					break
+				}
+			}
+		}
+		if len(node.heights) > 0 {
+			metrics.NodeHeight.WithLabelValues(this.chain, node.url).Set(float64(node.heights[0]))
+		}
+		if node.up && !node.behind {
+			metrics.NodeUp.WithLabelValues(this.chain, node.url).Set(1)
+		} else {
+			metrics.NodeUp.WithLabelValues(this.chain, node.url).Set(0)
+		}
+	}
+}
+
+// candidates orders the indexes of the nodes to try, the reachable ones by latency first, the ones behind or unchecked
+// never
+func (this *rpcNodes) candidates() []int {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	indexes := make([]int, 0, len(this.nodes))
+	for i, node := range this.nodes {
+		if !node.behind && !node.unchecked {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 { // the best node is never behind, unless no node is ever reached
+		for i, node := range this.nodes {
+			if !node.unchecked {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := this.nodes[indexes[i]], this.nodes[indexes[j]]
+		if a.up != b.up {
+			return a.up
+		}
+		return a.latency < b.latency
+	})
+	return indexes
+}
+
+// call sends request to the candidates in turn, until one of them is reached. request returns the error of the
+// node, and whether the node answered it, like an rpc error, so the request should not be sent to another one
+func (this *rpcNodes) call(method string, request func(i int) (err error, answered bool)) error {
+	err := fmt.Errorf("no %s node", this.chain)
+	for _, i := range this.candidates() {
+		start := time.Now()
+		var answered bool
+		err, answered = request(i)
+		latency := time.Since(start)
+
+		node := this.nodes[i]
+		this.lock.Lock()
+		node.up = err == nil || answered
+		if node.up {
+			node.latency = (node.latency*3 + latency) / 4
+		}
+		this.lock.Unlock()
+		if node.up {
+			return err
+		}
+		log.Warnf("[%s] %s to %s node %s error: %s, failing over", this.chain, method, this.chain, node.url, err)
+	}
+	return err
+}
@@ -19,21 +19,37 @@ import (
 
 // GetCurrentRelayChainSyncHeight :get the synced NEO blockHeight from Relay Chain
 func (this *SyncService) GetCurrentRelayChainSyncHeight(neoChainID uint64) (uint32, error) {
+	neoConsensusPeer, err := this.getNeoConsensus(neoChainID)
+	if err != nil {
+		return 0, err
+	}
+	if neoConsensusPeer == nil {
+		return 0, fmt.Errorf("no neo consensus peer on relay chain")
+	}
+
+	height := neoConsensusPeer.Height
+	height++
+	return height, nil
+}
+
+// getNeoConsensus gets the neo consensus kept by the header sync contract of Relay Chain, which is set by the last key
+// header synced. It is nil if no header of NEO is synced.
+func (this *SyncService) getNeoConsensus(neoChainID uint64) (*neo.NeoConsensus, error) {
 	contractAddress := relayUtils.HeaderSyncContractAddress
 	neoChainIDBytes := common.GetUint64Bytes(neoChainID)
 	key := common.ConcatKey([]byte(hsCommon.CONSENSUS_PEER), neoChainIDBytes)
-	value, err := this.relaySdk.ClientMgr.GetStorage(contractAddress.ToHexString(), key)
+	value, err := this.relaySdk.GetStorage(contractAddress.ToHexString(), key)
 	if err != nil {
-		return 0, fmt.Errorf("getStorage error: %s", err)
+		return nil, fmt.Errorf("getStorage error: %s", err)
+	}
+	if len(value) == 0 {
+		return nil, nil
 	}
 	neoConsensusPeer := new(neo.NeoConsensus)
 	if err := neoConsensusPeer.Deserialization(pCommon.NewZeroCopySource(value)); err != nil {
-		return 0, fmt.Errorf("neoconsensus peer deserialize err: %s", err)
+		return nil, fmt.Errorf("neoconsensus peer deserialize err: %s", err)
 	}
-
-	height := neoConsensusPeer.Height
-	height++
-	return height, nil
+	return neoConsensusPeer, nil
 }
 
 //syncHeaderToRelay : Sync NEO block head to Relay Chain
@@ -63,7 +79,7 @@ func (this *SyncService) syncHeaderToRelay(height uint32) error {
 	var txHash pCommon.Uint256
 	var txErr error
 	//Sending transaction to Relay Chain
-	txHash, txErr = this.relaySdk.Native.Hs.SyncBlockHeader(this.config.NeoChainID, this.relayAccount.Address, [][]byte{header}, this.relayAccount)
+	txHash, txErr = this.relaySdk.SyncBlockHeader(this.config.NeoChainID, this.relayAccount.Address, [][]byte{header}, this.relayAccount)
 	if txErr != nil {
 		return fmt.Errorf("[syncHeaderToRelay] relaySdk.SyncBlockHeader error: %s, neo header: %s", txErr, helper.BytesToHex(header))
 	}
@@ -75,66 +91,46 @@ func (this *SyncService) syncHeaderToRelay(height uint32) error {
 
 //syncProofToRelay : send StateRoot Proof to Relay Chain
 func (this *SyncService) syncProofToRelay(key string, height uint32) error {
-	retry := &db.Retry{
-		Height: height,
-		Key:    key,
-	}
-	sink := pCommon.NewZeroCopySink(nil)
-	retry.Serialization(sink)
+	retry := db.NewRetry(height, key)
 
 	//get current state height
 	var stateHeight uint32 = 0
 	for stateHeight < height {
+		if this.isStopped() {
+			this.db.PutRetry(retry)
+			return fmt.Errorf("[syncProofToRelay] service stopped before state height reached %d", height)
+		}
 		res := this.neoSdk.GetStateHeight()
 		if res.HasError() {
-			this.db.PutRetry(sink.Bytes())
-			return fmt.Errorf("[syncProofToRelay] neoSdk.GetStateHeight error: %s", res.Error.Message)
+			err := fmt.Errorf("[syncProofToRelay] neoSdk.GetStateHeight error: %s", res.Error.Message)
+			this.failRetry(NTOR, retry, err)
+			return err
 		}
 		stateHeight = res.Result.StateHeight
+		if stateHeight < height {
+			this.sleep(time.Second) // the loop checks isStopped
+		}
 	}
 
-	// get state root
-	res2 := this.neoSdk.GetStateRootByIndex(height)
-	if res2.HasError() {
-		this.db.PutRetry(sink.Bytes())
-		return fmt.Errorf("[syncProofToRelay] neoSdk.GetStateRootByIndex error: %s", res2.Error.Message)
-	}
-	stateRoot := res2.Result.StateRoot
-	buff := io.NewBufBinaryWriter()
-	stateRoot.Serialize(buff.BinaryWriter)
-	crossChainMsg := buff.Bytes()
-	//fmt.Printf("stateroot: %v", stateRoot)
-
-	// get proof
-	res3 := this.neoSdk.GetProof(stateRoot.StateRoot, "0x"+helper.ReverseString(this.config.NeoCCMC), key)
-	if res3.HasError() {
-		return fmt.Errorf("[syncProofToRelay] neoSdk.GetProof error: %s", res3.Error.Message)
-	}
-	proof, err := hex.DecodeString(res3.CrosschainProof.Proof)
-	if err != nil {
-		return fmt.Errorf("[syncProofToRelay] decode proof error: %s", err)
-	}
-	//log.Info(stateRoot.StateRoot, "0x"+helper.ReverseString(this.config.NeoCCMC), key)
-
-	//sending SyncProof transaction to Relay Chain
-	txHash, err := this.relaySdk.Native.Ccm.ImportOuterTransfer(this.config.NeoChainID, nil, height, proof, this.relayAccount.Address[:], crossChainMsg, this.relayAccount)
+	txHash, err := this.importProofToRelay(retry)
 	if err != nil {
-		if strings.Contains(err.Error(), "chooseUtxos, current utxo is not enough") {
+		if isLackOfFee(err) {
 			log.Infof("[syncProofToRelay] invokeNativeContract error: %s", err)
-
-			err = this.db.PutRetry(sink.Bytes())
+			err = this.postponeRetry(NTOR, retry, err)
 			if err != nil {
 				return fmt.Errorf("[syncProofToRelay] this.db.PutRetry error: %s", err)
 			}
 			log.Infof("[syncProofToRelay] put tx into retry db, height %d, key %s", height, key)
 			return nil
-		} else if strings.Contains(err.Error(), "checkDoneTx, tx already done") {
-			return fmt.Errorf("[syncProofToRelay] invokeNativeContract error: %s", err)
-		} else {
-			return fmt.Errorf("[syncProofToRelay] invokeNativeContract error: %s, crossChainMsg: %s, proof: %s", err, helper.BytesToHex(crossChainMsg), helper.BytesToHex(proof))
+		} else if strings.Contains(err.Error(), TX_ALREADY_DONE) {
+			return fmt.Errorf("[syncProofToRelay] %s", err)
 		}
+		this.failRetry(NTOR, retry, err)
+		return fmt.Errorf("[syncProofToRelay] %s", err)
 	}
 
+	sink := pCommon.NewZeroCopySink(nil)
+	retry.Serialization(sink)
 	err = this.db.PutCheck(txHash.ToHexString(), sink.Bytes())
 	if err != nil {
 		return fmt.Errorf("[syncProofToRelay] this.db.PutCheck error: %s", err)
@@ -144,17 +140,12 @@ func (this *SyncService) syncProofToRelay(key string, height uint32) error {
 	return nil
 }
 
-func (this *SyncService) retrySyncProofToRelay(v []byte) error {
-	retry := new(db.Retry)
-	err := retry.Deserialization(pCommon.NewZeroCopySource(v))
-	if err != nil {
-		return fmt.Errorf("[retrySyncProofToRelay] retry.Deserialization error: %s", err)
-	}
-
+// importProofToRelay sends the state root and the storage proof of retry to the relay chain
+func (this *SyncService) importProofToRelay(retry *db.Retry) (pCommon.Uint256, error) {
 	// get state root
 	res2 := this.neoSdk.GetStateRootByIndex(retry.Height)
 	if res2.HasError() {
-		return fmt.Errorf("[retrySyncProofToRelay] neoSdk.GetStateRootByIndex error: %s", res2.Error.Message)
+		return pCommon.UINT256_EMPTY, fmt.Errorf("neoSdk.GetStateRootByIndex error: %s", res2.Error.Message)
 	}
 	stateRoot := res2.Result.StateRoot
 	buff := io.NewBufBinaryWriter()
@@ -164,36 +155,62 @@ func (this *SyncService) retrySyncProofToRelay(v []byte) error {
 	// get proof
 	res3 := this.neoSdk.GetProof(stateRoot.StateRoot, "0x"+helper.ReverseString(this.config.NeoCCMC), retry.Key)
 	if res3.HasError() {
-		return fmt.Errorf("[retrySyncProofToRelay] neoSdk.GetProof error: %s", res3.Error.Message)
+		return pCommon.UINT256_EMPTY, fmt.Errorf("neoSdk.GetProof error: %s", res3.Error.Message)
 	}
 	proof, err := hex.DecodeString(res3.CrosschainProof.Proof)
 	if err != nil {
-		return fmt.Errorf("[retrySyncProofToRelay] decode proof error: %s", err)
+		return pCommon.UINT256_EMPTY, fmt.Errorf("decode proof error: %s", err)
 	}
 
-	txHash, err := this.relaySdk.Native.Ccm.ImportOuterTransfer(this.config.NeoChainID, nil, retry.Height, proof, this.relayAccount.Address[:], crossChainMsg, this.relayAccount)
+	//sending SyncProof transaction to Relay Chain
+	txHash, err := this.relaySdk.ImportOuterTransfer(this.config.NeoChainID, nil, retry.Height, proof, this.relayAccount.Address[:], crossChainMsg, this.relayAccount)
 	if err != nil {
-		if strings.Contains(err.Error(), "chooseUtxos, current utxo is not enough") {
-			log.Infof("[retrySyncProofToRelay] invokeNativeContract error: %s", err)
-			return nil
-		} else {
-			if err := this.db.DeleteRetry(v); err != nil {
-				return fmt.Errorf("[retrySyncProofToRelay] this.db.DeleteRetry error: %s", err)
-			}
-			return fmt.Errorf("[retrySyncProofToRelay] invokeNativeContract error: %s", err)
+		if isLackOfFee(err) || strings.Contains(err.Error(), TX_ALREADY_DONE) {
+			return pCommon.UINT256_EMPTY, fmt.Errorf("invokeNativeContract error: %s", err)
 		}
+		return pCommon.UINT256_EMPTY, fmt.Errorf("invokeNativeContract error: %s, crossChainMsg: %s, proof: %s", err, helper.BytesToHex(crossChainMsg), helper.BytesToHex(proof))
 	}
+	this.setAlertLevel(EVENT_RELAY_FEE, "", "relay account %s pays the fee again", this.relayAccount.Address.ToBase58())
+	return txHash, nil
+}
 
-	err = this.db.PutCheck(txHash.ToHexString(), v)
-	if err != nil {
-		return fmt.Errorf("[retrySyncProofToRelay] this.db.PutCheck error: %s", err)
+// RelayNeoTx relays the cross chain txs in the neo tx with txId, no matter which height is being scanned
+func (this *SyncService) RelayNeoTx(txId string) error {
+	if !strings.HasPrefix(txId, "0x") {
+		txId = "0x" + txId
 	}
-	err = this.db.DeleteRetry(v)
-	if err != nil {
-		return fmt.Errorf("[retrySyncProofToRelay] this.db.DeleteRetry error: %s", err)
+	response := this.neoSdk.GetRawTransaction(txId)
+	if response.HasError() {
+		return fmt.Errorf("[RelayNeoTx] neoSdk.GetRawTransaction error: %s", response.Error.Message)
+	}
+	if response.Result.BlockHash == "" {
+		return fmt.Errorf("[RelayNeoTx] tx %s is not in a block yet", txId)
 	}
+	response2 := this.neoSdk.GetBlockHeaderByHash(response.Result.BlockHash)
+	if response2.HasError() {
+		return fmt.Errorf("[RelayNeoTx] neoSdk.GetBlockHeaderByHash error: %s", response2.Error.Message)
+	}
+	height := uint32(response2.Result.Index)
+	log.Infof("[RelayNeoTx] relay neo tx %s at height %d", txId, height)
+	return this.relayNeoTx(txId, height)
+}
 
-	log.Infof("[retrySyncProofToRelay] syncProofToAlia txHash is :", txHash.ToHexString())
+// retrySyncProofToRelay makes one attempt of retry, and settles it in the Retry bucket
+func (this *SyncService) retrySyncProofToRelay(retry *db.Retry) error {
+	txHash, err := this.importProofToRelay(retry)
+	if err == nil {
+		sink := pCommon.NewZeroCopySink(nil)
+		retry.Serialization(sink)
+		err = this.db.PutCheck(txHash.ToHexString(), sink.Bytes())
+		if err != nil {
+			return fmt.Errorf("[retrySyncProofToRelay] this.db.PutCheck error: %s", err)
+		}
+		log.Infof("[retrySyncProofToRelay] polyTxHash is: %s", txHash.ToHexString())
+	}
+	err = this.settleRetry(NTOR, retry, err)
+	if err != nil {
+		return fmt.Errorf("[retrySyncProofToRelay] %s", err)
+	}
 	return nil
 }
 
@@ -220,9 +237,12 @@ func (this *SyncService) checkDoneTx() error {
 		}
 		if event.State != 1 {
 			log.Infof("[checkDoneTx] state of tx %s is not success", k)
-			err := this.db.PutRetry(v)
+			retry := new(db.Retry)
+			err := retry.Deserialization(pCommon.NewZeroCopySource(v))
 			if err != nil {
-				log.Errorf("[checkDoneTx] this.db.PutRetry error:%s", err)
+				log.Errorf("[checkDoneTx] retry.Deserialization error:%s", err)
+			} else if err = this.failRetry(NTOR, retry, fmt.Errorf("state of poly tx %s is not success", k)); err != nil {
+				log.Errorf("[checkDoneTx] this.failRetry error:%s", err)
 			}
 		}
 		err = this.db.DeleteCheck(k)
@@ -239,12 +259,22 @@ func (this *SyncService) retryTx() error {
 	if err != nil {
 		return fmt.Errorf("[retryTx] this.db.GetAllRetry error: %s", err)
 	}
-	for _, v := range retryList {
-		err = this.retrySyncProofToRelay(v)
+	for _, retry := range retryList {
+		if this.isStopped() {
+			return nil
+		}
+		if !isDue(retry) {
+			continue
+		}
+		this.retryLock.Lock()
+		err = this.retrySyncProofToRelay(retry)
+		this.retryLock.Unlock()
 		if err != nil {
 			log.Errorf("[retryTx] this.retrySyncProofToRelay error:%s", err)
 		}
-		time.Sleep(time.Duration(this.config.RetryInterval) * time.Second)
+		if !this.sleep(time.Duration(this.config.RetryInterval) * time.Second) {
+			return nil
+		}
 	}
 
 	return nil
@@ -11,6 +11,7 @@ func TestNewSyncService(t *testing.T) {
 }
 
 func TestChangeConsensus(t *testing.T) {
+	liveTest(t)
 	url := "http://seed10.ngd.network:21332"
 	client := rpc.NewClient(url)
 	currentConsensus := "AbmNLjoW4Sg4SuYweUf9MyuAwwygqD91rb"
@@ -26,6 +27,7 @@ func TestChangeConsensus(t *testing.T) {
 }
 
 func TestChangeConsensus10000(t *testing.T) {
+	liveTest(t)
 	url := "http://seed10.ngd.network:21332"
 	client := rpc.NewClient(url)
 	currentConsensus := "AarH7d8Zg92UKVTVNUXR4YDagVj4rEmpFZ"
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"sync"
+)
+
+// ntorPipeline relays the cross chain txs of consecutive neo blocks with a bounded number of workers.
+// Blocks are dispatched in order, and the checkpoint only moves past a block when all of its txs are handled.
+type ntorPipeline struct {
+	relay func(txId string, height uint32) error
+	sem   chan struct{}
+	wg    sync.WaitGroup
+
+	lock       sync.Mutex
+	pending    map[uint32]int // height -> txs in flight
+	dispatched uint32         // the next height to be dispatched
+	errHeight  uint32         // the lowest height with a failed tx, valid if err is not nil
+	err        error
+}
+
+func newNtorPipeline(workers int, start uint32, relay func(txId string, height uint32) error) *ntorPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ntorPipeline{
+		relay:      relay,
+		sem:        make(chan struct{}, workers),
+		pending:    make(map[uint32]int),
+		dispatched: start,
+	}
+}
+
+// dispatch relays txIds of the block at height in the background, blocking while all the workers are busy
+func (this *ntorPipeline) dispatch(height uint32, txIds []string) {
+	this.lock.Lock()
+	if len(txIds) > 0 {
+		this.pending[height] = len(txIds)
+	}
+	this.lock.Unlock()
+
+	for _, txId := range txIds {
+		this.sem <- struct{}{}
+		this.wg.Add(1)
+		go func(txId string) {
+			defer this.wg.Done()
+			err := this.relay(txId, height)
+			<-this.sem
+			this.done(height, err)
+		}(txId)
+	}
+
+	this.lock.Lock()
+	this.dispatched = height + 1
+	this.lock.Unlock()
+}
+
+func (this *ntorPipeline) done(height uint32, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.pending[height]--
+	if this.pending[height] == 0 {
+		delete(this.pending, height)
+	}
+	if err != nil && (this.err == nil || height < this.errHeight) {
+		this.err = err
+		this.errHeight = height
+	}
+}
+
+// wait blocks until every dispatched tx is handled, it is the barrier before a key header sync
+func (this *ntorPipeline) wait() {
+	this.wg.Wait()
+}
+
+// failed returns the error of the lowest failed block, no more blocks should be dispatched once it is not nil
+func (this *ntorPipeline) failed() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.err
+}
+
+// checkpoint is the lowest height which is not completely handled yet
+func (this *ntorPipeline) checkpoint() uint32 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	height := this.dispatched
+	for h := range this.pending {
+		if h < height {
+			height = h
+		}
+	}
+	if this.err != nil && this.errHeight < height {
+		height = this.errHeight
+	}
+	return height
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNtorPipeline(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	relayed := make(map[string]uint32)
+	p := newNtorPipeline(2, 100, func(txId string, height uint32) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		relayed[txId] = height
+		lock.Unlock()
+		return nil
+	})
+
+	p.dispatch(100, []string{"a", "b", "c"})
+	p.dispatch(101, nil)
+	p.dispatch(102, []string{"d"})
+	assert.True(t, p.checkpoint() < 103)
+	p.wait()
+	assert.Equal(t, uint32(103), p.checkpoint())
+	assert.Nil(t, p.failed())
+	assert.Equal(t, 2, maxRunning)
+	assert.Equal(t, map[string]uint32{"a": 100, "b": 100, "c": 100, "d": 102}, relayed)
+}
+
+func TestNtorPipeline_Failed(t *testing.T) {
+	p := newNtorPipeline(4, 100, func(txId string, height uint32) error {
+		if txId == "bad" {
+			return fmt.Errorf("GetApplicationLog error")
+		}
+		return nil
+	})
+
+	p.dispatch(100, []string{"a"})
+	p.dispatch(101, []string{"b", "bad"})
+	p.dispatch(102, []string{"bad"})
+	p.wait()
+	assert.NotNil(t, p.failed())
+	assert.Equal(t, uint32(101), p.checkpoint())
+}
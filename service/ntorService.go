@@ -4,34 +4,27 @@ import (
 	"fmt"
 	"github.com/joeqian10/neo-gogogo/helper"
 	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/config"
 	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+	"github.com/polynetwork/neo-relayer/notify"
 	"time"
 )
 
 //NeoToRelay ...
 func (this *SyncService) NeoToRelay() {
 	//this.relaySyncHeight, _ = this.GetCurrentRelayChainSyncHeight(this.config.NeoChainID)
-	this.relaySyncHeight = this.config.NeoStartHeight // means the next height to be synced
-	if this.relaySyncHeight == 0 {                    // means no block header has been synced
-		this.neoNextConsensus = ""
-	} else {
-		for j := 0; j < 5; j++ {
-			response := this.neoSdk.GetBlockByIndex(this.relaySyncHeight - 1) // get the last synced height
-			if response.HasError() {
-				log.Errorf("[NeoToRelay] neoSdk.GetBlockByIndex error: %s", response.Error.Message)
-			}
-			block := response.Result
-			if block.Hash == "" {
-				if j == 4 {
-					log.Errorf("[NeoToRelay] rpc request failed 5 times")
-					break
-				}
-				continue
-			}
-			this.neoNextConsensus = block.NextConsensus // set the next consensus to the last synced block
-			break
+	if !this.preflighted {
+		this.relaySyncHeight = startHeight(this.db.GetNeoHeight(), this.config.NeoStartHeight, this.config.ForceNeoStartHeight) // means the next height to be synced
+	}
+	log.Infof("[NeoToRelay] start scanning neo from height %d", this.relaySyncHeight)
+	if this.config.ForceNeoStartHeight {
+		// the hashes kept may be of the chain given up
+		if err := this.db.DeleteNeoHashFrom(0); err != nil {
+			log.Errorf("[NeoToRelay] this.db.DeleteNeoHashFrom error: %s", err)
 		}
 	}
+	var stall stallWatch
 	for {
 		//get current Neo BlockHeight, 5 times rpc
 		var currentNeoHeight uint32
@@ -50,133 +43,182 @@ func (this *SyncService) NeoToRelay() {
 				continue
 			}
 			currentNeoHeight = uint32(response.Result - 1)
+			metrics.ChainHeight.WithLabelValues(metrics.CHAIN_NEO).Set(float64(currentNeoHeight))
+			currentNeoHeight = confirmedHeight(currentNeoHeight, this.config.NeoConfirmations)
 			break
 		}
-		err := this.neoToRelay(this.relaySyncHeight, currentNeoHeight)
-		if err != nil {
+		// the chain scanned is verified and the next consensus is set again every round
+		if err := this.verifyNeoChain(); err != nil {
+			log.Errorf("[NeoToRelay] verifyNeoChain error: %s", err)
+		} else if err := this.neoToRelay(this.relaySyncHeight, currentNeoHeight); err != nil {
 			log.Errorf("[NeoToRelay] neoToRelay error:", err)
 		}
-		time.Sleep(time.Duration(this.config.ScanInterval) * time.Second)
+		this.watchStall(&stall, metrics.NEO_TO_RELAY, this.relaySyncHeight, currentNeoHeight)
+		if !this.sleep(time.Duration(this.config.ScanInterval) * time.Second) {
+			return
+		}
 	}
 }
 
 func (this *SyncService) neoToRelay(m, n uint32) error {
+	workers := this.config.NtorWorkers
+	if workers == 0 {
+		workers = config.DEFAULT_NTOR_WORKERS
+	}
+	pipeline := newNtorPipeline(int(workers), m, this.relayNeoTx)
+	err := this.dispatchNeoBlocks(pipeline, m, n)
+	pipeline.wait()
+	this.putRelaySyncHeight(pipeline.checkpoint())
+	if err != nil {
+		return err
+	}
+	return pipeline.failed()
+}
+
+// dispatchNeoBlocks feeds the cross chain txs of blocks [m, n) to pipeline, and syncs key headers once all the txs
+// before them are handled
+func (this *SyncService) dispatchNeoBlocks(pipeline *ntorPipeline, m, n uint32) error {
 	for i := m; i < n; i++ {
+		if this.isStopped() || pipeline.failed() != nil {
+			return nil
+		}
 		log.Infof("[neoToRelay] start processing NEO block %d", i)
 		// request block from NEO, try rpc request 5 times, if failed, continue
+		var blk models.RpcBlock
 		for j := 0; j < 5; j++ {
 			response := this.neoSdk.GetBlockByIndex(i)
 			if response.HasError() {
 				return fmt.Errorf("[neoToRelay] neoSdk.GetBlockByIndex error: %s", response.Error.Message)
 			}
-			blk := response.Result
-			if blk.Hash == "" {
-				if j == 4 {
-					log.Errorf("[neoToRelay] rpc request failed 5 times")
-					break
-				}
+			blk = response.Result
+			if blk.Hash != "" {
+				break
+			}
+			if j == 4 {
+				// stop here, so the checkpoint never skips an unprocessed block
+				return fmt.Errorf("[neoToRelay] rpc request failed 5 times, height: %d", i)
+			}
+		}
+		// stop at a block of another chain, the scan is rewound by verifyNeoChain in the next round
+		if err := this.keepNeoHash(i, &blk); err != nil {
+			return fmt.Errorf("[neoToRelay] %s", err)
+		}
+
+		// sync cross chain transaction
+		// check if this block contains cross chain tx
+		txIds := make([]string, 0, len(blk.Tx))
+		for _, tx := range blk.Tx {
+			if tx.Type != "InvocationTransaction" {
 				continue
 			}
+			//if !strings.Contains(tx.Script, this.config.NtorContract) {
+			//	continue
+			//}
+			txIds = append(txIds, tx.Txid)
+		}
+		pipeline.dispatch(i, txIds)
+
+		// if block.nextConsensus is changed, sync key header of NEO,
+		// but should be done after all cross chain tx up to this block are handled for verification purpose.
+		if blk.NextConsensus != this.neoNextConsensus {
+			pipeline.wait()
+			if pipeline.failed() != nil {
+				return nil
+			}
+			log.Infof("[neoToRelay] Syncing Key blockHeader from NEO: %d", blk.Index)
+			// Syncing key blockHeader to Relay Chain
+			err := this.syncHeaderToRelay(i)
+			metrics.ObserveCall("syncHeaderToRelay", err)
+			if err != nil {
+				log.Errorf("--------------------------------------------------")
+				log.Errorf("[neoToRelay] syncHeaderToRelay error: %s", err)
+				log.Errorf("height: %d", i)
+				log.Errorf("--------------------------------------------------")
+				this.alert(notify.CRITICAL, EVENT_KEY_HEADER, "sync key header of neo height %d to poly error: %s", i, err)
+			}
+			this.neoNextConsensus = blk.NextConsensus
+		}
+
+		this.putRelaySyncHeight(pipeline.checkpoint())
+	}
+	return nil
+}
 
-			// sync cross chain transaction
-			// check if this block contains cross chain tx
-			txs := blk.Tx
-			for _, tx := range txs {
-				if tx.Type != "InvocationTransaction" {
+// putRelaySyncHeight moves the checkpoint of neo to relay to height
+func (this *SyncService) putRelaySyncHeight(height uint32) {
+	if height == this.relaySyncHeight {
+		return
+	}
+	this.relaySyncHeight = height
+	metrics.ScanHeight.WithLabelValues(metrics.NEO_TO_RELAY).Set(float64(height))
+	if err := this.db.PutNeoHeight(height); err != nil {
+		log.Errorf("[neoToRelay] this.db.PutNeoHeight error: %s", err)
+	}
+}
+
+// relayNeoTx relays every cross chain tx found in the application log of the neo tx at height
+func (this *SyncService) relayNeoTx(txId string, height uint32) error {
+	response := this.neoSdk.GetApplicationLog(txId)
+	if response.HasError() {
+		return fmt.Errorf("[relayNeoTx] neoSdk.GetApplicationLog error: %s", response.Error.Message)
+	}
+
+	for _, execution := range response.Result.Executions {
+		if execution.VMState == "FAULT" {
+			continue
+		}
+		notifications := execution.Notifications
+		for index, notification := range execution.Notifications {
+			u, _ := helper.UInt160FromString(notification.Contract)
+			// outer loop confirm tx is a cross chain tx
+			if helper.BytesToHex(u.Bytes()) == this.config.NeoCCMC {
+				event, err := DecodeCrossChainLockEvent(notification.State)
+				if err == ErrNotLockEvent {
 					continue
 				}
-				//if !strings.Contains(tx.Script, this.config.NtorContract) {
-				//	continue
-				//}
-				response := this.neoSdk.GetApplicationLog(tx.Txid)
-				if response.HasError() {
-					return fmt.Errorf("[neoToRelay] neoSdk.GetApplicationLog error: %s", response.Error.Message)
+				if err != nil {
+					// a bad event does not stop the other cross chain txs of the block
+					this.alert(notify.WARN, EVENT_LOCK_EVENT, "bad cross chain lock event, neoHeight: %d, neoTxId: %s, notification: %d, %s",
+						height, txId, index, err)
+					continue
 				}
 
-				for _, execution := range response.Result.Executions {
-					if execution.VMState == "FAULT" {
-						continue
-					}
-					notifications := execution.Notifications
-					for _, notification := range execution.Notifications {
-						u, _ := helper.UInt160FromString(notification.Contract)
-						// outer loop confirm tx is a cross chain tx
-						if helper.BytesToHex(u.Bytes()) == this.config.NeoCCMC {
-							state := notification.State
-							if state.Type != "Array" {
-								return fmt.Errorf("[neoToRelay] notification.State.Type error: Type is not Array")
-							}
-							state.Convert() // state.Value is []InvokeStack
-							states := state.Value.([]models.InvokeStack)
-							states0 := states[0]
-							if states0.Value.(string) != "43726f7373436861696e4c6f636b4576656e74" { // "CrossChainLockEvent"
-								continue
-							}
-							if len(states) != 6 {
-								return fmt.Errorf("[neoToRelay] notification.State.Value error: Wrong length of states")
-							}
-
-							if this.config.NtorContract != "" { // when empty, relay everything
-								for index, ntf := range notifications {
-									// inner loop check it is for this specific contract
-									v, _ := helper.UInt160FromString(ntf.Contract)
-									if helper.BytesToHex(v.Bytes()) != this.config.NtorContract {
-										if index < len(notifications)-1 {
-											continue
-										}
-										log.Infof("This cross chain tx is not for this specific contract.")
-										goto NEXT
-									} else {
-										break
-									}
-								}
-							}
-							states4 := states[4]
-							states4.Convert()
-							key := states4.Value.(string) // hexstring for storeKey: 0102 + toChainId + toRequestId, like 01020501
-							//get relay chain sync height
-							currentRelayChainSyncHeight, err := this.GetCurrentRelayChainSyncHeight(this.config.NeoChainID)
-							if err != nil {
-								return fmt.Errorf("[neoToRelay] GetCurrentRelayChainSyncHeight error: %s", err)
-							}
-							var passed uint32
-							if i >= currentRelayChainSyncHeight {
-								passed = i
-							} else {
-								passed = currentRelayChainSyncHeight
-							}
-							err = this.syncProofToRelay(key, passed)
-							if err != nil {
-								log.Errorf("--------------------------------------------------")
-								log.Errorf("[neoToRelay] syncProofToRelay error: %s", err)
-								log.Errorf("neoHeight: %d, neoTxId: %s", i, tx.Txid)
-								log.Errorf("--------------------------------------------------")
-							}
-						}
-					NEXT:
-					} // notification
-				} // execution
-			}
-
-			// if block.nextConsensus is changed, sync key header of NEO,
-			// but should be done after all cross chain tx in this block are handled for verification purpose.
-			if blk.NextConsensus != this.neoNextConsensus {
-				log.Infof("[neoToRelay] Syncing Key blockHeader from NEO: %d", blk.Index)
-				// Syncing key blockHeader to Relay Chain
-				err := this.syncHeaderToRelay(i)
+				contract, ok := this.ntorContract(notifications, event)
+				if !ok {
+					log.Infof("This cross chain tx is not for any of the specific contracts.")
+					continue
+				}
+				key := event.Key
+				policyTx := lockEventPolicyTx(this.config.NeoChainID, event)
+				if allowed, rule := this.evaluatePolicy(policyTx); !allowed {
+					log.Infof("[relayNeoTx] skip the cross chain tx by policy rule %s, neoTxId: %s, key: %s, %s", rule, txId, key, policyTx)
+					continue
+				}
+				//get relay chain sync height
+				currentRelayChainSyncHeight, err := this.GetCurrentRelayChainSyncHeight(this.config.NeoChainID)
+				if err != nil {
+					return fmt.Errorf("[relayNeoTx] GetCurrentRelayChainSyncHeight error: %s", err)
+				}
+				var passed uint32
+				if height >= currentRelayChainSyncHeight {
+					passed = height
+				} else {
+					passed = currentRelayChainSyncHeight
+				}
+				err = this.syncProofToRelay(key, passed)
+				metrics.ObserveCall("syncProofToRelay", err)
 				if err != nil {
 					log.Errorf("--------------------------------------------------")
-					log.Errorf("[neoToRelay] syncHeaderToRelay error: %s", err)
-					log.Errorf("height: %d", i)
+					log.Errorf("[relayNeoTx] syncProofToRelay error: %s", err)
+					log.Errorf("neoHeight: %d, neoTxId: %s", height, txId)
 					log.Errorf("--------------------------------------------------")
+				} else {
+					log.Infof("[relayNeoTx] relayed for contract %s, %d txs relayed for it", contract,
+						this.contracts.count(metrics.NEO_TO_RELAY, contract))
 				}
-				this.neoNextConsensus = blk.NextConsensus
 			}
-
-			this.relaySyncHeight++
-			break
-		}
-	}
+		} // notification
+	} // execution
 	return nil
 }
 
@@ -190,6 +232,8 @@ func (this *SyncService) NeoToRelayCheckAndRetry() {
 		if err != nil {
 			log.Errorf("[NeoToRelayCheckAndRetry] this.retryTx error:%s", err)
 		}
-		time.Sleep(time.Duration(this.config.ScanInterval) * time.Second)
+		if !this.sleep(time.Duration(this.config.ScanInterval) * time.Second) {
+			return
+		}
 	}
 }
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/polynetwork/neo-relayer/common"
+	"github.com/polynetwork/neo-relayer/notify"
+	pCommon "github.com/polynetwork/poly/common"
+	hsCommon "github.com/polynetwork/poly/native/service/header_sync/common"
+	"github.com/polynetwork/poly/native/service/header_sync/neo"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testNeoCCMC    = "07946635d87e4120164835391e33a114135b69e1"
+	testNeoChainID = 4
+	testLockKey    = "0102040a"
+)
+
+// lockEventLog is the application log of a neo tx emitting CrossChainLockEvent for key
+func lockEventLog(t *testing.T, txId, contract, key string) models.RpcApplicationLog {
+	appLog := models.RpcApplicationLog{}
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{
+		"txid": "%s",
+		"executions": [{
+			"trigger": "Application",
+			"vmstate": "HALT",
+			"gas_consumed": "0.5",
+			"notifications": [{
+				"contract": "0x%s",
+				"state": {"type": "Array", "value": [
+					{"type": "ByteArray", "value": "43726f7373436861696e4c6f636b4576656e74"},
+					{"type": "ByteArray", "value": "f5d8ba1e39f2e2dd2c1a6a2d4d1b2a4d5e0a8a3b"},
+					{"type": "Integer", "value": "2"},
+					{"type": "ByteArray", "value": "e1695b1314a1331e3935481620417ed835669407"},
+					{"type": "ByteArray", "value": "%s"},
+					{"type": "ByteArray", "value": "00"}
+				]}
+			}]
+		}]
+	}`, txId, helper.ReverseString(contract), key)), &appLog)
+	assert.Nil(t, err)
+	return appLog
+}
+
+// neoBlock makes a neo block at index whose next consensus is the address of consensus
+func neoBlock(index uint32, consensus byte, txIds ...string) models.RpcBlock {
+	nextConsensus, _ := helper.UInt160FromBytes(append(make([]byte, 19), consensus))
+	blk := models.RpcBlock{}
+	blk.Hash = fakeHash(0x10000 + index)
+	blk.PreviousBlockHash = fakeHash(0x10000 + index - 1)
+	blk.MerkleRoot = fakeHash(0x20000 + index)
+	blk.Index = int(index)
+	blk.Nonce = "0000000000000001"
+	blk.NextConsensus = helper.ScriptHashToAddress(nextConsensus)
+	for _, txId := range txIds {
+		blk.Tx = append(blk.Tx, models.RpcTransaction{Txid: txId, Type: "InvocationTransaction"})
+	}
+	return blk
+}
+
+func newNtorTestService(t *testing.T) (*SyncService, *fakeNeo, *fakePoly, func()) {
+	s, neoFake, polyFake, clean := newFakeService(t)
+	s.config.NeoChainID = testNeoChainID
+	s.config.NeoCCMC = testNeoCCMC
+
+	txId := "0x" + helper.BytesToHex(make([]byte, 31)) + "01"
+	neoFake.blocks[0] = neoBlock(0, 1)
+	neoFake.blocks[1] = neoBlock(1, 1, txId)
+	neoFake.blocks[2] = neoBlock(2, 2)
+	neoFake.blocks[3] = neoBlock(3, 2)
+	neoFake.appLogs[txId] = lockEventLog(t, txId, testNeoCCMC, testLockKey)
+	neoFake.proofs[testLockKey] = "00"
+	neoFake.stateHeight = 3
+	s.neoNextConsensus = neoFake.blocks[0].NextConsensus
+
+	sink := pCommon.NewZeroCopySink(nil)
+	consensus := &neo.NeoConsensus{ChainID: testNeoChainID}
+	consensus.Serialization(sink)
+	key := common.ConcatKey([]byte(hsCommon.CONSENSUS_PEER), common.GetUint64Bytes(testNeoChainID))
+	polyFake.storage[hex.EncodeToString(key)] = sink.Bytes()
+	return s, neoFake, polyFake, clean
+}
+
+func TestNeoToRelay(t *testing.T) {
+	s, neoFake, polyFake, clean := newNtorTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.neoToRelay(0, 4))
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+	checks, err := s.db.GetAllCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checks))
+	assert.Equal(t, 1, len(polyFake.syncedHeader))
+	assert.Equal(t, neoFake.blocks[2].NextConsensus, s.neoNextConsensus)
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+	assert.Equal(t, uint32(4), s.db.GetNeoHeight())
+}
+
+func TestNeoToRelay_ImportFailed(t *testing.T) {
+	s, _, polyFake, clean := newNtorTestService(t)
+	defer clean()
+
+	polyFake.importError = fmt.Errorf("JsonRpcResponse error code:-1 desc:INTERNAL ERROR")
+	assert.Nil(t, s.neoToRelay(0, 4))
+	retries, err := s.db.GetAllRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, uint32(1), retries[0].Height)
+	assert.Equal(t, testLockKey, retries[0].Key)
+	assert.Equal(t, uint32(1), retries[0].Attempts)
+	assert.False(t, isDue(retries[0]))
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+
+	// lack of fee on poly postpones the retry without counting an attempt
+	polyFake.importError = fmt.Errorf("JsonRpcResponse error: %s", BALANCE_NOT_ENOUGH)
+	assert.NotNil(t, s.retrySyncProofToRelay(retries[0]))
+	retry, err := s.db.GetRetry(retries[0].Id())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), retry.Attempts)
+
+	polyFake.importError = nil
+	assert.Nil(t, s.retrySyncProofToRelay(retry))
+	retry, err = s.db.GetRetry(retries[0].Id())
+	assert.Nil(t, err)
+	assert.Nil(t, retry)
+	assert.Equal(t, []uint32{1}, polyFake.imports)
+}
+
+// forkNeoBlocks replaces the blocks of neoFake from height on with the ones of another chain
+func forkNeoBlocks(neoFake *fakeNeo, height uint32) {
+	for index, blk := range neoFake.blocks {
+		if index < height {
+			continue
+		}
+		blk.Hash = fakeHash(0x30000 + index)
+		if index > height {
+			blk.PreviousBlockHash = fakeHash(0x30000 + index - 1)
+		}
+		neoFake.blocks[index] = blk
+	}
+}
+
+func TestNeoToRelay_Fork(t *testing.T) {
+	s, neoFake, _, clean := newNtorTestService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+
+	assert.Nil(t, s.neoToRelay(0, 2))
+	assert.Nil(t, s.verifyNeoChain())
+	assert.Equal(t, neoFake.blocks[1].NextConsensus, s.neoNextConsensus)
+	assert.Empty(t, alerts)
+
+	// the scan stops at a block of another chain
+	forkNeoBlocks(neoFake, 1)
+	assert.NotNil(t, s.neoToRelay(2, 4))
+	assert.Equal(t, uint32(2), s.relaySyncHeight)
+	assert.Equal(t, "", s.db.GetNeoHash(2))
+
+	// and is rewound to the last block both chains share
+	s.neoNextConsensus = ""
+	assert.Nil(t, s.verifyNeoChain())
+	assert.Equal(t, uint32(1), s.relaySyncHeight)
+	assert.Equal(t, uint32(1), s.db.GetNeoHeight())
+	assert.Equal(t, neoFake.blocks[0].NextConsensus, s.neoNextConsensus)
+	assert.Equal(t, "", s.db.GetNeoHash(1))
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, EVENT_NEO_FORK, alerts[0].Event)
+	assert.Contains(t, alerts[0].Message, "from height 1")
+
+	assert.Nil(t, s.neoToRelay(1, 4))
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+	assert.Equal(t, neoFake.blocks[3].Hash, s.db.GetNeoHash(3))
+}
+
+func TestNeoToRelay_ForkBeyondHashes(t *testing.T) {
+	s, neoFake, _, clean := newNtorTestService(t)
+	defer clean()
+	s.config.NeoHashWindow = 1
+
+	assert.Nil(t, s.neoToRelay(0, 4))
+	forkNeoBlocks(neoFake, 0)
+	assert.NotNil(t, s.verifyNeoChain())
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+}
+
+func TestConfirmedHeight(t *testing.T) {
+	assert.Equal(t, uint32(100), confirmedHeight(100, 0))
+	assert.Equal(t, uint32(94), confirmedHeight(100, 6))
+	assert.Equal(t, uint32(0), confirmedHeight(3, 6))
+}
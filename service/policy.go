@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/config"
+)
+
+// policyTx is what the policy rules are matched on, the fields which can not be decoded are left empty
+type policyTx struct {
+	direction    string
+	fromChainID  uint64
+	toChainID    uint64
+	fromContract string
+	toContract   string
+	method       string
+	assetHash    string
+	amount       *big.Int
+}
+
+func (this *policyTx) String() string {
+	return fmt.Sprintf("%s tx from chain %d contract %s to chain %d contract %s, method: %s, asset hash: %s, amount: %s",
+		this.direction, this.fromChainID, this.fromContract, this.toChainID, this.toContract, this.method,
+		this.assetHash, this.amount)
+}
+
+// newPolicyTx makes the policy tx of a cross chain tx from fromChainID with param
+func newPolicyTx(direction string, fromChainID uint64, param *CrossChainTxParameter) *policyTx {
+	tx := &policyTx{
+		direction:    direction,
+		fromChainID:  fromChainID,
+		toChainID:    param.ToChainID,
+		fromContract: helper.BytesToHex(param.FromContract),
+		toContract:   helper.BytesToHex(param.ToContract),
+		method:       string(param.Method),
+	}
+	tx.setArgs(param.Args)
+	return tx
+}
+
+// lockEventPolicyTx makes the policy tx of event emitted on neo
+func lockEventPolicyTx(neoChainID uint64, event *CrossChainLockEvent) *policyTx {
+	tx := &policyTx{
+		direction:    config.POLICY_NTOR,
+		fromChainID:  neoChainID,
+		toChainID:    event.ToChainID,
+		fromContract: event.FromContract,
+		toContract:   event.ToContract,
+	}
+	param, err := DeserializeCrossChainTxParameter(event.Param, 0)
+	if err == nil {
+		tx.method = string(param.Method)
+		tx.setArgs(param.Args)
+	}
+	return tx
+}
+
+// setArgs sets the asset hash and amount of tx if args are the ones of lock or unlock
+func (this *policyTx) setArgs(args []byte) {
+	assetHash, _, amount, err := DeserializeArgs(args)
+	if err != nil {
+		return
+	}
+	this.assetHash = helper.BytesToHex(assetHash)
+	this.amount = amount
+}
+
+// evaluatePolicy returns whether tx is relayed, and the name of the rule which decides it
+func (this *SyncService) evaluatePolicy(tx *policyTx) (bool, string) {
+	rules := this.config.PolicyRules
+	if len(rules) == 0 {
+		rules = config.DefaultPolicyRules
+	}
+	for i, rule := range rules {
+		if !matchRule(rule, tx) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		return rule.Action == config.POLICY_ALLOW, name
+	}
+	return this.config.PolicyDefault != config.POLICY_DENY, "default"
+}
+
+// matchRule checks tx has a value in every list set in rule, and an amount of at least its min amount
+func matchRule(rule *config.PolicyRule, tx *policyTx) bool {
+	if rule.Direction != "" && rule.Direction != tx.direction {
+		return false
+	}
+	if len(rule.FromChainIDs) > 0 && !containsChainID(rule.FromChainIDs, tx.fromChainID) {
+		return false
+	}
+	if len(rule.ToChainIDs) > 0 && !containsChainID(rule.ToChainIDs, tx.toChainID) {
+		return false
+	}
+	if len(rule.FromContracts) > 0 && !containsHex(rule.FromContracts, tx.fromContract) {
+		return false
+	}
+	if len(rule.ToContracts) > 0 && !containsHex(rule.ToContracts, tx.toContract) {
+		return false
+	}
+	if len(rule.AssetHashes) > 0 && !containsHex(rule.AssetHashes, tx.assetHash) {
+		return false
+	}
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, method := range rule.Methods {
+			if method == tx.method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.MinAmount != "" {
+		min, _ := new(big.Int).SetString(rule.MinAmount, 10)
+		if tx.amount == nil || min == nil || tx.amount.Cmp(min) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func containsChainID(ids []uint64, id uint64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// containsHex checks hexes has value, ignoring case and the 0x prefix
+func containsHex(hexes []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range hexes {
+		if strings.EqualFold(strings.TrimPrefix(v, "0x"), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncService_evaluatePolicy(t *testing.T) {
+	s, _, _, clean := newFakeService(t)
+	defer clean()
+	tx := &policyTx{
+		direction:    config.POLICY_RTON,
+		fromChainID:  2,
+		toChainID:    testNeoChainID,
+		fromContract: "0000000000000000000000000000000000000000",
+		toContract:   testUnlockKey,
+		method:       "unlock",
+		assetHash:    "17da3881ab2d050fea414c80b3fa8324d756f60e",
+		amount:       big.NewInt(100),
+	}
+
+	// only unlock is relayed to neo by default
+	allowed, rule := s.evaluatePolicy(tx)
+	assert.True(t, allowed)
+	assert.Equal(t, "unlock", rule)
+	tx.method = "lock"
+	allowed, rule = s.evaluatePolicy(tx)
+	assert.False(t, allowed)
+	assert.Equal(t, "not unlock", rule)
+	tx.direction = config.POLICY_NTOR
+	allowed, rule = s.evaluatePolicy(tx)
+	assert.True(t, allowed)
+	assert.Equal(t, "default", rule)
+	tx.direction = config.POLICY_RTON
+	tx.method = "unlock"
+
+	s.config.PolicyRules = []*config.PolicyRule{
+		{Name: "blocked asset", Action: config.POLICY_DENY, AssetHashes: []string{"0x17DA3881AB2D050FEA414C80B3FA8324D756F60E"}},
+		{Action: config.POLICY_ALLOW, FromChainIDs: []uint64{2}, ToChainIDs: []uint64{testNeoChainID}, MinAmount: "100"},
+	}
+	s.config.PolicyDefault = config.POLICY_DENY
+	allowed, rule = s.evaluatePolicy(tx)
+	assert.False(t, allowed)
+	assert.Equal(t, "blocked asset", rule)
+
+	tx.assetHash = "0000000000000000000000000000000000000001"
+	allowed, rule = s.evaluatePolicy(tx)
+	assert.True(t, allowed)
+	assert.Equal(t, "#1", rule)
+
+	tx.amount = big.NewInt(99)
+	allowed, rule = s.evaluatePolicy(tx)
+	assert.False(t, allowed)
+	assert.Equal(t, "default", rule)
+
+	// a rule on the amount does not match a tx whose args can not be decoded
+	tx.amount = nil
+	allowed, _ = s.evaluatePolicy(tx)
+	assert.False(t, allowed)
+}
+
+func TestConfig_CheckPolicy(t *testing.T) {
+	cfg := &config.Config{PolicyRules: []*config.PolicyRule{{Action: config.POLICY_ALLOW, MinAmount: "1000"}}}
+	assert.Nil(t, cfg.CheckPolicy())
+
+	cfg.PolicyDefault = "drop"
+	assert.EqualError(t, cfg.CheckPolicy(), "policy default drop is neither allow nor deny")
+	cfg.PolicyDefault = config.POLICY_DENY
+
+	cfg.PolicyRules[0].MinAmount = "1e3"
+	assert.EqualError(t, cfg.CheckPolicy(), "min amount 1e3 of policy rule 0 is not a decimal")
+	cfg.PolicyRules[0].MinAmount = ""
+
+	cfg.PolicyRules[0].Direction = "both"
+	assert.EqualError(t, cfg.CheckPolicy(), "direction both of policy rule 0 is neither ntor nor rton")
+	cfg.PolicyRules[0].Direction = ""
+
+	cfg.PolicyRules[0].Action = ""
+	assert.EqualError(t, cfg.CheckPolicy(), "action  of policy rule 0 is neither allow nor deny")
+}
+
+func TestNeoToRelay_Policy(t *testing.T) {
+	s, _, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	s.config.PolicyRules = []*config.PolicyRule{
+		{Name: "no chain 2", Action: config.POLICY_DENY, Direction: config.POLICY_NTOR, ToChainIDs: []uint64{2}},
+	}
+
+	// the tx is skipped, and the scan goes on
+	assert.Nil(t, s.neoToRelay(0, 4))
+	assert.Empty(t, polyFake.imports)
+	checks, err := s.db.GetAllCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checks)
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+}
+
+func TestRelayToNeo_Policy(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	s.config.PolicyRules = []*config.PolicyRule{
+		{Name: "dust", Action: config.POLICY_ALLOW, Direction: config.POLICY_RTON, Methods: []string{"unlock"}, MinAmount: "101"},
+	}
+	s.config.PolicyDefault = config.POLICY_DENY
+
+	// the transfer of 100 is skipped without a retry
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Empty(t, neoFake.sent)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+
+	s.config.PolicyRules[0].MinAmount = "100"
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 1, len(neoFake.sent))
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+	rsdk "github.com/polynetwork/poly-go-sdk"
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+)
+
+// JSON_RPC_ERROR prefixes the errors answered by a poly node, the others mean the node is not reached
+const JSON_RPC_ERROR = "JsonRpcResponse error"
+
+// PolyPool is a PolyClient sending every request to the fastest poly node in sync, and failing over to the next one
+// when the node can not be reached. All the nodes are of the same chain id.
+type PolyPool struct {
+	nodes   *rpcNodes
+	clients []PolyClient
+	chainId uint64
+}
+
+// NewPolyPool makes a pool of clients, whose chain ids are set from the genesis blocks of the nodes at urls. It fails
+// if the chain ids are not the same, and checks the nodes once otherwise.
+func NewPolyPool(urls []string, clients []PolyClient, maxLag uint32) (*PolyPool, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("[NewPolyPool] no poly node")
+	}
+	for i, client := range clients {
+		if client.GetChainId() != clients[0].GetChainId() {
+			return nil, fmt.Errorf("[NewPolyPool] chain id of poly node %s is %d, but %d of %s", urls[i],
+				client.GetChainId(), clients[0].GetChainId(), urls[0])
+		}
+	}
+	if maxLag == 0 {
+		maxLag = config.DEFAULT_RELAY_MAX_LAG
+	}
+	pool := &PolyPool{
+		nodes:   newRpcNodes(metrics.CHAIN_RELAY, urls, maxLag),
+		clients: clients,
+		chainId: clients[0].GetChainId(),
+	}
+	pool.CheckNodes()
+	return pool, nil
+}
+
+// AddNode adds a poly node which can not be reached when the pool is made, it should be called before the pool is used.
+// The node is sent no request until its chain id is checked by CheckNodes.
+func (this *PolyPool) AddNode(url string, client PolyClient) {
+	this.clients = append(this.clients, client)
+	this.nodes.add(url)
+}
+
+// CheckNodes refreshes the height and the latency of every node, and marks the ones behind
+func (this *PolyPool) CheckNodes() {
+	this.nodes.check(func(i int) nodeCheck {
+		if !this.nodes.isChecked(i) && !this.checkChainId(i) {
+			return nodeCheck{}
+		}
+		height, err := this.clients[i].GetCurrentBlockHeight()
+		if err != nil {
+			log.Warnf("[CheckNodes] poly node %s GetCurrentBlockHeight error: %s", this.nodes.nodes[i].url, err)
+			return nodeCheck{}
+		}
+		return nodeCheck{heights: []uint64{uint64(height)}, up: true}
+	})
+}
+
+// checkChainId checks the chain id of node i against the pool by its genesis header, and sets it to the client
+func (this *PolyPool) checkChainId(i int) bool {
+	url := this.nodes.nodes[i].url
+	header, err := this.clients[i].GetHeaderByHeight(0)
+	if err != nil {
+		log.Warnf("[CheckNodes] poly node %s is not checked yet, GetHeaderByHeight error: %s", url, err)
+		return false
+	}
+	if header.ChainID != this.chainId {
+		log.Errorf("[CheckNodes] chain id of poly node %s is %d, but %d of the pool, the node is not used", url,
+			header.ChainID, this.chainId)
+		return false
+	}
+	if setter, ok := this.clients[i].(chainIdSetter); ok {
+		setter.SetChainId(header.ChainID)
+	}
+	this.nodes.setChecked(i)
+	log.Infof("[CheckNodes] poly node %s is checked, chain id: %d", url, header.ChainID)
+	return true
+}
+
+// call sends request to the nodes in turn until one of them is reached, json rpc errors are answers of the node
+func (this *PolyPool) call(method string, request func(PolyClient) error) error {
+	return this.nodes.call(method, func(i int) (error, bool) {
+		err := request(this.clients[i])
+		return err, err == nil || strings.Contains(err.Error(), JSON_RPC_ERROR)
+	})
+}
+
+func (this *PolyPool) GetChainId() uint64 {
+	return this.chainId
+}
+
+func (this *PolyPool) GetBlockByHeight(height uint32) (block *types.Block, err error) {
+	err = this.call("getblock", func(c PolyClient) error {
+		block, err = c.GetBlockByHeight(height)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetCrossStatesProof(height uint32, key string) (proof *sdkcom.MerkleProof, err error) {
+	err = this.call("getcrossstatesproof", func(c PolyClient) error {
+		proof, err = c.GetCrossStatesProof(height, key)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetCurrentBlockHeight() (height uint32, err error) {
+	err = this.call("getblockcount", func(c PolyClient) error {
+		height, err = c.GetCurrentBlockHeight()
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetHeaderByHeight(height uint32) (header *types.Header, err error) {
+	err = this.call("getheader", func(c PolyClient) error {
+		header, err = c.GetHeaderByHeight(height)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetMerkleProof(blockHeight, rootHeight uint32) (proof *sdkcom.MerkleProof, err error) {
+	err = this.call("getmerkleproof", func(c PolyClient) error {
+		proof, err = c.GetMerkleProof(blockHeight, rootHeight)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetSmartContractEvent(txHash string) (event *sdkcom.SmartContactEvent, err error) {
+	err = this.call("getsmartcodeevent", func(c PolyClient) error {
+		event, err = c.GetSmartContractEvent(txHash)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetSmartContractEventByBlock(height uint32) (events []*sdkcom.SmartContactEvent, err error) {
+	err = this.call("getsmartcodeeventbyblock", func(c PolyClient) error {
+		events, err = c.GetSmartContractEventByBlock(height)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) GetStorage(contractAddress string, key []byte) (value []byte, err error) {
+	err = this.call("getstorage", func(c PolyClient) error {
+		value, err = c.GetStorage(contractAddress, key)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+	relayerAddress []byte, headerOrCrossChainMsg []byte, signer *rsdk.Account) (txHash pCommon.Uint256, err error) {
+	err = this.call("importoutertransfer", func(c PolyClient) error {
+		txHash, err = c.ImportOuterTransfer(sourceChainId, txData, height, proof, relayerAddress, headerOrCrossChainMsg, signer)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) SyncBlockHeader(chainId uint64, address pCommon.Address, headers [][]byte, signer *rsdk.Account) (txHash pCommon.Uint256, err error) {
+	err = this.call("syncblockheader", func(c PolyClient) error {
+		txHash, err = c.SyncBlockHeader(chainId, address, headers, signer)
+		return err
+	})
+	return
+}
+
+func (this *PolyPool) WaitForGenerateBlock(timeout time.Duration, blockCount ...uint32) (ok bool, err error) {
+	err = this.call("waitforgenerateblock", func(c PolyClient) error {
+		ok, err = c.WaitForGenerateBlock(timeout, blockCount...)
+		return err
+	})
+	return
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	"github.com/polynetwork/poly/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPolyPool(t *testing.T, fakes ...*fakePoly) *PolyPool {
+	urls := make([]string, len(fakes))
+	clients := make([]PolyClient, len(fakes))
+	for i, fake := range fakes {
+		urls[i] = fmt.Sprintf("poly%d", i)
+		clients[i] = fake
+	}
+	pool, err := NewPolyPool(urls, clients, 0)
+	assert.Nil(t, err)
+	return pool
+}
+
+func TestPolyPool_ChainId(t *testing.T) {
+	a, b := newFakePoly(), newFakePoly()
+	a.chainId, b.chainId = 2, 3
+	_, err := NewPolyPool([]string{"poly0", "poly1"}, []PolyClient{a, b}, 0)
+	assert.NotNil(t, err)
+
+	b.chainId = 2
+	pool := newTestPolyPool(t, a, b)
+	assert.Equal(t, uint64(2), pool.GetChainId())
+
+	_, err = NewPolyPool(nil, nil, 0)
+	assert.NotNil(t, err)
+}
+
+func TestPolyPool_AddNode(t *testing.T) {
+	a, b, c := newFakePoly(), newFakePoly(), newFakePoly()
+	a.chainId, a.height, b.height, c.height = 2, 20, 20, 20
+	pool := newTestPolyPool(t, a)
+	pool.AddNode("poly1", b)
+	pool.AddNode("poly2", c)
+
+	// the nodes added are not used before their chain ids are checked
+	a.down = true
+	pool.CheckNodes()
+	_, err := pool.GetCurrentBlockHeight()
+	assert.Equal(t, errPolyDown, err)
+
+	b.headers[0] = &types.Header{ChainID: 2}
+	c.headers[0] = &types.Header{ChainID: 3}
+	pool.CheckNodes()
+	assert.Equal(t, uint64(2), b.chainId)
+	assert.True(t, pool.nodes.isChecked(1))
+	assert.False(t, pool.nodes.isChecked(2))
+	height, err := pool.GetCurrentBlockHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(20), height)
+	assert.Equal(t, []int{1, 0}, pool.nodes.candidates()) // the node down last, the one of another chain never
+}
+
+func TestPolyPool_Failover(t *testing.T) {
+	a, b := newFakePoly(), newFakePoly()
+	a.height, b.height = 20, 20
+	a.events[10] = []*sdkcom.SmartContactEvent{{TxHash: "a"}}
+	b.events[10] = []*sdkcom.SmartContactEvent{{TxHash: "b"}}
+	a.down = true
+	pool := newTestPolyPool(t, a, b)
+
+	height, err := pool.GetCurrentBlockHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(20), height)
+	events, err := pool.GetSmartContractEventByBlock(10)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", events[0].TxHash)
+
+	// b goes down between two checks, a is still tried
+	a.down, b.down = false, true
+	events, err = pool.GetSmartContractEventByBlock(10)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", events[0].TxHash)
+	_, err = pool.ImportOuterTransfer(testNeoChainID, nil, 1, nil, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{1}, a.imports)
+
+	// json rpc errors are answers of the node, the tx is not sent to another one
+	b.down = false
+	a.importError = fmt.Errorf("%s code:-1 desc:INTERNAL ERROR, ErrUnknown result:\"%s\"", JSON_RPC_ERROR, TX_ALREADY_DONE)
+	_, err = pool.ImportOuterTransfer(testNeoChainID, nil, 2, nil, nil, nil, nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, b.imports)
+
+	a.down, b.down = true, true
+	_, err = pool.GetCurrentBlockHeight()
+	assert.Equal(t, errPolyDown, err)
+}
+
+func TestPolyPool_Behind(t *testing.T) {
+	a, b := newFakePoly(), newFakePoly()
+	a.height, b.height = 100, 50
+	pool := newTestPolyPool(t, a, b)
+	assert.False(t, pool.nodes.nodes[0].behind)
+	assert.True(t, pool.nodes.nodes[1].behind)
+
+	a.down = true
+	_, err := pool.GetCurrentBlockHeight()
+	assert.NotNil(t, err)
+
+	b.height = 100
+	pool.CheckNodes()
+	height, err := pool.GetCurrentBlockHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(100), height)
+}
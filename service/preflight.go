@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+// Preflight sets the heights the scanners start from, checked against the key headers synced on chain, and should be
+// called before Run. A start height which would skip a key header not synced yet is moved back, with a warning, to the
+// block after the last key header synced. It fails if the start height has to be moved back by more than
+// PreflightMaxRewind blocks, or if it is more than PreflightMaxReplay blocks below the last key header synced, unless
+// the start height is forced.
+func (this *SyncService) Preflight() error {
+	neoStart := startHeight(this.db.GetNeoHeight(), this.config.NeoStartHeight, this.config.ForceNeoStartHeight)
+	neoStart, err := this.preflightNeo(neoStart)
+	if err != nil {
+		return fmt.Errorf("[Preflight] %s", err)
+	}
+	polyStart := startHeight(this.db.GetPolyHeight(), this.config.PolyStartHeight, this.config.ForcePolyStartHeight)
+	polyStart, err = this.preflightPoly(polyStart)
+	if err != nil {
+		return fmt.Errorf("[Preflight] %s", err)
+	}
+	this.relaySyncHeight, this.neoSyncHeight = neoStart, polyStart
+	this.preflighted = true
+	log.Infof("[Preflight] start scanning neo from height %d, poly from height %d", neoStart, polyStart)
+	return nil
+}
+
+// preflightNeo checks start, the neo height to scan from, against the last neo key header synced to poly. A key
+// header is between them if the next consensus of the block before start is not the one on poly.
+func (this *SyncService) preflightNeo(start uint32) (uint32, error) {
+	consensus, err := this.getNeoConsensus(this.config.NeoChainID)
+	if err != nil {
+		return 0, fmt.Errorf("getNeoConsensus error: %s", err)
+	}
+	if consensus == nil {
+		log.Warnf("[preflightNeo] no neo header is synced to poly, the neo start height %d is not checked", start)
+		return start, nil
+	}
+	return this.checkStart("neo", start, consensus.Height, this.config.ForceNeoStartHeight, func() (bool, error) {
+		blk, err := this.getNeoBlock(start - 1)
+		if err != nil {
+			return false, err
+		}
+		nextConsensus, err := helper.AddressToScriptHash(blk.NextConsensus)
+		if err != nil {
+			return false, fmt.Errorf("AddressToScriptHash error: %s", err)
+		}
+		return nextConsensus != consensus.NextConsensus, nil
+	})
+}
+
+// preflightPoly checks start, the poly height to scan from, against the last poly key header synced to neo. A key
+// header is between them if the next bookkeeper of the block before start is not the one of the key header.
+func (this *SyncService) preflightPoly(start uint32) (uint32, error) {
+	height, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.GetChainId())
+	if err != nil {
+		return 0, err
+	}
+	if height == 0 {
+		log.Warnf("[preflightPoly] no poly header is synced to neo, the poly start height %d is not checked", start)
+		return start, nil
+	}
+	synced := uint32(height - 1)
+	return this.checkStart("poly", start, synced, this.config.ForcePolyStartHeight, func() (bool, error) {
+		keyHeader, err := this.relaySdk.GetHeaderByHeight(synced)
+		if err != nil {
+			return false, fmt.Errorf("GetHeaderByHeight error: %s, height: %d", err, synced)
+		}
+		header, err := this.relaySdk.GetHeaderByHeight(start - 1)
+		if err != nil {
+			return false, fmt.Errorf("GetHeaderByHeight error: %s, height: %d", err, start-1)
+		}
+		return header.NextBookkeeper != keyHeader.NextBookkeeper, nil
+	})
+}
+
+// checkStart checks start, the height the scanner of chain starts from, against synced, the height of the last key
+// header of chain synced to the other chain. keyChanged reports whether a key header is between synced and start.
+func (this *SyncService) checkStart(chain string, start, synced uint32, force bool, keyChanged func() (bool, error)) (uint32, error) {
+	maxRewind := this.config.PreflightMaxRewind
+	if maxRewind == 0 {
+		maxRewind = config.DEFAULT_PREFLIGHT_REWIND
+	}
+	maxReplay := this.config.PreflightMaxReplay
+	if maxReplay == 0 {
+		maxReplay = config.DEFAULT_PREFLIGHT_REPLAY
+	}
+	if start > synced+1 {
+		changed, err := keyChanged()
+		if err != nil {
+			return 0, err
+		}
+		if !changed {
+			return start, nil
+		}
+		if start-synced-1 > maxRewind {
+			return 0, fmt.Errorf("%s start height %d skips a key header after %d synced on chain, "+
+				"and is more than %d blocks after it", chain, start, synced, maxRewind)
+		}
+		log.Warnf("[checkStart] %s start height %d skips a key header after %d synced on chain, start from %d instead",
+			chain, start, synced, synced+1)
+		return synced + 1, nil
+	}
+	if start >= synced {
+		return start, nil
+	}
+	if synced-start <= maxReplay {
+		return start, nil
+	}
+	if !force {
+		return 0, fmt.Errorf("%s start height %d is more than %d blocks below the key header %d synced on chain",
+			chain, start, maxReplay, synced)
+	}
+	log.Warnf("[checkStart] %s start height %d is forced, %d blocks below the key header %d synced on chain are scanned again",
+		chain, start, synced-start, synced)
+	return start, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/common"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+	hsCommon "github.com/polynetwork/poly/native/service/header_sync/common"
+	"github.com/polynetwork/poly/native/service/header_sync/neo"
+	"github.com/stretchr/testify/assert"
+)
+
+// putNeoConsensus sets the neo consensus on poly to the key header at height
+func putNeoConsensus(t *testing.T, polyFake *fakePoly, neoFake *fakeNeo, height uint32) {
+	nextConsensus, err := helper.AddressToScriptHash(neoFake.blocks[height].NextConsensus)
+	assert.Nil(t, err)
+	sink := pCommon.NewZeroCopySink(nil)
+	consensus := &neo.NeoConsensus{ChainID: testNeoChainID, Height: height, NextConsensus: nextConsensus}
+	consensus.Serialization(sink)
+	key := common.ConcatKey([]byte(hsCommon.CONSENSUS_PEER), common.GetUint64Bytes(testNeoChainID))
+	polyFake.storage[hex.EncodeToString(key)] = sink.Bytes()
+}
+
+func TestPreflight_Neo(t *testing.T) {
+	s, neoFake, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	// block 2 is a key header, which changes the next consensus
+	putNeoConsensus(t, polyFake, neoFake, 0)
+
+	// the key header at 2 is not synced, the start height is moved back
+	assert.Nil(t, s.db.PutNeoHeight(4))
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(1), s.relaySyncHeight)
+	assert.True(t, s.preflighted)
+
+	// but not by more than PreflightMaxRewind
+	s.config.PreflightMaxRewind = 2
+	assert.NotNil(t, s.Preflight())
+
+	// the key header at 2 is synced
+	putNeoConsensus(t, polyFake, neoFake, 2)
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(4), s.relaySyncHeight)
+
+	// starting far below the key header synced is refused unless it is forced
+	assert.Nil(t, s.db.PutNeoHeight(0))
+	s.config.PreflightMaxReplay = 1
+	assert.NotNil(t, s.Preflight())
+	s.config.ForceNeoStartHeight = true
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(0), s.relaySyncHeight)
+}
+
+func TestPreflight_Poly(t *testing.T) {
+	s, neoFake, polyFake, clean := newRtonTestService(t)
+	defer clean()
+	// the epoch of poly changes at 5, which is synced to neo
+	neoFake.storage["0x"+helper.ReverseString(testNeoCCMC)+"0201"] = "05"
+	for height := uint32(0); height < 20; height++ {
+		header := &types.Header{Height: height}
+		if height >= 5 {
+			header.NextBookkeeper[0] = 1
+		}
+		if height >= 15 {
+			header.NextBookkeeper[0] = 2
+		}
+		polyFake.headers[height] = header
+	}
+
+	assert.Nil(t, s.db.PutPolyHeight(12))
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(12), s.neoSyncHeight)
+
+	// the epoch change at 15 is not synced to neo
+	assert.Nil(t, s.db.PutPolyHeight(18))
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(6), s.neoSyncHeight)
+}
+
+func TestPreflight_StartAfterKeyHeader(t *testing.T) {
+	s, neoFake, polyFake, clean := newNtorTestService(t)
+	defer clean()
+	putNeoConsensus(t, polyFake, neoFake, 2)
+
+	// the block after the key header synced is where a restart resumes
+	assert.Nil(t, s.db.PutNeoHeight(3))
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(3), s.relaySyncHeight)
+
+	s, neoFake, polyFake, clean = newRtonTestService(t)
+	defer clean()
+	neoFake.storage["0x"+helper.ReverseString(testNeoCCMC)+"0201"] = "05"
+	for height := uint32(0); height < 10; height++ {
+		polyFake.headers[height] = &types.Header{Height: height}
+	}
+	assert.Nil(t, s.db.PutPolyHeight(6))
+	assert.Nil(t, s.Preflight())
+	assert.Equal(t, uint32(6), s.neoSyncHeight)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/joeqian10/neo-gogogo/crypto"
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/ontio/ontology-crypto/ec"
+	"github.com/ontio/ontology-crypto/keypair"
+	vconfig "github.com/polynetwork/poly/consensus/vbft/config"
+	"github.com/polynetwork/poly/core/types"
+)
+
+// POLY_SIGNATURE_LEN is the length of an eth compatible signature in the sign list, r, s and v
+const POLY_SIGNATURE_LEN = 65
+
+// verifyPolyProof checks the proof of a cross chain tx the way VerifyAndExecuteTx of the neo CCMC does, so a proof
+// the CCMC would fault on is rejected before paying for the tx. header is the poly header after the tx, whose cross
+// state root path is proved against. For a header before the key header synced to neo, reliable is the header
+// after the key header, whose block root headerProof proves header against, and which is signed instead. The
+// signatures in signList have to be made by more than 2/3 of the book keepers of the key header. lastSynced is the
+// height after the key header. It returns the merkle value of the cross chain tx.
+func (this *SyncService) verifyPolyProof(path []byte, header *types.Header, headerProof []byte, reliable *types.Header,
+	signList []byte, lastSynced uint32) (*ToMerkleValue, error) {
+	keepers, err := this.polyKeepers(lastSynced)
+	if err != nil {
+		return nil, err
+	}
+	if reliable == nil {
+		if header.Height < lastSynced-1 {
+			return nil, fmt.Errorf("poly header %d is before the key header %d synced to neo, and has no header proof",
+				header.Height, lastSynced-1)
+		}
+		if err := verifyPolySigs(header, signList, keepers); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := verifyPolySigs(reliable, signList, keepers); err != nil {
+			return nil, err
+		}
+		value, err := MerkleProve(headerProof, reliable.BlockRoot.ToArray())
+		if err != nil {
+			return nil, fmt.Errorf("header proof of poly header %d against the block root of %d error: %s",
+				header.Height, reliable.Height, err)
+		}
+		if hash := crypto.Hash256(header.GetMessage()); !bytes.Equal(value, hash) {
+			return nil, fmt.Errorf("header proof of poly header %d proves %x instead of its hash %x",
+				header.Height, value, hash)
+		}
+	}
+
+	value, err := MerkleProve(path, header.CrossStateRoot.ToArray())
+	if err != nil {
+		return nil, fmt.Errorf("tx proof against the cross state root of poly header %d error: %s", header.Height, err)
+	}
+	toMerkleValue, err := DeserializeMerkleValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("DeserializeMerkleValue error: %s", err)
+	}
+	if toMerkleValue.TxParam.ToChainID != this.config.NeoChainID {
+		return nil, fmt.Errorf("cross chain tx is to chain %d, not neo chain %d",
+			toMerkleValue.TxParam.ToChainID, this.config.NeoChainID)
+	}
+	return toMerkleValue, nil
+}
+
+// polyKeepers returns the compressed public keys of the book keepers of the poly key header synced to neo, which is
+// at lastSynced-1
+func (this *SyncService) polyKeepers(lastSynced uint32) (map[string]bool, error) {
+	if lastSynced == 0 {
+		return nil, fmt.Errorf("no poly key header is synced to neo")
+	}
+	keyHeader, err := this.relaySdk.GetHeaderByHeight(lastSynced - 1)
+	if err != nil {
+		return nil, fmt.Errorf("GetHeaderByHeight error: %s, height: %d", err, lastSynced-1)
+	}
+	blkInfo := &vconfig.VbftBlockInfo{}
+	if err := json.Unmarshal(keyHeader.ConsensusPayload, blkInfo); err != nil {
+		return nil, fmt.Errorf("consensus payload of poly key header %d error: %s", keyHeader.Height, err)
+	}
+	if blkInfo.NewChainConfig == nil || len(blkInfo.NewChainConfig.Peers) == 0 {
+		return nil, fmt.Errorf("poly header %d synced to neo has no book keepers", keyHeader.Height)
+	}
+	keepers := make(map[string]bool)
+	for _, peer := range blkInfo.NewChainConfig.Peers {
+		keyBytes, err := hex.DecodeString(peer.ID)
+		if err != nil {
+			return nil, fmt.Errorf("book keeper %s of poly key header %d error: %s", peer.ID, keyHeader.Height, err)
+		}
+		key, err := keypair.DeserializePublicKey(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("book keeper %s of poly key header %d error: %s", peer.ID, keyHeader.Height, err)
+		}
+		ecKey, ok := key.(*ec.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("book keeper %s of poly key header %d is not an ec key", peer.ID, keyHeader.Height)
+		}
+		keepers[helper.BytesToHex(ec.EncodePublicKey(ecKey.PublicKey, true))] = true
+	}
+	return keepers, nil
+}
+
+// verifyPolySigs recovers the signers of header from the eth compatible signatures in signList, and checks that more
+// than 2/3 of keepers are among them
+func verifyPolySigs(header *types.Header, signList []byte, keepers map[string]bool) error {
+	if len(signList)%POLY_SIGNATURE_LEN != 0 {
+		return fmt.Errorf("sign list of poly header %d has %d bytes, not a multiple of %d",
+			header.Height, len(signList), POLY_SIGNATURE_LEN)
+	}
+	// the book keepers sign the sha256 of the header hash
+	digest := crypto.Sha256(crypto.Hash256(header.GetMessage()))
+	signers := make(map[string]bool)
+	for i := 0; i < len(signList); i += POLY_SIGNATURE_LEN {
+		sig := signList[i : i+POLY_SIGNATURE_LEN]
+		compact := append([]byte{sig[POLY_SIGNATURE_LEN-1] + 27}, sig[:POLY_SIGNATURE_LEN-1]...)
+		key, _, err := btcec.RecoverCompact(btcec.S256(), compact, digest)
+		if err != nil {
+			return fmt.Errorf("signature %d of poly header %d error: %s", i/POLY_SIGNATURE_LEN, header.Height, err)
+		}
+		signer := helper.BytesToHex(key.SerializeCompressed())
+		if keepers[signer] {
+			signers[signer] = true
+		}
+	}
+	n := len(keepers)
+	m := n - (n-1)/3
+	if len(signers) < m {
+		return fmt.Errorf("poly header %d is signed by %d of %d book keepers, %d are needed",
+			header.Height, len(signers), n, m)
+	}
+	return nil
+}
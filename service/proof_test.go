@@ -0,0 +1,149 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/ontio/ontology-crypto/keypair"
+	"github.com/ontio/ontology-crypto/signature"
+	pCommon "github.com/polynetwork/poly/common"
+	vconfig "github.com/polynetwork/poly/consensus/vbft/config"
+	"github.com/polynetwork/poly/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPolyKeepers are the book keepers of the poly key header synced to neo in the rton tests
+var testPolyKeepers = newPolyKeepers(4)
+
+func newPolyKeepers(n int) []keypair.PrivateKey {
+	keepers := make([]keypair.PrivateKey, n)
+	for i := range keepers {
+		keepers[i], _, _ = keypair.GenerateKeyPair(keypair.PK_ECDSA, keypair.SECP256K1)
+	}
+	return keepers
+}
+
+// polyKeyHeader makes a poly key header at height which changes the book keepers to keepers
+func polyKeyHeader(t *testing.T, height uint32, keepers []keypair.PrivateKey) *types.Header {
+	peers := make([]*vconfig.PeerConfig, len(keepers))
+	for i, keeper := range keepers {
+		peers[i] = &vconfig.PeerConfig{Index: uint32(i + 1), ID: hex.EncodeToString(keypair.SerializePublicKey(keeper.Public()))}
+	}
+	payload, err := json.Marshal(&vconfig.VbftBlockInfo{NewChainConfig: &vconfig.ChainConfig{N: uint32(len(keepers)), Peers: peers}})
+	assert.Nil(t, err)
+	return &types.Header{Height: height, ConsensusPayload: payload}
+}
+
+// signPolyHeader adds the signatures of keepers to header
+func signPolyHeader(t *testing.T, header *types.Header, keepers []keypair.PrivateKey) {
+	hash := header.Hash()
+	for _, keeper := range keepers {
+		sig, err := signature.Sign(signature.SHA256withECDSA, keeper, hash[:], nil)
+		assert.Nil(t, err)
+		data, err := signature.Serialize(sig)
+		assert.Nil(t, err)
+		header.SigData = append(header.SigData, data)
+	}
+}
+
+// ethSignList is the sign list of header sent to neo
+func ethSignList(t *testing.T, header *types.Header) []byte {
+	signList := []byte{}
+	for _, sig := range header.SigData {
+		ethSig, err := signature.ConvertToEthCompatible(sig)
+		assert.Nil(t, err)
+		signList = append(signList, ethSig...)
+	}
+	return signList
+}
+
+func TestRelayToNeo_RejectProof(t *testing.T) {
+	s, neoFake, polyFake, clean := newRtonTestService(t)
+	defer clean()
+	header := polyFake.headers[testPolyTxHeight+1]
+	header.SigData = nil
+	signPolyHeader(t, header, testPolyKeepers[:2])
+
+	// no tx is sent, the proof is retried
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Empty(t, neoFake.sent)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, uint32(1), retries[0].Attempts)
+	assert.Contains(t, retries[0].LastError, "proof rejected: poly header 11 is signed by 2 of 4 book keepers, 3 are needed")
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+
+	// once enough keepers sign, the retry is sent
+	signPolyHeader(t, header, testPolyKeepers[2:3])
+	assert.Nil(t, s.retrySyncProofToNeo(retries[0], testPolyLastSynced))
+	assert.Equal(t, 1, len(neoFake.sent))
+	retry, err := s.db.GetNeoRetry(retries[0].Id())
+	assert.Nil(t, err)
+	assert.Nil(t, retry)
+}
+
+func TestSyncService_verifyPolyProof(t *testing.T) {
+	s, _, polyFake, clean := newRtonTestService(t)
+	defer clean()
+	header := polyFake.headers[testPolyTxHeight+1]
+	path, err := hex.DecodeString(polyFake.proofs["10"+testUnlockKey])
+	assert.Nil(t, err)
+	signList := ethSignList(t, header)
+
+	// in the epoch of the key header
+	value, err := s.verifyPolyProof(path, header, nil, nil, signList, testPolyLastSynced)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(testNeoChainID), value.TxParam.ToChainID)
+
+	_, err = s.verifyPolyProof(path, header, nil, nil, signList[1:], testPolyLastSynced)
+	assert.EqualError(t, err, "sign list of poly header 11 has 259 bytes, not a multiple of 65")
+
+	stranger := &types.Header{Height: header.Height, CrossStateRoot: header.CrossStateRoot}
+	signPolyHeader(t, stranger, append(newPolyKeepers(2), testPolyKeepers[:2]...))
+	_, err = s.verifyPolyProof(path, stranger, nil, nil, ethSignList(t, stranger), testPolyLastSynced)
+	assert.EqualError(t, err, "poly header 11 is signed by 2 of 4 book keepers, 3 are needed")
+
+	tampered := append([]byte{}, path...)
+	tampered[len(tampered)-1]++
+	_, err = s.verifyPolyProof(tampered, header, nil, nil, signList, testPolyLastSynced)
+	assert.Contains(t, err.Error(), "tx proof against the cross state root of poly header 11 error")
+
+	s.config.NeoChainID = testNeoChainID + 1
+	_, err = s.verifyPolyProof(path, header, nil, nil, signList, testPolyLastSynced)
+	assert.EqualError(t, err, "cross chain tx is to chain 4, not neo chain 5")
+	s.config.NeoChainID = testNeoChainID
+
+	_, err = s.verifyPolyProof(path, header, nil, nil, signList, 0)
+	assert.EqualError(t, err, "no poly key header is synced to neo")
+
+	// before the key header, header is proved against the block root of the header after the key header
+	polyFake.headers[19] = polyKeyHeader(t, 19, testPolyKeepers)
+	_, err = s.verifyPolyProof(path, header, nil, nil, signList, 20)
+	assert.EqualError(t, err, "poly header 11 is before the key header 19 synced to neo, and has no header proof")
+
+	hash := header.Hash()
+	headerProof := pCommon.NewZeroCopySink(nil)
+	headerProof.WriteVarBytes(hash[:])
+	blockRoot, err := pCommon.Uint256ParseFromBytes(HashLeaf(hash[:]))
+	assert.Nil(t, err)
+	reliable := &types.Header{Height: 20, BlockRoot: blockRoot}
+	signPolyHeader(t, reliable, testPolyKeepers)
+	value, err = s.verifyPolyProof(path, header, headerProof.Bytes(), reliable, ethSignList(t, reliable), 20)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(testNeoChainID), value.TxParam.ToChainID)
+
+	other := polyFake.headers[19].Hash()
+	otherProof := pCommon.NewZeroCopySink(nil)
+	otherProof.WriteVarBytes(other[:])
+	blockRoot, err = pCommon.Uint256ParseFromBytes(HashLeaf(other[:]))
+	assert.Nil(t, err)
+	reliable = &types.Header{Height: 20, BlockRoot: blockRoot}
+	signPolyHeader(t, reliable, testPolyKeepers)
+	_, err = s.verifyPolyProof(path, header, otherProof.Bytes(), reliable, ethSignList(t, reliable), 20)
+	assert.Contains(t, err.Error(), "header proof of poly header 11 proves")
+
+	_, err = s.verifyPolyProof(path, header, otherProof.Bytes(), reliable, signList, 20)
+	assert.EqualError(t, err, "poly header 20 is signed by 0 of 4 book keepers, 3 are needed")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	neoRpc "github.com/joeqian10/neo-gogogo/rpc"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+// stuckNeoTx reports whether the tx of check is still not in a block NeoReplaceBlocks after it is first checked at
+// neoHeight. The height of the first check is saved with check.
+func (this *SyncService) stuckNeoTx(txHash string, check *db.NeoCheck, neoHeight uint32) bool {
+	if this.config.NeoReplaceBlocks == 0 || neoHeight == 0 {
+		return false
+	}
+	if check.SentHeight == 0 {
+		check.SentHeight = neoHeight
+		if err := this.db.PutNeoCheck(txHash, check); err != nil {
+			log.Errorf("[stuckNeoTx] this.db.PutNeoCheck error: %s, tx: %s", err, txHash)
+		}
+		return false
+	}
+	return neoHeight >= check.SentHeight+this.config.NeoReplaceBlocks
+}
+
+// replaceNeoTx rebuilds the tx of txHash with the same inputs and a higher fee, which is paid from its change, and
+// sends it in place of the tx. The check of the tx is moved to the replacement, with txHash added to the hashes it
+// replaced. Only one of them can be in a block, since they spend the same inputs, so the cross chain tx is settled
+// by whichever is. It returns the hash of the replacement.
+func (this *SyncService) replaceNeoTx(txHash string, check *db.NeoCheck) (string, error) {
+	if check.RawTx == "" {
+		return "", fmt.Errorf("[replaceNeoTx] raw tx of %s is not kept", txHash)
+	}
+	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
+	if err != nil {
+		return "", fmt.Errorf("[replaceNeoTx] AddressToScriptHash error: %s", err)
+	}
+	oldFee := helper.NewFixed8(check.Fee)
+	var itx *tx.InvocationTransaction
+	var fee helper.Fixed8
+	var dropped map[db.NeoUtxo]*db.NeoChange
+	err = this.utxos.spend(func() (neoTx, error) {
+		var err error
+		itx, err = tx.NewInvocationTransaction(nil).FromHexString(check.RawTx)
+		if err != nil {
+			return nil, fmt.Errorf("FromHexString error: %s", err)
+		}
+		var ok bool
+		fee, ok = this.fees.replaceFee(itx.Size(), itx.Gas, oldFee, uint32(len(check.Replaced))+1)
+		if !ok {
+			return nil, fmt.Errorf("fee %s can not be raised under NeoFeeMax", oldFee.String())
+		}
+		raise := fee.Sub(oldFee)
+		change := changeOutput(itx, from)
+		if change == nil || !change.Value.GreaterThan(raise) {
+			return nil, fmt.Errorf("change of %s can not pay %s more fee", txHash, raise.String())
+		}
+		dropped, err = this.utxos.dropChanges(txHash)
+		if err != nil {
+			return nil, err
+		}
+		change.Value = change.Value.Sub(raise)
+		itx.Witnesses = []*tx.Witness{}
+		return itx, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("[replaceNeoTx] %s", err)
+	}
+	// the inputs and the changes go back to the tx replaced if the replacement is not sent
+	restore := func() {
+		if err := this.utxos.reserve(txHash, itx.Inputs); err != nil {
+			log.Errorf("[replaceNeoTx] this.utxos.reserve error: %s, tx: %s", err, txHash)
+		}
+		if err := this.utxos.restoreChanges(dropped); err != nil {
+			log.Errorf("[replaceNeoTx] this.utxos.restoreChanges error: %s, tx: %s", err, txHash)
+		}
+	}
+	if err := tx.AddSignature(itx, this.neoAccount.KeyPair); err != nil {
+		restore()
+		return "", fmt.Errorf("[replaceNeoTx] tx.AddSignature error: %s", err)
+	}
+	response := this.neoSdk.SendRawTransaction(itx.RawTransactionString())
+	if response.HasError() {
+		restore()
+		return "", fmt.Errorf("[replaceNeoTx] SendRawTransaction error: %s", response.GetErrorInfo())
+	}
+
+	newHash := itx.HashString()
+	if err := this.utxos.chain(itx); err != nil {
+		log.Errorf("[replaceNeoTx] this.utxos.chain error: %s, tx: %s", err, newHash)
+	}
+	if _, err := this.db.AddNeoFee(feeDay(time.Now()), fee.Sub(oldFee).Value); err != nil {
+		log.Errorf("[replaceNeoTx] this.db.AddNeoFee error: %s, tx: %s", err, newHash)
+	}
+	replacement := &db.NeoCheck{
+		Method:   check.Method,
+		Retry:    check.Retry,
+		SentAt:   time.Now().Unix(),
+		Fee:      fee.Value,
+		RawTx:    itx.RawTransactionString(),
+		Replaced: append(append([]string{}, check.Replaced...), txHash),
+	}
+	if err := this.db.PutNeoCheck(newHash, replacement); err != nil {
+		return "", fmt.Errorf("[replaceNeoTx] this.db.PutNeoCheck error: %s", err)
+	}
+	if err := this.db.DeleteNeoCheck(txHash); err != nil {
+		return "", fmt.Errorf("[replaceNeoTx] this.db.DeleteNeoCheck error: %s", err)
+	}
+	return newHash, nil
+}
+
+// neoApplicationLog looks up the application log of the tx of txHash, then of the txs it replaced. It returns the
+// hash of the tx found, or txHash with its response if none is found.
+func (this *SyncService) neoApplicationLog(txHash string, replaced []string) (string, neoRpc.GetApplicationLogResponse) {
+	response := this.neoSdk.GetApplicationLog("0x" + txHash)
+	if response.NetError != nil || !response.HasError() {
+		return txHash, response
+	}
+	for _, hash := range replaced {
+		r := this.neoSdk.GetApplicationLog("0x" + hash)
+		if r.NetError != nil || !r.HasError() {
+			return hash, r
+		}
+	}
+	return txHash, response
+}
+
+// changeOutput is the gas output of itx back to from
+func changeOutput(itx *tx.InvocationTransaction, from helper.UInt160) *tx.TransactionOutput {
+	for _, output := range itx.Outputs {
+		if output.AssetId == tx.GasToken && output.ScriptHash == from {
+			return output
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// mineNeoBlocks raises the height of neoFake by count
+func mineNeoBlocks(neoFake *fakeNeo, count int) {
+	for i := 0; i < count; i++ {
+		neoFake.blocks[uint32(len(neoFake.blocks))] = models.RpcBlock{}
+	}
+}
+
+func TestRelayToNeo_ReplaceStuckTx(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	s.config.NeoReplaceBlocks = 2
+	mineNeoBlocks(neoFake, 10)
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash1, _ := onlyNeoCheck(t, s)
+	neoFake.mempool = []string{"0x" + txHash1}
+
+	// the height of the first check is kept, the tx is not stuck before NeoReplaceBlocks
+	assert.Nil(t, s.checkNeoDoneTx())
+	_, check := onlyNeoCheck(t, s)
+	assert.Equal(t, uint32(10), check.SentHeight)
+	mineNeoBlocks(neoFake, 1)
+	assert.Nil(t, s.checkNeoDoneTx())
+	assert.Equal(t, 1, len(neoFake.sent))
+
+	// a tx in the mempool is not replaced
+	mineNeoBlocks(neoFake, 1)
+	assert.Nil(t, s.checkNeoDoneTx())
+	assert.Equal(t, 1, len(neoFake.sent))
+
+	// the replacement spends the same inputs with a higher fee once the tx leaves the mempool
+	neoFake.mempool = nil
+	assert.Nil(t, s.checkNeoDoneTx())
+	assert.Equal(t, 2, len(neoFake.sent))
+	txHash2, replacement := onlyNeoCheck(t, s)
+	assert.NotEqual(t, txHash1, txHash2)
+	assert.Equal(t, []string{txHash1}, replacement.Replaced)
+	assert.Equal(t, check.Retry, replacement.Retry)
+	assert.Equal(t, check.Fee+helper.Fixed8FromFloat64(PRIORITY_FEE).Value, replacement.Fee)
+	assert.Equal(t, neoFake.sent[1], replacement.RawTx)
+	tx1, err := tx.NewInvocationTransaction(nil).FromHexString(check.RawTx)
+	assert.Nil(t, err)
+	tx2, err := tx.NewInvocationTransaction(nil).FromHexString(replacement.RawTx)
+	assert.Nil(t, err)
+	assert.Equal(t, tx1.Inputs, tx2.Inputs)
+	assert.Equal(t, tx1.Script, tx2.Script)
+	state, err := s.db.GetUtxo(neoUtxoOf(tx.ToCoinReference(testGasUnspent)))
+	assert.Nil(t, err)
+	assert.Equal(t, txHash2, state.TxHash)
+	assert.NotContains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash1, Index: 0})
+	assert.Contains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash2, Index: 0})
+
+	// the tx replaced is in a block after all, the transfer is settled once
+	neoFake.appLogs["0x"+txHash1] = models.RpcApplicationLog{Executions: []models.RpcExecution{{VMState: "HALT"}}}
+	assert.Nil(t, s.checkNeoDoneTx())
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checkMap)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+	assert.NotContains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash2, Index: 0})
+}
+
+func TestRelayToNeo_ReplaceSpentChange(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	s.config.NeoReplaceBlocks = 1
+	mineNeoBlocks(neoFake, 10)
+
+	// the second tx spends the change of the first
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash1, _ := onlyNeoCheck(t, s)
+	assert.Nil(t, s.retrySyncProofToNeo(db.NewRetry(testPolyTxHeight, testUnlockKey), testPolyLastSynced))
+	assert.Nil(t, s.checkNeoDoneTx())
+	mineNeoBlocks(neoFake, 1)
+	assert.Nil(t, s.checkNeoDoneTx())
+
+	// the first is left alone, the second is replaced
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(checkMap))
+	assert.Equal(t, 3, len(neoFake.sent))
+	assert.Contains(t, checkMap, txHash1)
+	assert.Empty(t, checkMap[txHash1].Replaced)
+	assert.Equal(t, uint32(11), checkMap[txHash1].SentHeight)
+	assert.Contains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash1, Index: 0})
+}
+
+func TestRelayToNeo_ReplaceSendError(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+	s.config.NeoReplaceBlocks = 1
+	mineNeoBlocks(neoFake, 10)
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash1, _ := onlyNeoCheck(t, s)
+	assert.Nil(t, s.checkNeoDoneTx())
+	mineNeoBlocks(neoFake, 1)
+	neoFake.sendError = "Block or transaction validation failed"
+	assert.Nil(t, s.checkNeoDoneTx())
+
+	// the tx is kept with its inputs and its change
+	assert.Equal(t, 1, len(neoFake.sent))
+	_, check := onlyNeoCheck(t, s)
+	assert.Empty(t, check.Replaced)
+	state, err := s.db.GetUtxo(neoUtxoOf(tx.ToCoinReference(testGasUnspent)))
+	assert.Nil(t, err)
+	assert.Equal(t, txHash1, state.TxHash)
+	change := db.NeoUtxo{TxId: txHash1, Index: 0}
+	assert.Contains(t, s.utxos.changes, change)
+	stored, err := s.db.GetAllNeoChange()
+	assert.Nil(t, err)
+	assert.Contains(t, stored, change)
+
+	// and replaced once neo takes the replacement
+	neoFake.sendError = ""
+	mineNeoBlocks(neoFake, 1)
+	assert.Nil(t, s.checkNeoDoneTx())
+	assert.Equal(t, 2, len(neoFake.sent))
+	assert.NotContains(t, s.utxos.changes, change)
+}
+
+func TestFeePolicy_replaceFee(t *testing.T) {
+	cfg := &config.Config{NeoNetFee: 0.001, NeoFeeEscalation: 1}
+	fees := newFeePolicy(newFakeNeo(), cfg)
+	gas := helper.Fixed8FromFloat64(1)
+
+	// escalated over the least raise
+	fee, ok := fees.replaceFee(300, gas, helper.Fixed8FromFloat64(1.001), 2)
+	assert.True(t, ok)
+	assert.Equal(t, helper.Fixed8FromFloat64(1.004), fee)
+
+	// raised by PRIORITY_FEE at least
+	fee, ok = fees.replaceFee(300, gas, helper.Fixed8FromFloat64(1.01), 1)
+	assert.True(t, ok)
+	assert.Equal(t, helper.Fixed8FromFloat64(1.01).Add(helper.Fixed8FromFloat64(PRIORITY_FEE)), fee)
+
+	// not over NeoFeeMax
+	cfg.NeoFeeMax = 0.01
+	_, ok = fees.replaceFee(300, gas, helper.Fixed8FromFloat64(1.01), 1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/notify"
+)
+
+const (
+	UTXO_NOT_ENOUGH    = "chooseUtxos, current utxo is not enough" // relay account on poly
+	BALANCE_NOT_ENOUGH = "not enough balance in address"           // neo account
+	TX_ALREADY_DONE    = "checkDoneTx, tx already done"
+)
+
+// failRetry records a failed attempt of retry, and schedules the next one with exponential backoff,
+// or moves it to the dead letter bucket when it runs out of attempts
+func (this *SyncService) failRetry(direction string, retry *db.Retry, cause error) error {
+	now := time.Now().Unix()
+	if retry.FirstSeen == 0 {
+		retry.FirstSeen = now
+	}
+	retry.Attempts++
+	retry.LastError = cause.Error()
+
+	maxAttempts := this.config.RetryMaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = config.DEFAULT_RETRY_ATTEMPTS
+	}
+	if retry.Attempts >= maxAttempts {
+		log.Errorf("[failRetry] %s retry failed %d times, move to dead letter, height: %d, key: %s, last error: %s",
+			direction, retry.Attempts, retry.Height, retry.Key, retry.LastError)
+		this.alert(notify.CRITICAL, EVENT_DEAD_LETTER, "%s transfer failed %d times, height: %d, key: %s, last error: %s",
+			direction, retry.Attempts, retry.Height, retry.Key, retry.LastError)
+		return this.db.PutDeadLetter(deadPrefix(direction), retry)
+	}
+
+	retry.NextAttempt = now + this.retryDelay(retry.Attempts)
+	log.Infof("[failRetry] %s retry failed %d times, next attempt at %s, height: %d, key: %s",
+		direction, retry.Attempts, time.Unix(retry.NextAttempt, 0).Format(time.RFC3339), retry.Height, retry.Key)
+	return this.putRetry(direction, retry)
+}
+
+// postponeRetry schedules retry again without counting an attempt, for errors of the relayer itself like lack of fee
+func (this *SyncService) postponeRetry(direction string, retry *db.Retry, cause error) error {
+	this.lackOfFee(cause)
+	retry.LastError = cause.Error()
+	retry.NextAttempt = time.Now().Unix() + this.retryDelay(1)
+	return this.putRetry(direction, retry)
+}
+
+func (this *SyncService) putRetry(direction string, retry *db.Retry) error {
+	if direction == RTON {
+		return this.db.PutNeoRetry(retry)
+	}
+	return this.db.PutRetry(retry)
+}
+
+// retryDelay is RetryInterval * 2^(attempts-1) in seconds, capped by RetryMaxDelay
+func (this *SyncService) retryDelay(attempts uint32) int64 {
+	maxDelay := int64(this.config.RetryMaxDelay)
+	if maxDelay == 0 {
+		maxDelay = config.DEFAULT_RETRY_MAX_DELAY
+	}
+	delay := int64(this.config.RetryInterval)
+	if delay == 0 {
+		delay = 1
+	}
+	for i := uint32(1); i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// isDue reports whether retry should be attempted now
+func isDue(retry *db.Retry) bool {
+	return retry.NextAttempt <= time.Now().Unix()
+}
+
+// settleRetry updates retry in db by the result of an attempt: deleted if it is relayed or already done,
+// postponed if the relayer lacks fee, otherwise failed
+func (this *SyncService) settleRetry(direction string, retry *db.Retry, cause error) error {
+	if cause == nil || strings.Contains(cause.Error(), TX_ALREADY_DONE) {
+		var err error
+		if direction == RTON {
+			err = this.db.DeleteNeoRetry(retry.Id())
+		} else {
+			err = this.db.DeleteRetry(retry.Id())
+		}
+		if err != nil {
+			return fmt.Errorf("[settleRetry] delete %s retry error: %s", direction, err)
+		}
+		return cause
+	}
+
+	var err error
+	if isLackOfFee(cause) {
+		log.Infof("[settleRetry] postpone %s retry, height: %d, key: %s, error: %s", direction, retry.Height, retry.Key, cause)
+		err = this.postponeRetry(direction, retry, cause)
+	} else {
+		err = this.failRetry(direction, retry, cause)
+	}
+	if err != nil {
+		return fmt.Errorf("[settleRetry] put %s retry error: %s, cause: %s", direction, err, cause)
+	}
+	return cause
+}
+
+// isLackOfFee reports whether err is caused by the balance of the relayer accounts, which does not count as an attempt
+func isLackOfFee(err error) bool {
+	return strings.Contains(err.Error(), UTXO_NOT_ENOUGH) || strings.Contains(err.Error(), BALANCE_NOT_ENOUGH)
+}
@@ -15,8 +15,11 @@ import (
 	"github.com/ontio/ontology-crypto/keypair"
 	"github.com/ontio/ontology-crypto/signature"
 	"github.com/ontio/ontology-crypto/sm2"
+	"github.com/polynetwork/neo-relayer/config"
 	"github.com/polynetwork/neo-relayer/db"
 	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+	"github.com/polynetwork/neo-relayer/notify"
 	"github.com/polynetwork/poly/common"
 	"github.com/polynetwork/poly/core/types"
 	"sort"
@@ -106,14 +109,13 @@ func (this *SyncService) changeBookKeeper(block *types.Block) error {
 
 	script := sb.ToArray()
 
-	tb := tx.NewTransactionBuilder(this.config.NeoJsonRpcUrl)
 	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
 	// create an InvocationTransaction
 	sysFee := helper.Fixed8FromFloat64(this.config.NeoSysFee)
-	netFee := helper.Fixed8FromFloat64(this.config.NeoNetFee)
-	itx, err := tb.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
+	netFee := this.fees.netFee(0)
+	itx, err := this.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
 	if err != nil {
-		return fmt.Errorf("[changeBookKeeper] tb.MakeInvocationTransaction error: %s", err)
+		return fmt.Errorf("[changeBookKeeper] MakeInvocationTransaction error: %s", err)
 	}
 	// sign transaction
 	err = tx.AddSignature(itx, this.neoAccount.KeyPair)
@@ -126,6 +128,7 @@ func (this *SyncService) changeBookKeeper(block *types.Block) error {
 	// send the raw transaction
 	response := this.neoSdk.SendRawTransaction(rawTxString)
 	if response.HasError() {
+		this.refuseTx(itx)
 		return fmt.Errorf("[changeBookKeeper] SendRawTransaction error: %s, "+
 			"unsigned header hex string: %s, "+
 			"public keys hex string: %s, "+
@@ -141,6 +144,11 @@ func (this *SyncService) changeBookKeeper(block *types.Block) error {
 	}
 
 	log.Infof("[changeBookKeeper] neoTxHash is: %s", itx.HashString())
+	fee := this.sentToNeo(itx)
+	err = this.putNeoCheck(itx, fee, CHANGE_BOOK_KEEPER, &db.Retry{Height: block.Header.Height})
+	if err != nil {
+		return fmt.Errorf("[changeBookKeeper] %s", err)
+	}
 	this.waitForNeoBlock()
 	return nil
 }
@@ -185,14 +193,13 @@ func (this *SyncService) syncHeaderToNeo(height uint32) error {
 
 	script := sb.ToArray()
 
-	tb := tx.NewTransactionBuilder(this.config.NeoJsonRpcUrl)
 	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
 	// create an InvocationTransaction
 	sysFee := helper.Fixed8FromFloat64(this.config.NeoSysFee)
-	netFee := helper.Fixed8FromFloat64(this.config.NeoNetFee)
-	itx, err := tb.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
+	netFee := this.fees.netFee(0)
+	itx, err := this.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
 	if err != nil {
-		return fmt.Errorf("[syncHeaderToNeo] tb.MakeInvocationTransaction error: %s", err)
+		return fmt.Errorf("[syncHeaderToNeo] MakeInvocationTransaction error: %s", err)
 	}
 
 	// sign transaction
@@ -206,6 +213,7 @@ func (this *SyncService) syncHeaderToNeo(height uint32) error {
 	// send the raw transaction
 	response := this.neoSdk.SendRawTransaction(rawTxString)
 	if response.HasError() {
+		this.refuseTx(itx)
 		return fmt.Errorf("[syncHeaderToNeo] SendRawTransaction error: %s, "+
 			"unsigned header hex string: %s, "+
 			"public keys hex string: %s, "+
@@ -221,6 +229,11 @@ func (this *SyncService) syncHeaderToNeo(height uint32) error {
 	}
 
 	log.Infof("[syncHeaderToNeo] neoTxHash is: %s", itx.HashString())
+	fee := this.sentToNeo(itx)
+	err = this.putNeoCheck(itx, fee, SYNC_BLOCK_HEADER, &db.Retry{Height: height})
+	if err != nil {
+		return fmt.Errorf("[syncHeaderToNeo] %s", err)
+	}
 	this.waitForNeoBlock()
 	return nil
 }
@@ -228,7 +241,7 @@ func (this *SyncService) syncHeaderToNeo(height uint32) error {
 func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32) error {
 	blockHeightReliable := lastSynced + 1
 	// get the proof of the cross chain tx
-	crossStateProof, err := this.relaySdk.ClientMgr.GetCrossStatesProof(txHeight, key)
+	crossStateProof, err := this.relaySdk.GetCrossStatesProof(txHeight, key)
 	if err != nil {
 		return fmt.Errorf("[syncProofToNeo] GetCrossStatesProof error: %s", err)
 	}
@@ -254,27 +267,10 @@ func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32)
 	}
 	log.Infof("txProofHeader: " + helper.BytesToHex(headerToBeVerified.GetMessage()))
 
-	// check constraints
-	if this.config.RtonContract != "" { // if empty, relay everything
-		stateRootValue, err := MerkleProve(path, headerToBeVerified.CrossStateRoot.ToArray())
-		if err != nil {
-			return fmt.Errorf("[syncProofToNeo] MerkleProve error: %s", err)
-		}
-		toMerkleValue, err := DeserializeMerkleValue(stateRootValue)
-
-		if err != nil {
-			return fmt.Errorf("[syncProofToNeo] DeserializeMerkleValue error: %s", err)
-		}
-		if helper.BytesToHex(toMerkleValue.TxParam.ToContract) != this.config.RtonContract {
-			log.Infof(helper.BytesToHex(toMerkleValue.TxParam.ToContract))
-			log.Infof("This cross chain tx is not for this specific contract.")
-			return nil
-		}
-	}
-
 	var headerProofBytes []byte
 	var currentHeaderBytes []byte
 	var signListBytes []byte
+	var headerReliable *types.Header
 	if txHeight >= lastSynced {
 		// cross chain tx is in current epoch, no need for headerProof and currentHeader
 		headerProofBytes = []byte{}
@@ -298,7 +294,7 @@ func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32)
 		}
 
 		// get the raw current header
-		headerReliable, err := this.relaySdk.GetHeaderByHeight(blockHeightReliable)
+		headerReliable, err = this.relaySdk.GetHeaderByHeight(blockHeightReliable)
 		if err != nil {
 			return fmt.Errorf("[syncProofToNeo] GetHeaderByHeight error: %s", err)
 		}
@@ -330,33 +326,17 @@ func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32)
 	}
 	log.Infof("signList: " + helper.BytesToHex(signListBytes))
 
-	stateRootValue, err := MerkleProve(path, headerToBeVerified.CrossStateRoot.ToArray())
+	retry := db.NewRetry(txHeight, key)
+	_, transfer, err := this.admitPolyTx(retry, path, headerToBeVerified, headerProofBytes, headerReliable, signListBytes, lastSynced)
 	if err != nil {
-		return fmt.Errorf("[syncProofToNeo] MerkleProve error: %s", err)
+		if err := this.failRetry(RTON, retry, err); err != nil {
+			return fmt.Errorf("[syncProofToNeo] this.db.PutNeoRetry error: %s", err)
+		}
+		log.Errorf("[syncProofToNeo] put tx into retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(retry.Id()))
+		return fmt.Errorf("[syncProofToNeo] %s", err)
 	}
-	toMerkleValue, err := DeserializeMerkleValue(stateRootValue)
-	if err != nil {
-		return fmt.Errorf("[syncProofToNeo] DeserializeMerkleValue error: %s", err)
-	}
-	log.Infof("fromChainId: " + strconv.Itoa(int(toMerkleValue.FromChainID)))
-	log.Infof("polyTxHash: " + helper.BytesToHex(toMerkleValue.TxHash))
-	log.Infof("fromContract: " + helper.BytesToHex(toMerkleValue.TxParam.FromContract))
-	log.Infof("toChainId: " + strconv.Itoa(int(toMerkleValue.TxParam.ToChainID)))
-	log.Infof("sourceTxHash: " + helper.BytesToHex(toMerkleValue.TxParam.TxHash))
-	log.Infof("toContract: " + helper.BytesToHex(toMerkleValue.TxParam.ToContract))
-	log.Infof("method: " + helper.BytesToHex(toMerkleValue.TxParam.Method))
-	log.Infof("TxParamArgs: " + helper.BytesToHex(toMerkleValue.TxParam.Args))
-
-	//toAssetHash, toAddress, amount, err := DeserializeArgs(toMerkleValue.TxParam.Args)
-	//if err != nil {
-	//	return fmt.Errorf("[syncProofToNeo] DeserializeArgs error: %s", err)
-	//}
-	//log.Infof("toAssetHash: " + helper.BytesToHex(toAssetHash))
-	//log.Infof("toAddress: " + helper.BytesToHex(toAddress))
-	//log.Infof("amount: " + amount.String())
-
-	if helper.BytesToHex(toMerkleValue.TxParam.Method) != "756e6c6f636b" { // unlock
-		return fmt.Errorf("[syncProofToNeo] called method is invalid, height %d, key %s", txHeight, key)
+	if transfer == nil {
+		return nil
 	}
 
 	// build script
@@ -372,26 +352,19 @@ func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32)
 	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
 	log.Infof("from: " + helper.BytesToHex(from.Bytes())) // little endian
 
-	retry := &db.Retry{
-		Height: txHeight,
-		Key:    key,
-	}
-	sink := common.NewZeroCopySink(nil)
-	retry.Serialization(sink)
-
 	// create an InvocationTransaction
 	sysFee := helper.Fixed8FromFloat64(this.config.NeoSysFee)
-	netFee := helper.Fixed8FromFloat64(this.config.NeoNetFee)
+	netFee := this.fees.netFee(0)
 	itx, err := this.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "not enough balance in address") {
+		if isLackOfFee(err) {
 			// utxo is not enough, put into NeoRetry
-			err = this.db.PutNeoRetry(sink.Bytes())
+			err = this.postponeRetry(RTON, retry, err)
 			if err != nil {
 				return fmt.Errorf("[syncProofToNeo] this.db.PutNeoRetry error: %s", err)
 			}
-			log.Infof("[syncProofToNeo] put tx into retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(sink.Bytes()))
+			log.Infof("[syncProofToNeo] put tx into retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(retry.Id()))
 			return nil
 		}
 		return fmt.Errorf("[syncProofToNeo] tb.MakeInvocationTransaction error: %s", err)
@@ -408,44 +381,104 @@ func (this *SyncService) syncProofToNeo(key string, txHeight, lastSynced uint32)
 	// send the raw transaction
 	response := this.neoSdk.SendRawTransaction(rawTxString)
 	if response.HasError() {
-		err = this.db.PutNeoRetry(sink.Bytes())
+		this.refuseTx(itx)
+		err = this.failRetry(RTON, retry, fmt.Errorf("SendRawTransaction error: %s", response.ErrorResponse.Error.Message))
 		if err != nil {
-			return fmt.Errorf("[syncProofToRelay] this.db.PutNeoRetry error: %s", err)
+			return fmt.Errorf("[syncProofToNeo] this.db.PutNeoRetry error: %s", err)
 		}
-		log.Errorf("[syncProofToNeo] put tx into retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(sink.Bytes()))
+		log.Errorf("[syncProofToNeo] put tx into retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(retry.Id()))
 		return fmt.Errorf("[syncProofToNeo] SendRawTransaction error: %s, path(cp1): %s, cp2: %d, syncProofToNeo RawTransactionString: %s",
 			response.ErrorResponse.Error.Message, helper.BytesToHex(path), int64(blockHeightReliable), rawTxString)
 	}
 	log.Infof("[syncProofToNeo] neoTxHash is: %s", itx.HashString())
-	// mark utxo
-	for _, unspent := range itx.Inputs {
-		neoUtxo := db.NeoUtxo{
-			TxId:  unspent.PrevHash.String(),
-			Index: int(unspent.PrevIndex),
-		}
-		sink := common.NewZeroCopySink(nil)
-		neoUtxo.Serialization(sink)
-		err := this.db.PutUtxo(sink.Bytes(), true)
-		if err != nil {
-			return err
-		}
+	log.Infof("[syncProofToNeo] relayed for contract %s, %d txs relayed for it", transfer.ToContract,
+		this.contracts.count(metrics.RELAY_TO_NEO, transfer.ToContract))
+	transfer.NeoTxHash = itx.HashString()
+	this.putTransfer(transfer, db.TRANSFER_SENT)
+	fee := this.sentToNeo(itx)
+	err = this.putNeoCheck(itx, fee, VERIFY_AND_EXECUTE_TX, retry)
+	if err != nil {
+		return fmt.Errorf("[syncProofToNeo] %s", err)
 	}
 
 	return nil
 }
 
-func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error {
-	retry := new(db.Retry)
-	err := retry.Deserialization(common.NewZeroCopySource(v))
+// admitPolyTx verifies the proof of the cross chain tx of retry the way the NEO CCMC does, then checks its target
+// contract and the policy. It records the transfer of a tx to be relayed and returns it with the verified value, both
+// are nil if the tx is not relayed. A transfer which can not be decoded is quarantined.
+func (this *SyncService) admitPolyTx(retry *db.Retry, path []byte, headerToBeVerified *types.Header, headerProofBytes []byte,
+	headerReliable *types.Header, signListBytes []byte, lastSynced uint32) (*ToMerkleValue, *db.Transfer, error) {
+	// reject the proof before paying for a tx the CCMC would fault on
+	toMerkleValue, err := this.verifyPolyProof(path, headerToBeVerified, headerProofBytes, headerReliable, signListBytes, lastSynced)
+	if err != nil {
+		return nil, nil, fmt.Errorf("proof rejected: %s", err)
+	}
+	log.Infof("fromChainId: " + strconv.Itoa(int(toMerkleValue.FromChainID)))
+	log.Infof("polyTxHash: " + helper.BytesToHex(toMerkleValue.TxHash))
+	log.Infof("fromContract: " + helper.BytesToHex(toMerkleValue.TxParam.FromContract))
+	log.Infof("toChainId: " + strconv.Itoa(int(toMerkleValue.TxParam.ToChainID)))
+	log.Infof("sourceTxHash: " + helper.BytesToHex(toMerkleValue.TxParam.TxHash))
+	log.Infof("toContract: " + helper.BytesToHex(toMerkleValue.TxParam.ToContract))
+	log.Infof("method: " + helper.BytesToHex(toMerkleValue.TxParam.Method))
+	log.Infof("TxParamArgs: " + helper.BytesToHex(toMerkleValue.TxParam.Args))
+
+	// check constraints, if empty, relay everything
+	toContract := helper.BytesToHex(toMerkleValue.TxParam.ToContract)
+	if len(this.config.RtonContract) > 0 && !this.config.RtonContract.Has(toContract) {
+		log.Infof("[admitPolyTx] cross chain tx to %s is not for any of the specific contracts, height: %d, key: %s",
+			toContract, retry.Height, retry.Key)
+		return nil, nil, nil
+	}
+	policyTx := newPolicyTx(config.POLICY_RTON, toMerkleValue.FromChainID, toMerkleValue.TxParam)
+	if allowed, rule := this.evaluatePolicy(policyTx); !allowed {
+		log.Infof("[admitPolyTx] skip the cross chain tx by policy rule %s, height: %d, key: %s, %s", rule,
+			retry.Height, retry.Key, policyTx)
+		return nil, nil, nil
+	}
+
+	// a transfer which can not be decoded is quarantined instead of being sent
+	transfer, err := newTransfer(retry, toMerkleValue)
+	if err != nil {
+		if err := this.quarantine(retry, transfer, err); err != nil {
+			return nil, nil, fmt.Errorf("this.db.PutDeadLetter error: %s", err)
+		}
+		return nil, nil, nil
+	}
+	log.Infof("toAssetHash: %s, toAddress: %s, amount: %s", transfer.AssetHash, transfer.ToAddress, transfer.Amount)
+	this.putTransfer(transfer, db.TRANSFER_DECODED)
+	return toMerkleValue, transfer, nil
+}
+
+// RelayPolyTx relays the cross chain tx with key in poly block at height, no matter which height is being scanned
+func (this *SyncService) RelayPolyTx(height uint32, key string) error {
+	currentNeoChainSyncHeight, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.GetChainId())
 	if err != nil {
-		return fmt.Errorf("[retrySyncProofToNeo] retry.Deserialization error: %s", err)
+		return fmt.Errorf("[RelayPolyTx] GetCurrentNeoChainSyncHeight error: %s", err)
 	}
+	log.Infof("[RelayPolyTx] relay poly tx at height %d, key %s", height, key)
+	err = this.syncProofToNeo(key, height, uint32(currentNeoChainSyncHeight))
+	metrics.ObserveCall("syncProofToNeo", err)
+	return err
+}
+
+// retrySyncProofToNeo makes one attempt of retry, and settles it in the NeoRetry bucket
+func (this *SyncService) retrySyncProofToNeo(retry *db.Retry, lastSynced uint32) error {
+	err := this.settleRetry(RTON, retry, this.sendRetryToNeo(retry, lastSynced))
+	if err != nil {
+		return fmt.Errorf("[retrySyncProofToNeo] %s", err)
+	}
+	return nil
+}
+
+// sendRetryToNeo sends the proof of retry to neo
+func (this *SyncService) sendRetryToNeo(retry *db.Retry, lastSynced uint32) error {
 	txHeight := retry.Height
 	key := retry.Key
 
 	blockHeightReliable := lastSynced + 1
 	// get the proof of the cross chain tx
-	crossStateProof, err := this.relaySdk.ClientMgr.GetCrossStatesProof(txHeight, key)
+	crossStateProof, err := this.relaySdk.GetCrossStatesProof(txHeight, key)
 	if err != nil {
 		return fmt.Errorf("[retrySyncProofToNeo] GetCrossStatesProof error: %s", err)
 	}
@@ -474,6 +507,7 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 	var headerProofBytes []byte
 	var currentHeaderBytes []byte
 	var signListBytes []byte
+	var headerReliable *types.Header
 	if txHeight >= lastSynced {
 		// cross chain tx is in current epoch, no need for headerProof and currentHeader
 		headerProofBytes = []byte{}
@@ -498,7 +532,7 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 		log.Infof("headerPath: " + helper.BytesToHex(headerProofBytes))
 
 		// get the raw current header
-		headerReliable, err := this.relaySdk.GetHeaderByHeight(blockHeightReliable)
+		headerReliable, err = this.relaySdk.GetHeaderByHeight(blockHeightReliable)
 		if err != nil {
 			return fmt.Errorf("[retrySyncProofToNeo] GetHeaderByHeight error: %s", err)
 		}
@@ -530,6 +564,14 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 	}
 	//log.Infof("signList: " + helper.BytesToHex(signListBytes))
 
+	_, transfer, err := this.admitPolyTx(retry, path, headerToBeVerified, headerProofBytes, headerReliable, signListBytes, lastSynced)
+	if err != nil {
+		return fmt.Errorf("[retrySyncProofToNeo] %s", err)
+	}
+	if transfer == nil {
+		return nil
+	}
+
 	// build script
 	scriptBuilder := sc.NewScriptBuilder()
 	scriptHash := helper.HexToBytes(this.config.NeoCCMC) // hex string to little endian byte[]
@@ -544,7 +586,7 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 
 	// create an InvocationTransaction
 	sysFee := helper.Fixed8FromFloat64(this.config.NeoSysFee)
-	netFee := helper.Fixed8FromFloat64(this.config.NeoNetFee)
+	netFee := this.fees.netFee(retry.Attempts)
 	itx, err := this.MakeInvocationTransaction(script, from, nil, from, sysFee, netFee)
 
 	////---------------------------------------
@@ -555,19 +597,7 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 	////----------------------------------------
 
 	if err != nil {
-		if strings.Contains(err.Error(), "not enough balance in address") {
-			// still the same error, just log and return
-			log.Infof("[retrySyncProofToNeo] remain tx in retry db, MakeInvocationTransaction error: %s", err)
-			return nil
-		} else {
-			// not because utxo is not enough, delete from db
-			err := this.db.DeleteNeoRetry(v)
-			if err != nil {
-				return fmt.Errorf("[retrySyncProofToNeo] this.db.DeleteNeoRetry error: %s", err)
-			}
-			log.Infof("[retrySyncProofToNeo] delete tx from retry db, height %d, key %s, db key %s", txHeight, key, helper.BytesToHex(v))
-			return fmt.Errorf("[retrySyncProofToNeo] tb.MakeInvocationTransaction error: %s", err)
-		}
+		return fmt.Errorf("[retrySyncProofToNeo] tb.MakeInvocationTransaction error: %s", err)
 	}
 
 	// sign transaction
@@ -581,38 +611,19 @@ func (this *SyncService) retrySyncProofToNeo(v []byte, lastSynced uint32) error
 	// send the raw transaction
 	response := this.neoSdk.SendRawTransaction(rawTxString)
 	if response.HasError() {
-		if strings.Contains(response.ErrorResponse.Error.Message, "Block or transaction validation failed") {
-			log.Infof("[retrySyncProofToNeo] remain tx in retry db, SendRawTransaction: height: %d, key: %s, db key: %s", txHeight, key, helper.BytesToHex(v))
-			return nil
-		}
-
-		err := this.db.DeleteNeoRetry(v)
-		if err != nil {
-			return fmt.Errorf("[retrySyncProofToNeo] this.db.DeleteNeoRetry error: %s", err)
-		}
-		log.Infof("[retrySyncProofToNeo] delete tx from retry db, height: %d, key: %s, db key: %s", txHeight, key, helper.BytesToHex(v))
+		this.refuseTx(itx)
 		return fmt.Errorf("[retrySyncProofToNeo] SendRawTransaction error: %s, path(cp1): %s, cp2: %d, syncProofToNeo RawTransactionString: %s",
 			response.ErrorResponse.Error.Message, helper.BytesToHex(path), int64(blockHeightReliable), rawTxString)
 	}
 	log.Infof("[retrySyncProofToNeo] neoTxHash is: %s", itx.HashString())
-	// mark utxo
-	for _, unspent := range itx.Inputs {
-		neoUtxo := db.NeoUtxo{
-			TxId:  unspent.PrevHash.String(),
-			Index: int(unspent.PrevIndex),
-		}
-		sink := common.NewZeroCopySink(nil)
-		neoUtxo.Serialization(sink)
-		err := this.db.PutUtxo(sink.Bytes(), true)
-		if err != nil {
-			return err
-		}
-	}
-	err = this.db.DeleteNeoRetry(v)
+	log.Infof("[retrySyncProofToNeo] relayed for contract %s, %d txs relayed for it", transfer.ToContract,
+		this.contracts.count(metrics.RELAY_TO_NEO, transfer.ToContract))
+	transfer.NeoTxHash = itx.HashString()
+	this.putTransfer(transfer, db.TRANSFER_SENT)
+	fee := this.sentToNeo(itx)
+	err = this.putNeoCheck(itx, fee, VERIFY_AND_EXECUTE_TX, retry)
 	if err != nil {
-		err := this.db.DeleteNeoRetry(v)
-		log.Infof("[retrySyncProofToNeo] delete tx from retry db, height: %d, key: %s, db key: %s", txHeight, key, helper.BytesToHex(v))
-		return fmt.Errorf("[retrySyncProofToNeo] this.db.DeleteNeoRetry error: %s", err)
+		return fmt.Errorf("[retrySyncProofToNeo] %s", err)
 	}
 	//this.waitForNeoBlock()
 	return nil
@@ -623,22 +634,163 @@ func (this *SyncService) neoRetryTx() error {
 	if err != nil {
 		return fmt.Errorf("[neoRetryTx] this.db.GetAllRetry error: %s", err)
 	}
-	for _, v := range retryList {
+	for _, retry := range retryList {
+		if this.isStopped() {
+			return nil
+		}
+		if !isDue(retry) {
+			continue
+		}
 		// get current neo chain sync height, which is the reliable header height
-		currentNeoChainSyncHeight, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.ChainId)
+		currentNeoChainSyncHeight, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.GetChainId())
 		if err != nil {
 			log.Errorf("[neoRetryTx] GetCurrentNeoChainSyncHeight error: %s", err)
 		}
-		err = this.retrySyncProofToNeo(v, uint32(currentNeoChainSyncHeight))
+		this.retryLock.Lock()
+		err = this.retrySyncProofToNeo(retry, uint32(currentNeoChainSyncHeight))
+		this.retryLock.Unlock()
 		if err != nil {
 			log.Errorf("[neoRetryTx] this.retrySyncProofToNeo error: %s", err)
 		}
-		time.Sleep(time.Duration(this.config.RetryInterval) * time.Second)
+		if !this.sleep(time.Duration(this.config.RetryInterval) * time.Second) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// putNeoCheck saves itx sent to neo with the fee it pays, it is checked by checkNeoDoneTx until it is found in a block
+func (this *SyncService) putNeoCheck(itx *tx.InvocationTransaction, fee helper.Fixed8, method string, retry *db.Retry) error {
+	check := &db.NeoCheck{
+		Method: method,
+		Retry:  *retry,
+		SentAt: time.Now().Unix(),
+		Fee:    fee.Value,
+		RawTx:  itx.RawTransactionString(),
+	}
+	if err := this.db.PutNeoCheck(itx.HashString(), check); err != nil {
+		return fmt.Errorf("this.db.PutNeoCheck error: %s", err)
+	}
+	return nil
+}
+
+// checkNeoDoneTx looks up the application logs of the txs sent to neo. A cross chain tx is put back into NeoRetry
+// if its tx faulted, or was dropped, which is not in a block nor in the mempool after NeoCheckTimeout. A tx not in a
+// block NeoReplaceBlocks after it is first checked, and left the mempool, is replaced by one paying more fee, see
+// replaceNeoTx.
+func (this *SyncService) checkNeoDoneTx() error {
+	checkMap, err := this.db.GetAllNeoCheck()
+	if err != nil {
+		return fmt.Errorf("[checkNeoDoneTx] this.db.GetAllNeoCheck error: %s", err)
+	}
+	timeout := int64(this.config.NeoCheckTimeout)
+	if timeout == 0 {
+		timeout = config.DEFAULT_NEO_CHECK_TIMEOUT
+	}
+	var neoHeight uint32
+	if this.config.NeoReplaceBlocks > 0 && len(checkMap) > 0 {
+		countResponse := this.neoSdk.GetBlockCount()
+		if countResponse.HasError() {
+			log.Errorf("[checkNeoDoneTx] neoSdk.GetBlockCount error: %s", countResponse.GetErrorInfo())
+		} else {
+			neoHeight = uint32(countResponse.Result)
+		}
+	}
+	for txHash, check := range checkMap {
+		if this.isStopped() {
+			return nil
+		}
+		var cause error
+		doneHash, response := this.neoApplicationLog(txHash, check.Replaced)
+		if response.NetError != nil {
+			return fmt.Errorf("[checkNeoDoneTx] neoSdk.GetApplicationLog error: %s", response.NetError)
+		}
+		if response.HasError() {
+			stuck := this.stuckNeoTx(txHash, check, neoHeight)
+			if !stuck && time.Now().Unix()-check.SentAt < timeout {
+				continue
+			}
+			rawResponse := this.neoSdk.GetRawTransaction("0x" + txHash)
+			if rawResponse.NetError != nil {
+				return fmt.Errorf("[checkNeoDoneTx] neoSdk.GetRawTransaction error: %s", rawResponse.NetError)
+			}
+			inBlock := !rawResponse.HasError() && rawResponse.Result.Confirmations > 0
+			// a tx in the mempool holds its inputs, the replacement would be refused as a double spend
+			if stuck && rawResponse.HasError() {
+				newHash, err := this.replaceNeoTx(txHash, check)
+				if err == nil {
+					log.Infof("[checkNeoDoneTx] neo tx %s is replaced by %s", txHash, newHash)
+					continue
+				}
+				log.Errorf("[checkNeoDoneTx] replace stuck neo tx %s error: %s", txHash, err)
+				// try again NeoReplaceBlocks later
+				check.SentHeight = neoHeight
+				if err := this.db.PutNeoCheck(txHash, check); err != nil {
+					log.Errorf("[checkNeoDoneTx] this.db.PutNeoCheck error: %s", err)
+				}
+				if time.Now().Unix()-check.SentAt < timeout {
+					continue
+				}
+			}
+			if !rawResponse.HasError() {
+				if !inBlock {
+					log.Infof("[checkNeoDoneTx] neo tx %s is still in the mempool", txHash)
+					continue
+				}
+				// in a block, but the node does not keep application logs
+				log.Warnf("[checkNeoDoneTx] can not find application log of neo tx %s: %s", txHash, response.Error.Message)
+			} else {
+				cause = fmt.Errorf("neo tx %s is dropped, not in a block after %d seconds", txHash, timeout)
+				for _, hash := range append(check.Replaced, txHash) {
+					this.releaseUtxos(hash)
+				}
+			}
+		} else {
+			if doneHash != txHash {
+				// the changes of the replacement will never be on chain
+				log.Warnf("[checkNeoDoneTx] neo tx %s is in a block instead of its replacement %s", doneHash, txHash)
+				this.releaseUtxos(txHash)
+			}
+			cause = vmFault(doneHash, response.Result)
+		}
+
+		if cause != nil {
+			log.Errorf("[checkNeoDoneTx] %s %s, poly height: %d, key: %s", check.Method, cause, check.Retry.Height, check.Retry.Key)
+			switch check.Method {
+			case VERIFY_AND_EXECUTE_TX:
+				if err := this.failRetry(RTON, &check.Retry, cause); err != nil {
+					log.Errorf("[checkNeoDoneTx] this.failRetry error: %s", err)
+					continue
+				}
+			case CHANGE_BOOK_KEEPER:
+				this.alert(notify.CRITICAL, EVENT_BOOKKEEPER, "change book keeper at poly height %d error: %s",
+					check.Retry.Height, cause)
+			case SYNC_BLOCK_HEADER:
+				this.alert(notify.CRITICAL, EVENT_KEY_HEADER, "sync header of poly height %d to neo error: %s",
+					check.Retry.Height, cause)
+			}
+		}
+		metrics.ObserveCall("confirm"+check.Method, cause)
+		err = this.db.DeleteNeoCheck(txHash)
+		if err != nil {
+			log.Errorf("[checkNeoDoneTx] this.db.DeleteNeoCheck error: %s", err)
+		}
 	}
 
 	return nil
 }
 
+// vmFault returns the fault of a neo tx from its application log, nil if it did not fault
+func vmFault(txHash string, appLog models.RpcApplicationLog) error {
+	for _, execution := range appLog.Executions {
+		if strings.Contains(execution.VMState, "FAULT") {
+			return fmt.Errorf("neo tx %s faulted, vmstate: %s, gas consumed: %s", txHash, execution.VMState, execution.GasConsumed)
+		}
+	}
+	return nil
+}
+
 func (this *SyncService) MakeInvocationTransaction(script []byte, from helper.UInt160, attributes []*tx.TransactionAttribute, changeAddress helper.UInt160, sysFee helper.Fixed8, netFee helper.Fixed8) (*tx.InvocationTransaction, error) {
 	if changeAddress.String() == "0000000000000000000000000000000000000000" {
 		changeAddress = from
@@ -648,28 +800,79 @@ func (this *SyncService) MakeInvocationTransaction(script []byte, from helper.UI
 	if err != nil {
 		return nil, err
 	}
-	itx := tx.NewInvocationTransaction(script)
-	if attributes != nil {
-		itx.Attributes = attributes
-	}
-	itx.Gas = gasConsumed.Add(sysFee) // add sys fee
-	fee := itx.Gas.Add(netFee)        // add net fee
-	if itx.Size() > 1024 {
-		fee = fee.Add(helper.Fixed8FromFloat64(0.001))
-		fee = fee.Add(helper.Fixed8FromFloat64(float64(itx.Size()) * 0.00001))
-	}
-	// get transaction inputs
-	inputs, totalPayGas, err := this.GetTransactionInputs(from, tx.GasToken, fee)
+	var itx *tx.InvocationTransaction
+	err = this.utxos.spend(func() (neoTx, error) {
+		itx = tx.NewInvocationTransaction(script)
+		if attributes != nil {
+			itx.Attributes = attributes
+		}
+		// signing adds the script hash of from, add it now so the hash of the tx is final
+		itx.AddScriptHashToAttribute(from)
+		itx.Gas = gasConsumed.Add(sysFee) // add sys fee
+		// the net fee is of the size of the signed tx, which grows with the inputs and change picked, pick again
+		// until it is covered
+		fee := itx.Gas.Add(this.fees.estimate(itx.Size()+WITNESS_SIZE, netFee))
+		for {
+			// get transaction inputs
+			inputs, totalPayGas, err := this.GetTransactionInputs(from, tx.GasToken, fee)
+			if err != nil {
+				return nil, err
+			}
+			itx.Inputs = inputs
+			itx.Outputs = []*tx.TransactionOutput{}
+			if totalPayGas.GreaterThan(fee) {
+				itx.Outputs = append(itx.Outputs, tx.NewTransactionOutput(tx.GasToken, totalPayGas.Sub(fee), changeAddress))
+			}
+			needed := itx.Gas.Add(this.fees.estimate(itx.Size()+WITNESS_SIZE, netFee))
+			if !needed.GreaterThan(fee) {
+				break
+			}
+			fee = needed
+		}
+		this.fees.track(itx.HashString(), fee)
+		return itx, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if totalPayGas.GreaterThan(fee) {
-		itx.Outputs = append(itx.Outputs, tx.NewTransactionOutput(tx.GasToken, totalPayGas.Sub(fee), changeAddress))
-	}
-	itx.Inputs = inputs
 	return itx, nil
 }
 
+// WITNESS_SIZE is the size of the witness of a single signature, which is added to a tx after its fee is set
+const WITNESS_SIZE = 102
+
+// sizeFee is the network fee required by the size of a tx
+func sizeFee(size int) helper.Fixed8 {
+	if size <= 1024 {
+		return helper.Zero
+	}
+	return helper.Fixed8FromFloat64(0.001).Add(helper.Fixed8FromFloat64(float64(size) * 0.00001))
+}
+
+// releaseUtxos frees the inputs of a tx which will never be in a block
+func (this *SyncService) releaseUtxos(txHash string) {
+	if err := this.utxos.release(txHash); err != nil {
+		log.Errorf("[releaseUtxos] this.utxos.release error: %s, tx: %s", err, txHash)
+	}
+}
+
+// refuseTx frees the inputs of t which is refused by neo
+func (this *SyncService) refuseTx(t neoTx) {
+	this.fees.take(t.HashString())
+	if err := this.utxos.refuse(t); err != nil {
+		log.Errorf("[refuseTx] this.utxos.refuse error: %s, tx: %s", err, t.HashString())
+	}
+}
+
+// sentToNeo books t which is sent to neo: its change is handed out to the next txs, and its fee is counted and
+// returned
+func (this *SyncService) sentToNeo(t neoTx) helper.Fixed8 {
+	if err := this.utxos.chain(t); err != nil {
+		log.Errorf("[sentToNeo] this.utxos.chain error: %s, tx: %s", err, t.HashString())
+	}
+	return this.spendNeoFee(t)
+}
+
 func (this *SyncService) GetTransactionInputs(from helper.UInt160, assetId helper.UInt256, amount helper.Fixed8) ([]*tx.CoinReference, helper.Fixed8, error) {
 	if amount.Equal(helper.Zero) {
 		return nil, helper.Zero, nil
@@ -726,48 +929,9 @@ func (this *SyncService) GetGasConsumed(script []byte, checkWitnessHashes string
 	}
 }
 
+// GetBalance returns the unspents of assetId at account which are not reserved by a tx, and their sum
 func (this *SyncService) GetBalance(account helper.UInt160, assetId helper.UInt256) ([]models.Unspent, helper.Fixed8, error) {
-	response := this.neoSdk.GetUnspents(helper.ScriptHashToAddress(account))
-	if response.HasError() {
-		return nil, helper.Zero, fmt.Errorf(response.ErrorResponse.Error.Message)
-	}
-	balances := response.Result.Balances
-	// check if there is enough balance of this asset in this account
-	var unspents []models.Unspent = []models.Unspent{}
-	sum := helper.Zero
-	for _, balance := range balances {
-		if balance.AssetHash == assetId.String() {
-			for _, unspent := range balance.Unspents {
-				neoUtxo := db.NeoUtxo{
-					TxId:  unspent.Txid,
-					Index: unspent.N,
-				}
-				sink := common.NewZeroCopySink(nil)
-				neoUtxo.Serialization(sink)
-				// check if in db
-				isSpent, err := this.db.GetUtxo(sink.Bytes())
-				if err != nil {
-					if strings.Contains(err.Error(), "value does not exist") {
-						// put this utxo into db
-						err2 := this.db.PutUtxo(sink.Bytes(), false)
-						if err2 != nil {
-							return nil, helper.Zero, err2
-						}
-						unspents = append(unspents, unspent)
-						sum = sum.Add(helper.Fixed8FromFloat64(unspent.Value))
-					} else {
-						return nil, helper.Zero, err
-					}
-				}
-				if isSpent != nil && !*isSpent {
-					unspents = append(unspents, unspent)
-					sum = sum.Add(helper.Fixed8FromFloat64(unspent.Value))
-				}
-			}
-		}
-	}
-
-	return unspents, sum, nil
+	return this.utxos.unspents(helper.ScriptHashToAddress(account), assetId)
 }
 
 func (this *SyncService) waitForNeoBlock() {
@@ -775,7 +939,9 @@ func (this *SyncService) waitForNeoBlock() {
 	currentNeoHeight := uint32(response.Result - 1)
 	newNeoHeight := currentNeoHeight
 	for currentNeoHeight == newNeoHeight {
-		time.Sleep(time.Duration(15) * time.Second)
+		if !this.sleep(time.Duration(15) * time.Second) {
+			return
+		}
 		newResponse := this.neoSdk.GetBlockCount()
 		newNeoHeight = uint32(newResponse.Result - 1)
 	}
@@ -27,25 +27,17 @@ func TestSyncService_GetCurrentNeoChainSyncHeight(t *testing.T) {
 }
 
 func TestSyncService_GetCurrentNeoChainSyncHeight2(t *testing.T) {
-	c := rpc.NewClient("http://seed1.ngd.network:20332")
-	response := c.GetStorage("0x"+helper.ReverseString("07946635d87e4120164835391e33a114135b69e1"), "0201")
-	if response.HasError() {
-		panic(response.Error.Message)
-	}
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoCCMC = testNeoCCMC
 
-	var height uint64
-	var b []byte
-	s := response.Result
-	if len(s) != 0 {
-		b = helper.HexToBytes(s)
-	}
-	if len(b) == 0 {
-		height = 0
-	} else {
-		height = helper.BytesToUInt64(b)
-		height++ // means the next block header needs to be synced
-	}
+	height, err := s.GetCurrentNeoChainSyncHeight(0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), height)
 
+	neoFake.storage["0x"+helper.ReverseString(testNeoCCMC)+"0201"] = "8fb5080000000000"
+	height, err = s.GetCurrentNeoChainSyncHeight(0)
+	assert.Nil(t, err)
 	assert.Equal(t, uint64(570768), height)
 }
 
@@ -67,6 +59,7 @@ func Test_ConsensusPayload(t *testing.T) {
 }
 
 func Test_111(t *testing.T) {
+	liveTest(t)
 	client := rpc.NewClient("http://47.88.50.171:21332")
 	for i := 11570; i > 0; i-- { // 8553
 		r := client.GetBlockByIndex(uint32(i))
@@ -111,6 +104,7 @@ func Test_BtcRecoverPubKey(t *testing.T) {
 }
 
 func Test_999(t *testing.T)  {
+	liveTest(t)
 	//sb := sc.NewScriptBuilder()
 	//scriptHash := helper.HexToBytes("7f25d672e8626d2beaa26f2cb40da6b91f40a382") // hex string to little endian byte[]
 	//
@@ -139,14 +133,14 @@ func Test_999(t *testing.T)  {
 	// create an InvocationTransaction
 	itx, err := tb.MakeInvocationTransaction(s, from, nil, from, helper.Zero, helper.Zero)
 	if err != nil {
-		fmt.Errorf("[changeBookKeeper] tb.MakeInvocationTransaction error: %s", err)
+		t.Errorf("[changeBookKeeper] tb.MakeInvocationTransaction error: %s", err)
 	}
 
 	// sign transaction
 	keyPair, err := keys.NewKeyPairFromNEP2("6PYMp74JupzrVADERufT5Htzx8ohsCGxWNHFdn97ENc1L35aQauwMEg65d", "FJNfSqUZ2ExU5MnJHqya")
 	err = tx.AddSignature(itx, keyPair)
 	if err != nil {
-		fmt.Errorf("[changeBookKeeper] tx.AddSignature error: %s", err)
+		t.Errorf("[changeBookKeeper] tx.AddSignature error: %s", err)
 	}
 
 	rawTxString := itx.RawTransactionString()
@@ -163,6 +157,7 @@ func Test_ContainString(t *testing.T)  {
 }
 
 func Test_SaveLife(t *testing.T) {
+	liveTest(t)
 	client := rpc.NewClient("http://seed10.ngd.network:20332")
 	expectedNextConsensus := "51c320d9459aa6b524456babb2b4a8ac8e432b8a"
 	realNextConsensus := "51c320d9459aa6b524456babb2b4a8ac8e432b8a"
@@ -181,6 +176,7 @@ func Test_SaveLife(t *testing.T) {
 }
 
 func Test666(t *testing.T)  {
+	liveTest(t)
 	c := rpc.NewClient("http://seed3.ngd.network:20332")
 	r1 := c.GetRawTransaction("0x526bf799e3d6d524b314c5fc8cc5ce49bf9e26b2b727f34fe8409e71cb6b29a8")
 	blockHash := r1.Result.BlockHash
@@ -190,6 +186,7 @@ func Test666(t *testing.T)  {
 }
 
 func Test999(t *testing.T)  {
+	liveTest(t)
 	c := rpc.NewClient("http://seed3.ngd.network:20332")
 	h1 := c.GetBlockByIndex(1042046)
 	header := h1.Result
@@ -3,7 +3,11 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/db"
 	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/metrics"
+	"github.com/polynetwork/neo-relayer/notify"
 	vconfig "github.com/polynetwork/poly/consensus/vbft/config"
 	autils "github.com/polynetwork/poly/native/service/utils"
 	"time"
@@ -11,22 +15,34 @@ import (
 
 // RelayToNeo sync headers from relay chain to neo
 func (this *SyncService) RelayToNeo() {
-	this.neoSyncHeight = this.config.PolyStartHeight
+	if !this.preflighted {
+		this.neoSyncHeight = startHeight(this.db.GetPolyHeight(), this.config.PolyStartHeight, this.config.ForcePolyStartHeight)
+	}
+	log.Infof("[RelayToNeo] start scanning poly from height %d", this.neoSyncHeight)
+	var stall stallWatch
 	for {
 		currentRelayChainHeight, err := this.relaySdk.GetCurrentBlockHeight()
 		if err != nil {
 			log.Errorf("[RelayToNeo] GetCurrentBlockHeight error: ", err)
+		} else {
+			metrics.ChainHeight.WithLabelValues(metrics.CHAIN_RELAY).Set(float64(currentRelayChainHeight))
 		}
 		err = this.relayToNeo(this.neoSyncHeight, currentRelayChainHeight)
 		if err != nil {
 			log.Errorf("[RelayToNeo] relayToNeo error: ", err)
 		}
-		time.Sleep(time.Duration(this.config.ScanInterval) * time.Second)
+		this.watchStall(&stall, metrics.RELAY_TO_NEO, this.neoSyncHeight, currentRelayChainHeight)
+		if !this.sleep(time.Duration(this.config.ScanInterval) * time.Second) {
+			return
+		}
 	}
 }
 
 func (this *SyncService) relayToNeo(m, n uint32) error {
 	for i := m; i < n; i++ {
+		if this.isStopped() {
+			return nil
+		}
 		log.Infof("[relayToNeo] start parse block %d", i)
 
 		// sync cross chain info
@@ -48,12 +64,20 @@ func (this *SyncService) relayToNeo(m, n uint32) error {
 					toChainID := uint64(states[2].(float64))
 					if toChainID == this.config.NeoChainID {
 						key := states[5].(string)
+						if this.neoPaused() {
+							// only the proofs wait for the budget of tomorrow, key headers and book keepers go on
+							if err := this.queueProofToNeo(i, key); err != nil {
+								return fmt.Errorf("[relayToNeo] queueProofToNeo error: %s", err)
+							}
+							continue
+						}
 						// get current neo chain sync height, which is the reliable header height
-						currentNeoChainSyncHeight, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.ChainId)
+						currentNeoChainSyncHeight, err := this.GetCurrentNeoChainSyncHeight(this.relaySdk.GetChainId())
 						if err != nil {
 							log.Errorf("[relayToNeo] GetCurrentNeoChainSyncHeight error: ", err)
 						}
 						err = this.syncProofToNeo(key, i, uint32(currentNeoChainSyncHeight))
+						metrics.ObserveCall("syncProofToNeo", err)
 						if err != nil {
 							log.Errorf("--------------------------------------------------")
 							log.Errorf("[relayToNeo] syncProofToNeo error: %s", err)
@@ -79,26 +103,55 @@ func (this *SyncService) relayToNeo(m, n uint32) error {
 			if blkInfo.NewChainConfig != nil {
 				this.waitForNeoBlock() // wait for neo block
 				err = this.changeBookKeeper(block)
+				metrics.ObserveCall("changeBookKeeper", err)
 				if err != nil {
 					log.Errorf("--------------------------------------------------")
 					log.Errorf("[relayToNeo] syncHeaderToNeo error: %s", err)
 					log.Errorf("polyHeight: %d", i)
 					log.Errorf("--------------------------------------------------")
+					this.alert(notify.CRITICAL, EVENT_BOOKKEEPER, "change book keeper at poly height %d error: %s", i, err)
 				}
 			}
 		}
 
 		this.neoSyncHeight++
+		metrics.ScanHeight.WithLabelValues(metrics.RELAY_TO_NEO).Set(float64(this.neoSyncHeight))
+		if err := this.db.PutPolyHeight(this.neoSyncHeight); err != nil {
+			log.Errorf("[relayToNeo] this.db.PutPolyHeight error: %s", err)
+		}
 	}
 	return nil
 }
 
+// queueProofToNeo puts the proof of key at poly height into the neo retries, which are sent when the fee budget allows
+func (this *SyncService) queueProofToNeo(height uint32, key string) error {
+	retry := db.NewRetry(height, key)
+	retry.LastError = "neo fee budget of today is spent"
+	if err := this.putRetry(RTON, retry); err != nil {
+		return err
+	}
+	log.Infof("[queueProofToNeo] put tx into retry db, height %d, key %s, db key %s", height, key, helper.BytesToHex(retry.Id()))
+	return nil
+}
+
 func (this *SyncService) RelayToNeoRetry() {
 	for {
-		err := this.neoRetryTx()
+		err := this.checkNeoDoneTx()
+		if err != nil {
+			log.Errorf("[RelayToNeoRetry] this.checkNeoDoneTx error:%s", err)
+		}
+		err = this.utxos.prune(this.neoAccount.Address)
 		if err != nil {
-			log.Errorf("[RelayToNeoRetry] this.neoRetryTx error:%s", err)
+			log.Errorf("[RelayToNeoRetry] this.utxos.prune error:%s", err)
+		}
+		if !this.neoPaused() {
+			err = this.neoRetryTx()
+			if err != nil {
+				log.Errorf("[RelayToNeoRetry] this.neoRetryTx error:%s", err)
+			}
+		}
+		if !this.sleep(time.Duration(this.config.ScanInterval) * time.Second) {
+			return
 		}
-		time.Sleep(time.Duration(this.config.ScanInterval) * time.Second)
 	}
 }
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+	ccmCommon "github.com/polynetwork/poly/native/service/cross_chain_manager/common"
+	autils "github.com/polynetwork/poly/native/service/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPolyTxHeight   = 10
+	testPolyLastSynced = 1 // after the key header at 0
+	testUnlockKey      = "e1695b1314a1331e3935481620417ed835669407"
+)
+
+var testGasUnspent = models.Unspent{Txid: fakeHash(7), N: 0, Value: 1}
+
+// unlockArgs serializes the args of an unlock to neo
+func unlockArgs(assetHash, toAddress []byte, amount byte) []byte {
+	sink := pCommon.NewZeroCopySink(nil)
+	sink.WriteVarBytes(assetHash)
+	sink.WriteVarBytes(toAddress)
+	sink.WriteBytes(append([]byte{amount}, make([]byte, 31)...))
+	return sink.Bytes()
+}
+
+// newRtonTestService puts a makeProof event towards neo with a valid proof at poly height testPolyTxHeight
+func newRtonTestService(t *testing.T) (*SyncService, *fakeNeo, *fakePoly, func()) {
+	s, neoFake, polyFake, clean := newFakeService(t)
+	s.config.NeoChainID = testNeoChainID
+	s.config.NeoCCMC = testNeoCCMC
+	s.config.NeoNetFee = 0.001
+	neoFake.unspents = []models.Unspent{testGasUnspent}
+
+	// the header after the tx is signed by the book keepers of the key header synced to neo
+	neoFake.storage["0x"+helper.ReverseString(testNeoCCMC)+"0201"] = "0000000000000000"
+	polyFake.headers[testPolyLastSynced-1] = polyKeyHeader(t, testPolyLastSynced-1, testPolyKeepers)
+	putUnlockProof(t, polyFake, unlockArgs(make([]byte, 20), make([]byte, 20), 100))
+
+	polyFake.height = testPolyTxHeight + 2
+	polyFake.events[testPolyTxHeight] = []*sdkcom.SmartContactEvent{{
+		Notify: []*sdkcom.NotifyEventInfo{{
+			ContractAddress: autils.CrossChainManagerContractAddress.ToHexString(),
+			States:          []interface{}{"makeProof", "", float64(testNeoChainID), "", "", testUnlockKey},
+		}},
+	}}
+	s.neoSyncHeight = testPolyTxHeight
+	return s, neoFake, polyFake, clean
+}
+
+// putUnlockProof puts the proof of an unlock with args at poly height testPolyTxHeight, and the signed header after it
+func putUnlockProof(t *testing.T, polyFake *fakePoly, args []byte) {
+	value := &ccmCommon.ToMerkleValue{
+		TxHash:      helper.HexToBytes(fakeHash(1)[2:]),
+		FromChainID: 2,
+		MakeTxParam: &ccmCommon.MakeTxParam{
+			TxHash:              []byte{1},
+			CrossChainID:        helper.HexToBytes(fakeHash(2)[2:]),
+			FromContractAddress: make([]byte, 20),
+			ToChainID:           testNeoChainID,
+			ToContractAddress:   helper.HexToBytes(testUnlockKey),
+			Method:              "unlock",
+			Args:                args,
+		},
+	}
+	sink := pCommon.NewZeroCopySink(nil)
+	value.Serialization(sink)
+	path := pCommon.NewZeroCopySink(nil)
+	path.WriteVarBytes(sink.Bytes())
+	root, err := pCommon.Uint256ParseFromBytes(HashLeaf(sink.Bytes()))
+	assert.Nil(t, err)
+
+	header := &types.Header{Height: testPolyTxHeight + 1, CrossStateRoot: root}
+	signPolyHeader(t, header, testPolyKeepers)
+	polyFake.headers[testPolyTxHeight+1] = header
+	polyFake.proofs["10"+testUnlockKey] = helper.BytesToHex(path.Bytes())
+}
+
+func TestRelayToNeo(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 1, len(neoFake.sent))
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.db.GetPolyHeight())
+
+	// the input of the tx is reserved by it
+	txHash, check := onlyNeoCheck(t, s)
+	state, err := s.db.GetUtxo(neoUtxoOf(tx.ToCoinReference(testGasUnspent)))
+	assert.Nil(t, err)
+	assert.Equal(t, true, state.Spent)
+	assert.Equal(t, txHash, state.TxHash)
+
+	// the tx is checked until it is in a block
+	assert.Equal(t, VERIFY_AND_EXECUTE_TX, check.Method)
+	assert.Equal(t, uint32(testPolyTxHeight), check.Retry.Height)
+	assert.Equal(t, testUnlockKey, check.Retry.Key)
+	assert.Nil(t, s.checkNeoDoneTx())
+	onlyNeoCheck(t, s)
+
+	neoFake.appLogs["0x"+txHash] = models.RpcApplicationLog{Executions: []models.RpcExecution{{VMState: "HALT"}}}
+	assert.Nil(t, s.checkNeoDoneTx())
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checkMap)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+}
+
+func TestRelayToNeo_Faulted(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash, _ := onlyNeoCheck(t, s)
+	neoFake.appLogs["0x"+txHash] = models.RpcApplicationLog{Executions: []models.RpcExecution{{VMState: "FAULT, BREAK", GasConsumed: "1.2"}}}
+	assert.Nil(t, s.checkNeoDoneTx())
+
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checkMap)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, testUnlockKey, retries[0].Key)
+	assert.Equal(t, uint32(1), retries[0].Attempts)
+	assert.Contains(t, retries[0].LastError, "vmstate: FAULT, BREAK")
+}
+
+func TestRelayToNeo_Dropped(t *testing.T) {
+	s, _, _, clean := newRtonTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash, check := onlyNeoCheck(t, s)
+	check.SentAt -= config.DEFAULT_NEO_CHECK_TIMEOUT
+	assert.Nil(t, s.db.PutNeoCheck(txHash, check))
+	assert.Nil(t, s.checkNeoDoneTx())
+
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Empty(t, checkMap)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, uint32(1), retries[0].Attempts)
+	assert.Contains(t, retries[0].LastError, "dropped")
+}
+
+// onlyNeoCheck returns the only tx waiting for confirmation on neo
+func onlyNeoCheck(t *testing.T, s *SyncService) (string, *db.NeoCheck) {
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checkMap))
+	for txHash, check := range checkMap {
+		return txHash, check
+	}
+	t.FailNow()
+	return "", nil
+}
+
+func TestRelayToNeo_SendFailed(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	neoFake.sendError = "RPC error"
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, uint32(testPolyTxHeight), retries[0].Height)
+	assert.Equal(t, testUnlockKey, retries[0].Key)
+	assert.Equal(t, uint32(1), retries[0].Attempts)
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+
+	neoFake.sendError = ""
+	assert.Nil(t, s.retrySyncProofToNeo(retries[0], testPolyLastSynced))
+	assert.Equal(t, 1, len(neoFake.sent))
+	retry, err := s.db.GetNeoRetry(retries[0].Id())
+	assert.Nil(t, err)
+	assert.Nil(t, retry)
+}
+
+func TestRelayToNeo_NotEnoughGas(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	neoFake.unspents = nil
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Equal(t, 0, len(neoFake.sent))
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(retries))
+	assert.Equal(t, uint32(0), retries[0].Attempts)
+	assert.False(t, isDue(retries[0]))
+}
@@ -1,32 +1,50 @@
 package service
 
 import (
-	neoRpc "github.com/joeqian10/neo-gogogo/rpc"
+	"context"
 	"github.com/joeqian10/neo-gogogo/wallet"
 	"github.com/polynetwork/neo-relayer/config"
 	"github.com/polynetwork/neo-relayer/db"
 	"github.com/polynetwork/neo-relayer/log"
 	rsdk "github.com/polynetwork/poly-go-sdk"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 )
 
 // SyncService ...
 type SyncService struct {
 	relayAccount    *rsdk.Account
-	relaySdk        *rsdk.PolySdk
+	relaySdk        *relayClient
 	relaySyncHeight uint32
 
 	neoAccount       *wallet.Account
-	neoSdk           *neoRpc.RpcClient
+	neoSdk           *neoClient
 	neoSyncHeight    uint32
 	neoNextConsensus string
+	preflighted      bool // the start heights are set by Preflight
 
 	db     *db.BoltDB
 	config *config.Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	utxos     *utxoManager
+	fees      *feePolicy
+	contracts *contractCounter
+	retryLock sync.Mutex // serializes retries of the loops and the admin api
+	admin     *http.Server
+
+	alertHook   AlertHook
+	alertLock   sync.Mutex
+	alertLevels map[string]string // last alert level of each event, empty if normal
 }
 
 // NewSyncService ...
-func NewSyncService(acct *rsdk.Account, relaySdk *rsdk.PolySdk, neoAccount *wallet.Account, neoSdk *neoRpc.RpcClient) *SyncService {
+func NewSyncService(acct *rsdk.Account, relaySdk PolyClient, neoAccount *wallet.Account, neoSdk NeoClient) *SyncService {
 	if !checkIfExist(config.DefConfig.DBPath) {
 		os.Mkdir(config.DefConfig.DBPath, os.ModePerm)
 	}
@@ -35,24 +53,119 @@ func NewSyncService(acct *rsdk.Account, relaySdk *rsdk.PolySdk, neoAccount *wall
 		log.Errorf("db.NewWaitingDB error:%s", err)
 		os.Exit(1)
 	}
+	return newSyncService(acct, relaySdk, neoAccount, neoSdk, boltDB, config.DefConfig)
+}
+
+func newSyncService(acct *rsdk.Account, relaySdk PolyClient, neoAccount *wallet.Account, neoSdk NeoClient,
+	boltDB *db.BoltDB, cfg *config.Config) *SyncService {
 	syncSvr := &SyncService{
 		relayAccount: acct,
-		relaySdk:     relaySdk,
+		relaySdk:     &relayClient{relaySdk},
 
 		neoAccount: neoAccount,
-		neoSdk:     neoSdk,
+		neoSdk:     &neoClient{neoSdk},
 		db:         boltDB,
-		config:     config.DefConfig,
+		config:     cfg,
+	}
+	utxoExpiry := cfg.UtxoExpiry
+	if utxoExpiry == 0 {
+		utxoExpiry = config.DEFAULT_UTXO_EXPIRY
 	}
+	syncSvr.utxos = newUtxoManager(boltDB, syncSvr.neoSdk, int64(utxoExpiry))
+	syncSvr.fees = newFeePolicy(syncSvr.neoSdk, cfg)
+	syncSvr.contracts = newContractCounter()
+	syncSvr.ctx, syncSvr.cancel = context.WithCancel(context.Background())
 	return syncSvr
 }
 
-// Run ...
-func (this *SyncService) Run() {
-	go this.RelayToNeo()
-	go this.RelayToNeoRetry()
-	go this.NeoToRelay()
-	go this.NeoToRelayCheckAndRetry()
+// Run starts all the loops, they exit when ctx is done or Stop is called
+func (this *SyncService) Run(ctx context.Context) {
+	this.ctx, this.cancel = context.WithCancel(ctx)
+	loops := []func(){this.RelayToNeo, this.RelayToNeoRetry, this.NeoToRelay, this.NeoToRelayCheckAndRetry}
+	if this.config.MetricsAddress != "" {
+		loops = append(loops, this.Monitor)
+	}
+	if this.config.UtxoInterval != 0 {
+		loops = append(loops, this.ManageUtxos)
+	}
+	if this.config.NeoBalanceWarn > 0 || this.config.NeoBalanceCritical > 0 ||
+		this.config.RelayBalanceWarn > 0 || this.config.RelayBalanceCritical > 0 {
+		loops = append(loops, this.CheckBalances)
+	}
+	for _, client := range []interface{}{this.neoSdk.NeoClient, this.relaySdk.PolyClient} {
+		if checker, ok := client.(nodeChecker); ok {
+			loops = append(loops, func() { this.CheckNodes(checker) })
+		}
+	}
+	for _, loop := range loops {
+		this.wg.Add(1)
+		go func(loop func()) {
+			defer this.wg.Done()
+			loop()
+		}(loop)
+	}
+}
+
+// Stop waits for every loop to finish its current block or retry item, then flushes the checkpoints and closes the db
+func (this *SyncService) Stop() {
+	this.cancel()
+	this.wg.Wait()
+	if this.admin != nil {
+		if err := this.admin.Shutdown(context.Background()); err != nil {
+			log.Errorf("[Stop] admin.Shutdown error: %s", err)
+		}
+	}
+	if this.neoSyncHeight != 0 {
+		if err := this.db.PutPolyHeight(this.neoSyncHeight); err != nil {
+			log.Errorf("[Stop] this.db.PutPolyHeight error: %s", err)
+		}
+	}
+	if this.relaySyncHeight != 0 {
+		if err := this.db.PutNeoHeight(this.relaySyncHeight); err != nil {
+			log.Errorf("[Stop] this.db.PutNeoHeight error: %s", err)
+		}
+	}
+	this.db.Close()
+	log.Infof("[Stop] sync service stopped, poly height: %d, neo height: %d", this.neoSyncHeight, this.relaySyncHeight)
+}
+
+// CheckNodes keeps the health of the rpc nodes of checker up to date
+func (this *SyncService) CheckNodes(checker nodeChecker) {
+	interval := this.config.NodeCheckInterval
+	if interval == 0 {
+		interval = config.DEFAULT_NODE_CHECK
+	}
+	for this.sleep(time.Duration(interval) * time.Second) {
+		checker.CheckNodes()
+	}
+}
+
+// isStopped reports whether the service is shutting down
+func (this *SyncService) isStopped() bool {
+	select {
+	case <-this.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d, returns false if the service is stopped in the meantime
+func (this *SyncService) sleep(d time.Duration) bool {
+	select {
+	case <-this.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// startHeight picks the height a scanner resumes from, the larger one of the checkpoint and the configured height
+func startHeight(stored, configured uint32, force bool) uint32 {
+	if force || stored < configured {
+		return configured
+	}
+	return stored
 }
 
 func checkIfExist(dir string) bool {
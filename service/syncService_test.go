@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartHeight(t *testing.T) {
+	cases := []struct {
+		name       string
+		stored     uint32
+		configured uint32
+		force      bool
+		height     uint32
+	}{
+		{"fresh db", 0, 100, false, 100},
+		{"stored ahead", 200, 100, false, 200},
+		{"configured ahead", 50, 100, false, 100},
+		{"nothing set", 0, 0, false, 0},
+		{"forced back", 200, 100, true, 100},
+		{"forced ahead", 50, 100, true, 100},
+		{"forced to zero", 200, 0, true, 0},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.height, startHeight(c.stored, c.configured, c.force), c.name)
+	}
+}
@@ -1,6 +1,11 @@
 package service
 
-import "math/big"
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+)
 
 type ToMerkleValue struct {
 	TxHash      []byte // poly chain tx hash
@@ -40,6 +45,34 @@ func DeserializeArgs(source []byte) ([]byte, []byte, *big.Int, error) {
 	return assetHash, toAddress, toAmount, nil
 }
 
+// UnlockArgs are the args of the unlock method of the lock proxy on neo
+type UnlockArgs struct {
+	ToAssetHash helper.UInt160
+	ToAddress   helper.UInt160
+	Amount      *big.Int
+}
+
+// DeserializeUnlockArgs decodes the args of an unlock, and checks the script hashes are UInt160 and the amount is
+// positive
+func DeserializeUnlockArgs(source []byte) (*UnlockArgs, error) {
+	assetHash, toAddress, amount, err := DeserializeArgs(source)
+	if err != nil {
+		return nil, fmt.Errorf("DeserializeArgs error: %s", err)
+	}
+	toAssetHash, err := helper.UInt160FromBytes(assetHash)
+	if err != nil {
+		return nil, fmt.Errorf("to asset hash %x is not a UInt160: %s", assetHash, err)
+	}
+	to, err := helper.UInt160FromBytes(toAddress)
+	if err != nil {
+		return nil, fmt.Errorf("to address %x is not a UInt160: %s", toAddress, err)
+	}
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("amount %s is not positive", amount.String())
+	}
+	return &UnlockArgs{ToAssetHash: toAssetHash, ToAddress: to, Amount: amount}, nil
+}
+
 func DeserializeMerkleValue(source []byte) (*ToMerkleValue, error) {
 	result := ToMerkleValue{}
 	offset := 0
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+	"github.com/polynetwork/neo-relayer/notify"
+)
+
+// newTransfer decodes value, the merkle value in the proof of retry, into the record of its transfer. The record is
+// returned with the error if the unlock args can not be decoded or are invalid.
+func newTransfer(retry *db.Retry, value *ToMerkleValue) (*db.Transfer, error) {
+	transfer := &db.Transfer{
+		Height:       retry.Height,
+		Key:          retry.Key,
+		PolyTxHash:   helper.BytesToHex(value.TxHash),
+		FromChainID:  value.FromChainID,
+		FromContract: helper.BytesToHex(value.TxParam.FromContract),
+		ToContract:   helper.BytesToHex(value.TxParam.ToContract),
+	}
+	args, err := DeserializeUnlockArgs(value.TxParam.Args)
+	if err != nil {
+		return transfer, err
+	}
+	transfer.AssetHash = args.ToAssetHash.String()
+	transfer.ToAddress = helper.ScriptHashToAddress(args.ToAddress)
+	transfer.Amount = args.Amount.String()
+	return transfer, nil
+}
+
+// quarantine records transfer as quarantined for cause, and moves retry to the dead letters without sending its proof
+func (this *SyncService) quarantine(retry *db.Retry, transfer *db.Transfer, cause error) error {
+	transfer.Reason = cause.Error()
+	this.putTransfer(transfer, db.TRANSFER_QUARANTINED)
+	retry.LastError = "quarantined: " + cause.Error()
+	this.alert(notify.CRITICAL, EVENT_QUARANTINE, "transfer is quarantined, height: %d, key: %s, reason: %s",
+		retry.Height, retry.Key, cause)
+	return this.db.PutDeadLetter(db.DEAD_RTON, retry)
+}
+
+// putTransfer saves transfer with status
+func (this *SyncService) putTransfer(transfer *db.Transfer, status byte) {
+	transfer.Status = status
+	transfer.UpdatedAt = time.Now().Unix()
+	if err := this.db.PutTransfer(transfer); err != nil {
+		log.Errorf("[putTransfer] this.db.PutTransfer error: %s, height: %d, key: %s", err, transfer.Height, transfer.Key)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/notify"
+	pCommon "github.com/polynetwork/poly/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeserializeUnlockArgs(t *testing.T) {
+	assetHash := helper.HexToBytes("17da3881ab2d050fea414c80b3fa8324d756f60e")
+	toAddress := helper.HexToBytes("e1695b1314a1331e3935481620417ed835669407")
+
+	args, err := DeserializeUnlockArgs(unlockArgs(assetHash, toAddress, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, "0ef656d72483fab3804c41ea0f052dab8138da17", args.ToAssetHash.String())
+	assert.Equal(t, toAddress, args.ToAddress.Bytes())
+	assert.Equal(t, "100", args.Amount.String())
+
+	// the amount is a little endian uint255
+	sink := pCommon.NewZeroCopySink(nil)
+	sink.WriteVarBytes(assetHash)
+	sink.WriteVarBytes(toAddress)
+	sink.WriteBytes(append([]byte{0x00, 0x01}, make([]byte, 30)...))
+	args, err = DeserializeUnlockArgs(sink.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "256", args.Amount.String())
+
+	_, err = DeserializeUnlockArgs(unlockArgs(assetHash, toAddress, 0))
+	assert.EqualError(t, err, "amount 0 is not positive")
+
+	_, err = DeserializeUnlockArgs(unlockArgs(assetHash, toAddress[1:], 100))
+	assert.EqualError(t, err, "to address 695b1314a1331e3935481620417ed835669407 is not a UInt160: expected byte size of 20 got 19")
+
+	_, err = DeserializeUnlockArgs(unlockArgs(assetHash[1:], toAddress, 100))
+	assert.Contains(t, err.Error(), "to asset hash da3881ab2d050fea414c80b3fa8324d756f60e is not a UInt160")
+
+	truncated := unlockArgs(assetHash, toAddress, 100)
+	_, err = DeserializeUnlockArgs(truncated[:len(truncated)-1])
+	assert.EqualError(t, err, "DeserializeArgs error: invalid offset")
+
+	negative := pCommon.NewZeroCopySink(nil)
+	negative.WriteVarBytes(assetHash)
+	negative.WriteVarBytes(toAddress)
+	negative.WriteBytes(append(make([]byte, 31), 0xff))
+	_, err = DeserializeUnlockArgs(negative.Bytes())
+	assert.Contains(t, err.Error(), "is not positive")
+}
+
+func TestRelayToNeo_Transfer(t *testing.T) {
+	s, _, _, clean := newRtonTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash, _ := onlyNeoCheck(t, s)
+	transfer, err := s.db.GetTransfer(db.NewRetry(testPolyTxHeight, testUnlockKey).Id())
+	assert.Nil(t, err)
+	assert.Equal(t, db.TRANSFER_SENT, transfer.Status)
+	assert.Equal(t, txHash, transfer.NeoTxHash)
+	assert.Equal(t, uint64(2), transfer.FromChainID)
+	assert.Equal(t, testUnlockKey, transfer.ToContract)
+	assert.Equal(t, helper.ScriptHashToAddress(helper.UInt160{}), transfer.ToAddress)
+	assert.Equal(t, "100", transfer.Amount)
+
+	// the transfer is queried by the id of its retry
+	h := s.adminHandler()
+	id := newTransferEntry(transfer).Id
+	code, body := doAdmin(t, h, http.MethodGet, "/api/v1/transfer/"+id, "")
+	assert.Equal(t, http.StatusOK, code)
+	entry := new(TransferEntry)
+	assert.Nil(t, json.Unmarshal(body, entry))
+	assert.Equal(t, "sent", entry.Status)
+	assert.Equal(t, txHash, entry.NeoTxHash)
+
+	var entries []*TransferEntry
+	code, body = doAdmin(t, h, http.MethodGet, "/api/v1/transfer?status=sent", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	assert.Equal(t, 1, len(entries))
+	code, body = doAdmin(t, h, http.MethodGet, "/api/v1/transfer?status=quarantined", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &entries))
+	assert.Empty(t, entries)
+
+	code, _ = doAdmin(t, h, http.MethodGet, "/api/v1/transfer/00", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRelayToNeo_Quarantine(t *testing.T) {
+	s, neoFake, polyFake, clean := newRtonTestService(t)
+	defer clean()
+	var alerts []*notify.Alert
+	s.SetAlertHook(func(alert *notify.Alert) { alerts = append(alerts, alert) })
+	putUnlockProof(t, polyFake, unlockArgs(make([]byte, 20), make([]byte, 20), 0))
+
+	// the transfer is not sent nor retried
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	assert.Empty(t, neoFake.sent)
+	assert.Equal(t, uint32(testPolyTxHeight+1), s.neoSyncHeight)
+	retries, err := s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+	dead, err := s.db.GetAllDeadLetter(db.DEAD_RTON)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(dead))
+	assert.Equal(t, "quarantined: amount 0 is not positive", dead[0].LastError)
+	transfer, err := s.db.GetTransfer(dead[0].Id())
+	assert.Nil(t, err)
+	assert.Equal(t, db.TRANSFER_QUARANTINED, transfer.Status)
+	assert.Equal(t, "amount 0 is not positive", transfer.Reason)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, EVENT_QUARANTINE, alerts[0].Event)
+
+	// a retry of it is quarantined as well
+	assert.Nil(t, s.db.DeleteDeadLetter(db.DEAD_RTON, dead[0].Id()))
+	retry := db.NewRetry(testPolyTxHeight, testUnlockKey)
+	assert.Nil(t, s.db.PutNeoRetry(retry))
+	assert.Nil(t, s.retrySyncProofToNeo(retry, testPolyLastSynced))
+	assert.Empty(t, neoFake.sent)
+	retries, err = s.db.GetAllNeoRetry()
+	assert.Nil(t, err)
+	assert.Empty(t, retries)
+	dead, err = s.db.GetAllDeadLetter(db.DEAD_RTON)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(dead))
+}
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+// utxoManager hands out the gas of the relayer account. The inputs of a tx are reserved by the tx when it is made,
+// and released if the tx is not sent, is dropped, or is still not in a block after expiry. The utxos which are no
+// longer unspent on chain are pruned from db.
+//
+// The change of a tx sent is handed out before the tx is in a block, so several txs can be sent in one neo block.
+// The changes are kept in memory and in db until they are seen unspent on chain.
+type utxoManager struct {
+	lock      sync.Mutex // guards the utxo states in db and changes
+	spendLock sync.Mutex // makes choosing and reserving the inputs of a tx atomic
+	db        *db.BoltDB
+	neoSdk    NeoClient
+	expiry    int64 // seconds
+	changes   map[db.NeoUtxo]*db.NeoChange
+}
+
+func newUtxoManager(boltDB *db.BoltDB, neoSdk NeoClient, expiry int64) *utxoManager {
+	changes, err := boltDB.GetAllNeoChange()
+	if err != nil {
+		log.Errorf("[newUtxoManager] boltDB.GetAllNeoChange error: %s", err)
+		changes = make(map[db.NeoUtxo]*db.NeoChange)
+	}
+	if err := migrateUtxos(boltDB, time.Now().Unix()); err != nil {
+		log.Errorf("[newUtxoManager] migrateUtxos error: %s", err)
+	}
+	return &utxoManager{db: boltDB, neoSdk: neoSdk, expiry: expiry, changes: changes}
+}
+
+// migrateUtxos sets the reservation time of the utxos spent before reservations were timed to now, so that they are
+// released after expiry like the others, and not at once while their tx may still get into a block
+func migrateUtxos(boltDB *db.BoltDB, now int64) error {
+	utxoMap, err := boltDB.GetAllUtxo()
+	if err != nil {
+		return fmt.Errorf("GetAllUtxo error: %s", err)
+	}
+	for utxo, state := range utxoMap {
+		if !state.Spent || state.ReservedAt != 0 {
+			continue
+		}
+		utxo := utxo
+		state.ReservedAt = now
+		if err := boltDB.PutUtxo(&utxo, state); err != nil {
+			return fmt.Errorf("PutUtxo error: %s", err)
+		}
+		log.Infof("[migrateUtxos] utxo %s:%d spent by an unknown tx is reserved from now", utxo.TxId, utxo.Index)
+	}
+	return nil
+}
+
+// UtxoEntry is a gas utxo of the relayer
+type UtxoEntry struct {
+	TxId    string  `json:"txid"`
+	Index   int     `json:"n"`
+	Value   float64 `json:"value"`
+	Change  bool    `json:"change"`   // the tx of the utxo is not in a block yet
+	SpentBy string  `json:"spent_by"` // hash of the tx which reserved it, empty if free
+}
+
+// neoTx is a tx spending the gas of the relayer
+type neoTx interface {
+	GetTransaction() *tx.Transaction
+	HashString() string
+	Size() int
+}
+
+// neoUtxoOf is the utxo spent by input
+func neoUtxoOf(input *tx.CoinReference) *db.NeoUtxo {
+	return &db.NeoUtxo{TxId: input.PrevHash.String(), Index: int(input.PrevIndex)}
+}
+
+// unspents returns the unspents of assetId at address which are not reserved, and their sum. The gas changes of the
+// txs not in a block yet are included. Expired reservations are released.
+func (this *utxoManager) unspents(address string, assetId helper.UInt256) ([]models.Unspent, helper.Fixed8, error) {
+	response := this.neoSdk.GetUnspents(address)
+	if response.HasError() {
+		return nil, helper.Zero, fmt.Errorf(response.GetErrorInfo())
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now().Unix()
+	unspents := []models.Unspent{}
+	sum := helper.Zero
+	for _, balance := range response.Result.Balances {
+		if balance.AssetHash != assetId.String() {
+			continue
+		}
+		for _, unspent := range balance.Unspents {
+			utxo := neoUtxoOf(tx.ToCoinReference(unspent))
+			if _, ok := this.changes[*utxo]; ok {
+				// the tx of the change is in a block
+				if err := this.deleteChange(utxo); err != nil {
+					return nil, helper.Zero, err
+				}
+			}
+			free, err := this.isFree(utxo, now)
+			if err != nil {
+				return nil, helper.Zero, err
+			}
+			if free {
+				unspents = append(unspents, unspent)
+				sum = sum.Add(helper.Fixed8FromFloat64(unspent.Value))
+			}
+		}
+	}
+	if assetId != tx.GasToken {
+		return unspents, sum, nil
+	}
+	for utxo, change := range this.changes {
+		utxo := utxo
+		free, err := this.isFree(&utxo, now)
+		if err != nil {
+			return nil, helper.Zero, err
+		}
+		if free {
+			value := helper.NewFixed8(change.Value)
+			unspents = append(unspents, models.Unspent{Txid: utxo.TxId, N: utxo.Index, Value: helper.Fixed8ToFloat64(value)})
+			sum = sum.Add(value)
+		}
+	}
+	return unspents, sum, nil
+}
+
+// isFree reports whether utxo is not reserved by a tx, it releases the reservation if expired
+func (this *utxoManager) isFree(utxo *db.NeoUtxo, now int64) (bool, error) {
+	state, err := this.db.GetUtxo(utxo)
+	if err != nil {
+		return false, err
+	}
+	if state == nil {
+		return true, this.db.PutUtxo(utxo, new(db.UtxoState))
+	}
+	if !state.Spent {
+		return true, nil
+	}
+	if now-state.ReservedAt < this.expiry {
+		return false, nil
+	}
+	log.Infof("[isFree] release expired utxo %s:%d, reserved by tx %s", utxo.TxId, utxo.Index, state.TxHash)
+	return true, this.db.PutUtxo(utxo, new(db.UtxoState))
+}
+
+// spend makes a tx by makeTx, and reserves its inputs for it. No other tx is made at the same time, so the inputs
+// chosen from the unspents are not taken by another one. makeTx returns nil if there is no tx to make.
+func (this *utxoManager) spend(makeTx func() (neoTx, error)) error {
+	this.spendLock.Lock()
+	defer this.spendLock.Unlock()
+	t, err := makeTx()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+	if err := this.reserve(t.HashString(), t.GetTransaction().Inputs); err != nil {
+		return fmt.Errorf("reserve utxo error: %s", err)
+	}
+	return nil
+}
+
+// reserve marks inputs as spent by the tx of txHash
+func (this *utxoManager) reserve(txHash string, inputs []*tx.CoinReference) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	state := &db.UtxoState{Spent: true, TxHash: txHash, ReservedAt: time.Now().Unix()}
+	for _, input := range inputs {
+		if err := this.db.PutUtxo(neoUtxoOf(input), state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chain hands out the gas outputs of t, which is sent, to the next txs. Every output of the relayer is its change.
+func (this *utxoManager) chain(t neoTx) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	txHash := t.HashString()
+	for i, output := range t.GetTransaction().Outputs {
+		if output.AssetId != tx.GasToken {
+			continue
+		}
+		utxo := &db.NeoUtxo{TxId: txHash, Index: i}
+		change := &db.NeoChange{Value: output.Value.Value, SentAt: time.Now().Unix()}
+		if err := this.db.PutNeoChange(utxo, change); err != nil {
+			return err
+		}
+		this.changes[*utxo] = change
+	}
+	return nil
+}
+
+// refuse releases the inputs of t which is refused by neo. The changes it spent are not handed out again until
+// they are in a block, in case neo does not take txs spending changes not in a block.
+func (this *utxoManager) refuse(t neoTx) error {
+	this.lock.Lock()
+	for _, input := range t.GetTransaction().Inputs {
+		utxo := neoUtxoOf(input)
+		if _, ok := this.changes[*utxo]; !ok {
+			continue
+		}
+		if err := this.deleteChange(utxo); err != nil {
+			this.lock.Unlock()
+			return err
+		}
+		log.Infof("[refuse] stop spending change %s:%d before it is in a block", utxo.TxId, utxo.Index)
+	}
+	this.lock.Unlock()
+	return this.release(t.HashString())
+}
+
+// release frees the utxos reserved by the tx of txHash, which is not sent or will never be in a block, and forgets
+// its changes
+func (this *utxoManager) release(txHash string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	utxoMap, err := this.db.GetAllUtxo()
+	if err != nil {
+		return err
+	}
+	for utxo, state := range utxoMap {
+		if state.TxHash != txHash {
+			continue
+		}
+		utxo := utxo
+		if err := this.db.PutUtxo(&utxo, new(db.UtxoState)); err != nil {
+			return err
+		}
+		log.Infof("[release] release utxo %s:%d of tx %s", utxo.TxId, utxo.Index, txHash)
+	}
+	for utxo := range this.changes {
+		if utxo.TxId != txHash {
+			continue
+		}
+		utxo := utxo
+		if err := this.deleteChange(&utxo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropChanges stops handing out the changes of the tx of txHash, which is being replaced. They are found on chain if
+// the tx is in a block after all. It fails if one of them is reserved by another tx, which would never be in a block
+// once the replacement is. The changes dropped are returned for restoreChanges.
+func (this *utxoManager) dropChanges(txHash string) (map[db.NeoUtxo]*db.NeoChange, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	dropped := make(map[db.NeoUtxo]*db.NeoChange)
+	for utxo, change := range this.changes {
+		if utxo.TxId != txHash {
+			continue
+		}
+		utxo := utxo
+		state, err := this.db.GetUtxo(&utxo)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil && state.Spent {
+			return nil, fmt.Errorf("change %s:%d is spent by tx %s", utxo.TxId, utxo.Index, state.TxHash)
+		}
+		dropped[utxo] = change
+	}
+	for utxo := range dropped {
+		utxo := utxo
+		if err := this.deleteChange(&utxo); err != nil {
+			return nil, err
+		}
+	}
+	return dropped, nil
+}
+
+// restoreChanges hands out again the changes dropped by dropChanges, when the replacement is not sent
+func (this *utxoManager) restoreChanges(changes map[db.NeoUtxo]*db.NeoChange) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for utxo, change := range changes {
+		utxo := utxo
+		if err := this.db.PutNeoChange(&utxo, change); err != nil {
+			return err
+		}
+		this.changes[utxo] = change
+	}
+	return nil
+}
+
+// prune deletes the utxos which are not unspent at address any more, and the changes not seen in a block after expiry
+func (this *utxoManager) prune(address string) error {
+	response := this.neoSdk.GetUnspents(address)
+	if response.HasError() {
+		return fmt.Errorf(response.GetErrorInfo())
+	}
+	unspent := make(map[db.NeoUtxo]bool)
+	for _, balance := range response.Result.Balances {
+		for _, u := range balance.Unspents {
+			unspent[*neoUtxoOf(tx.ToCoinReference(u))] = true
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now().Unix()
+	for utxo, change := range this.changes {
+		if unspent[utxo] || now-change.SentAt < this.expiry {
+			continue
+		}
+		utxo := utxo
+		if err := this.deleteChange(&utxo); err != nil {
+			return err
+		}
+	}
+	utxoMap, err := this.db.GetAllUtxo()
+	if err != nil {
+		return err
+	}
+	for utxo := range utxoMap {
+		if _, ok := this.changes[utxo]; ok || unspent[utxo] {
+			continue
+		}
+		utxo := utxo
+		if err := this.db.DeleteUtxo(&utxo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isChange reports whether utxo is the change of a tx not in a block yet
+func (this *utxoManager) isChange(utxo *db.NeoUtxo) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, ok := this.changes[*utxo]
+	return ok
+}
+
+// list returns every gas utxo at address, and the changes not in a block yet
+func (this *utxoManager) list(address string) ([]*UtxoEntry, error) {
+	response := this.neoSdk.GetUnspents(address)
+	if response.HasError() {
+		return nil, fmt.Errorf(response.GetErrorInfo())
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var entries []*UtxoEntry
+	add := func(utxo *db.NeoUtxo, value float64, change bool) error {
+		state, err := this.db.GetUtxo(utxo)
+		if err != nil {
+			return err
+		}
+		entry := &UtxoEntry{TxId: utxo.TxId, Index: utxo.Index, Value: value, Change: change}
+		if state != nil && state.Spent {
+			entry.SpentBy = state.TxHash
+			if entry.SpentBy == "" {
+				entry.SpentBy = "unknown"
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	}
+	for _, balance := range response.Result.Balances {
+		if balance.AssetHash != tx.GasToken.String() {
+			continue
+		}
+		for _, unspent := range balance.Unspents {
+			if err := add(neoUtxoOf(tx.ToCoinReference(unspent)), unspent.Value, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for utxo, change := range this.changes {
+		utxo := utxo
+		if err := add(&utxo, helper.Fixed8ToFloat64(helper.NewFixed8(change.Value)), true); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// deleteChange forgets the change utxo, the lock is held by the caller
+func (this *utxoManager) deleteChange(utxo *db.NeoUtxo) error {
+	if err := this.db.DeleteNeoChange(utxo); err != nil {
+		return err
+	}
+	delete(this.changes, *utxo)
+	return nil
+}
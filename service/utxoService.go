@@ -0,0 +1,188 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/log"
+)
+
+// ManageUtxos consolidates the gas dust and splits the gas for concurrent txs of the relayer from time to time
+func (this *SyncService) ManageUtxos() {
+	for this.sleep(time.Duration(this.config.UtxoInterval) * time.Second) {
+		if err := this.manageUtxos(); err != nil {
+			log.Errorf("[ManageUtxos] %s", err)
+		}
+	}
+}
+
+// manageUtxos makes one round of consolidating and splitting as configured
+func (this *SyncService) manageUtxos() error {
+	if this.neoPaused() {
+		return nil
+	}
+	if this.config.UtxoDust > 0 {
+		txHash, err := this.ConsolidateUtxos(this.config.UtxoDust, config.DEFAULT_UTXO_MAX_INPUTS)
+		if err != nil {
+			return fmt.Errorf("ConsolidateUtxos error: %s", err)
+		}
+		if txHash != "" {
+			log.Infof("[manageUtxos] consolidate dust in tx %s", txHash)
+		}
+	}
+	if this.config.UtxoCount == 0 || this.config.UtxoSize <= 0 {
+		return nil
+	}
+	entries, err := this.ListUtxos()
+	if err != nil {
+		return fmt.Errorf("ListUtxos error: %s", err)
+	}
+	// reserved utxos are counted, they come back as changes
+	count := 0
+	for _, entry := range entries {
+		if entry.Value >= this.config.UtxoSize {
+			count++
+		}
+	}
+	if count >= int(this.config.UtxoCount) {
+		return nil
+	}
+	txHash, err := this.SplitUtxos(int(this.config.UtxoCount)-count, this.config.UtxoSize)
+	if err != nil {
+		return fmt.Errorf("SplitUtxos error: %s", err)
+	}
+	log.Infof("[manageUtxos] split %d utxos of %f gas in tx %s", int(this.config.UtxoCount)-count, this.config.UtxoSize, txHash)
+	return nil
+}
+
+// ListUtxos lists the gas utxos of the relayer, with the changes not in a block yet
+func (this *SyncService) ListUtxos() ([]*UtxoEntry, error) {
+	return this.utxos.list(this.neoAccount.Address)
+}
+
+// ConsolidateUtxos moves at most maxInputs free gas utxos smaller than dust into one, and returns the hash of the tx.
+// The changes not in a block yet are left alone. It returns an empty hash if there are less than two of them.
+func (this *SyncService) ConsolidateUtxos(dust float64, maxInputs int) (string, error) {
+	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
+	if err != nil {
+		return "", fmt.Errorf("[ConsolidateUtxos] AddressToScriptHash error: %s", err)
+	}
+	var ctx *tx.ContractTransaction
+	err = this.utxos.spend(func() (neoTx, error) {
+		unspents, _, err := this.GetBalance(from, tx.GasToken)
+		if err != nil {
+			return nil, err
+		}
+		var inputs []*tx.CoinReference
+		sum := helper.Zero
+		for _, unspent := range unspents {
+			input := tx.ToCoinReference(unspent)
+			if unspent.Value >= dust || this.utxos.isChange(neoUtxoOf(input)) {
+				continue
+			}
+			inputs = append(inputs, input)
+			sum = sum.Add(helper.Fixed8FromFloat64(unspent.Value))
+			if len(inputs) == maxInputs {
+				break
+			}
+		}
+		if len(inputs) < 2 {
+			return nil, nil
+		}
+		ctx = newGasTransaction(from, inputs)
+		output := tx.NewTransactionOutput(tx.GasToken, sum, from)
+		ctx.Outputs = []*tx.TransactionOutput{output}
+		fee := this.fees.estimate(ctx.Size(), this.fees.netFee(0))
+		if !sum.GreaterThan(fee) {
+			return nil, fmt.Errorf("dust %s gas is not more than the fee %s", sum.String(), fee.String())
+		}
+		output.Value = sum.Sub(fee)
+		this.fees.track(ctx.HashString(), fee)
+		return ctx, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("[ConsolidateUtxos] %s", err)
+	}
+	if ctx == nil {
+		return "", nil
+	}
+	txHash, err := this.sendGasTx(ctx)
+	if err != nil {
+		return "", fmt.Errorf("[ConsolidateUtxos] %s", err)
+	}
+	return txHash, nil
+}
+
+// SplitUtxos moves count outputs of size gas out of the free gas utxos, and returns the hash of the tx. The outputs
+// can be spent by the relay txs at once.
+func (this *SyncService) SplitUtxos(count int, size float64) (string, error) {
+	if count <= 0 || size <= 0 {
+		return "", fmt.Errorf("[SplitUtxos] invalid count %d or size %f", count, size)
+	}
+	from, err := helper.AddressToScriptHash(this.neoAccount.Address)
+	if err != nil {
+		return "", fmt.Errorf("[SplitUtxos] AddressToScriptHash error: %s", err)
+	}
+	value := helper.Fixed8FromFloat64(size)
+	amount := helper.NewFixed8(value.Value * int64(count))
+	netFee := this.fees.netFee(0)
+	var ctx *tx.ContractTransaction
+	err = this.utxos.spend(func() (neoTx, error) {
+		// the fee grows with the inputs picked, pick again until it is covered
+		fee := netFee
+		for {
+			inputs, sum, err := this.GetTransactionInputs(from, tx.GasToken, amount.Add(fee))
+			if err != nil {
+				return nil, err
+			}
+			ctx = newGasTransaction(from, inputs)
+			for i := 0; i < count; i++ {
+				ctx.Outputs = append(ctx.Outputs, tx.NewTransactionOutput(tx.GasToken, value, from))
+			}
+			if change := sum.Sub(amount).Sub(fee); change.GreaterThan(helper.Zero) {
+				ctx.Outputs = append(ctx.Outputs, tx.NewTransactionOutput(tx.GasToken, change, from))
+			}
+			needed := this.fees.estimate(ctx.Size(), netFee)
+			if !needed.GreaterThan(fee) {
+				this.fees.track(ctx.HashString(), fee)
+				return ctx, nil
+			}
+			fee = needed
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("[SplitUtxos] %s", err)
+	}
+	txHash, err := this.sendGasTx(ctx)
+	if err != nil {
+		return "", fmt.Errorf("[SplitUtxos] %s", err)
+	}
+	return txHash, nil
+}
+
+// newGasTransaction makes a contract tx spending inputs of from. The script hash attribute is added before the
+// inputs are reserved by the hash, since signing adds it otherwise.
+func newGasTransaction(from helper.UInt160, inputs []*tx.CoinReference) *tx.ContractTransaction {
+	ctx := tx.NewContractTransaction()
+	ctx.AddScriptHashToAttribute(from)
+	ctx.Inputs = inputs
+	return ctx
+}
+
+// sendGasTx signs and sends ctx whose inputs are reserved, and hands out its outputs to the next txs
+func (this *SyncService) sendGasTx(ctx *tx.ContractTransaction) (string, error) {
+	if err := tx.AddSignature(ctx, this.neoAccount.KeyPair); err != nil {
+		this.refuseTx(ctx)
+		return "", fmt.Errorf("tx.AddSignature error: %s", err)
+	}
+	response := this.neoSdk.SendRawTransaction(ctx.RawTransactionString())
+	if response.HasError() {
+		this.refuseTx(ctx)
+		return "", fmt.Errorf("SendRawTransaction error: %s", response.GetErrorInfo())
+	}
+	this.sentToNeo(ctx)
+	return ctx.HashString(), nil
+}
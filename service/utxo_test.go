@@ -0,0 +1,214 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeqian10/neo-gogogo/helper"
+	"github.com/joeqian10/neo-gogogo/rpc/models"
+	"github.com/joeqian10/neo-gogogo/tx"
+	"github.com/polynetwork/neo-relayer/config"
+	"github.com/polynetwork/neo-relayer/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUtxoManager(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+
+	u1 := models.Unspent{Txid: fakeHash(1), N: 0, Value: 1}
+	u2 := models.Unspent{Txid: fakeHash(2), N: 1, Value: 2}
+	neoFake.unspents = []models.Unspent{u1, u2}
+	address := s.neoAccount.Address
+
+	unspents, sum, err := s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u1, u2}, unspents)
+	assert.Equal(t, helper.Fixed8FromInt64(3), sum)
+
+	// reserved utxos are not handed out again until released
+	assert.Nil(t, s.utxos.reserve("0a", []*tx.CoinReference{tx.ToCoinReference(u1)}))
+	unspents, sum, err = s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u2}, unspents)
+	assert.Equal(t, helper.Fixed8FromInt64(2), sum)
+	assert.Nil(t, s.utxos.release("0b"))
+	unspents, _, err = s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u2}, unspents)
+	assert.Nil(t, s.utxos.release("0a"))
+	unspents, _, err = s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u1, u2}, unspents)
+
+	// the ones written before reservations are reserved from the time they are loaded
+	assert.Nil(t, s.db.PutUtxo(neoUtxoOf(tx.ToCoinReference(u1)), &db.UtxoState{Spent: true}))
+	s.utxos = newUtxoManager(s.db, neoFake, s.utxos.expiry)
+	state, err := s.db.GetUtxo(neoUtxoOf(tx.ToCoinReference(u1)))
+	assert.Nil(t, err)
+	assert.True(t, state.Spent)
+	assert.True(t, state.ReservedAt >= time.Now().Unix()-1)
+	unspents, _, err = s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u2}, unspents)
+
+	// expired reservations are released
+	assert.Nil(t, s.db.PutUtxo(neoUtxoOf(tx.ToCoinReference(u1)),
+		&db.UtxoState{Spent: true, ReservedAt: time.Now().Unix() - s.utxos.expiry}))
+	assert.Nil(t, s.db.PutUtxo(neoUtxoOf(tx.ToCoinReference(u2)),
+		&db.UtxoState{Spent: true, TxHash: "0c", ReservedAt: time.Now().Unix() - s.utxos.expiry}))
+	unspents, _, err = s.utxos.unspents(address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u1, u2}, unspents)
+
+	// utxos spent on chain are pruned
+	assert.Nil(t, s.utxos.reserve("0d", []*tx.CoinReference{tx.ToCoinReference(u1)}))
+	neoFake.unspents = []models.Unspent{u2}
+	assert.Nil(t, s.utxos.prune(address))
+	utxoMap, err := s.db.GetAllUtxo()
+	assert.Nil(t, err)
+	assert.Equal(t, map[db.NeoUtxo]*db.UtxoState{*neoUtxoOf(tx.ToCoinReference(u2)): {}}, utxoMap)
+}
+
+func TestRelayToNeo_DroppedReleasesUtxo(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash, check := onlyNeoCheck(t, s)
+	unspents, _, err := s.utxos.unspents(s.neoAccount.Address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unspents))
+	assert.Equal(t, txHash, unspents[0].Txid) // the change
+
+	check.SentAt -= config.DEFAULT_NEO_CHECK_TIMEOUT
+	assert.Nil(t, s.db.PutNeoCheck(txHash, check))
+	assert.Nil(t, s.checkNeoDoneTx())
+	unspents, _, err = s.utxos.unspents(s.neoAccount.Address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, neoFake.unspents, unspents)
+}
+
+func TestRelayToNeo_ChainsChange(t *testing.T) {
+	s, neoFake, _, clean := newRtonTestService(t)
+	defer clean()
+
+	// two txs are sent with one confirmed utxo, the second spends the change of the first
+	assert.Nil(t, s.relayToNeo(testPolyTxHeight, testPolyTxHeight+1))
+	txHash1, _ := onlyNeoCheck(t, s)
+	assert.Nil(t, s.retrySyncProofToNeo(db.NewRetry(testPolyTxHeight, testUnlockKey), testPolyLastSynced))
+	assert.Equal(t, 2, len(neoFake.sent))
+	checkMap, err := s.db.GetAllNeoCheck()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(checkMap))
+	state, err := s.db.GetUtxo(&db.NeoUtxo{TxId: txHash1, Index: 0})
+	assert.Nil(t, err)
+	assert.True(t, state.Spent)
+	assert.NotEqual(t, txHash1, state.TxHash)
+	txHash2 := state.TxHash
+	assert.Contains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash2, Index: 0})
+
+	// a refused tx does not spend the change of txHash2 again before it is in a block
+	neoFake.sendError = "RPC error"
+	assert.NotNil(t, s.retrySyncProofToNeo(db.NewRetry(testPolyTxHeight, testUnlockKey), testPolyLastSynced))
+	assert.NotContains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash2, Index: 0})
+	unspents, _, err := s.utxos.unspents(s.neoAccount.Address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Empty(t, unspents)
+
+	// changes in a block are not kept as changes any more
+	neoFake.unspents = []models.Unspent{{Txid: txHash2, N: 0, Value: 0.998}}
+	unspents, _, err = s.utxos.unspents(s.neoAccount.Address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, neoFake.unspents, unspents)
+	assert.NotContains(t, s.utxos.changes, db.NeoUtxo{TxId: txHash2, Index: 0})
+}
+
+func TestSyncService_ConsolidateUtxos(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoNetFee = 0.001
+
+	u1 := models.Unspent{Txid: fakeHash(1), N: 0, Value: 0.01}
+	u2 := models.Unspent{Txid: fakeHash(2), N: 0, Value: 0.02}
+	u3 := models.Unspent{Txid: fakeHash(3), N: 0, Value: 5}
+	neoFake.unspents = []models.Unspent{u1}
+	txHash, err := s.ConsolidateUtxos(0.1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", txHash)
+
+	// a reserved utxo is not consolidated
+	neoFake.unspents = []models.Unspent{u1, u2, u3}
+	assert.Nil(t, s.utxos.reserve("0a", []*tx.CoinReference{tx.ToCoinReference(u2)}))
+	txHash, err = s.ConsolidateUtxos(0.1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", txHash)
+
+	assert.Nil(t, s.utxos.release("0a"))
+	txHash, err = s.ConsolidateUtxos(0.1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(neoFake.sent))
+	assert.Equal(t, 1, len(s.utxos.changes))
+	assert.Equal(t, helper.Fixed8FromFloat64(0.029).Value, s.utxos.changes[db.NeoUtxo{TxId: txHash, Index: 0}].Value)
+	for _, u := range []models.Unspent{u1, u2} {
+		state, err := s.db.GetUtxo(neoUtxoOf(tx.ToCoinReference(u)))
+		assert.Nil(t, err)
+		assert.Equal(t, txHash, state.TxHash)
+	}
+
+	// the change is not consolidated again before it is in a block
+	txHash, err = s.ConsolidateUtxos(0.1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", txHash)
+}
+
+func TestSyncService_SplitUtxos(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoNetFee = 0.001
+	u1 := models.Unspent{Txid: fakeHash(1), N: 0, Value: 10}
+	neoFake.unspents = []models.Unspent{u1}
+
+	_, err := s.SplitUtxos(20, 1)
+	assert.NotNil(t, err)
+	assert.Empty(t, neoFake.sent)
+
+	txHash, err := s.SplitUtxos(3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(neoFake.sent))
+	assert.Equal(t, 4, len(s.utxos.changes))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, helper.Fixed8FromInt64(1).Value, s.utxos.changes[db.NeoUtxo{TxId: txHash, Index: i}].Value)
+	}
+	assert.Equal(t, helper.Fixed8FromFloat64(6.999).Value, s.utxos.changes[db.NeoUtxo{TxId: txHash, Index: 3}].Value)
+
+	// a refused split releases the input
+	neoFake.sendError = "RPC error"
+	s.utxos.changes = map[db.NeoUtxo]*db.NeoChange{}
+	assert.Nil(t, s.utxos.release(txHash))
+	_, err = s.SplitUtxos(3, 1)
+	assert.NotNil(t, err)
+	unspents, _, err := s.utxos.unspents(s.neoAccount.Address, tx.GasToken)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Unspent{u1}, unspents)
+}
+
+func TestSyncService_manageUtxos(t *testing.T) {
+	s, neoFake, _, clean := newFakeService(t)
+	defer clean()
+	s.config.NeoNetFee = 0.001
+	s.config.UtxoCount = 3
+	s.config.UtxoSize = 1
+	neoFake.unspents = []models.Unspent{{Txid: fakeHash(1), N: 0, Value: 1}, {Txid: fakeHash(2), N: 0, Value: 10}}
+
+	// the two utxos of 1 gas at least are kept, one more is split
+	assert.Nil(t, s.manageUtxos())
+	assert.Equal(t, 1, len(neoFake.sent))
+	entries, err := s.ListUtxos()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+
+	// the outputs not in a block yet are counted
+	assert.Nil(t, s.manageUtxos())
+	assert.Equal(t, 1, len(neoFake.sent))
+}